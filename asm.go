@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/asm"
+)
+
+// assemble runs the asm subcommand which assembles a source file into a rom.
+func assemble(args []string) error {
+	set := flag.NewFlagSet(args[0], flag.ExitOnError)
+	out := set.String("o", "", "Path of the rom, defaults to the source path with .ch8 extension")
+	symbols := set.String("sym", "", "Write labels and source lines to the symbol file at given path")
+	set.Parse(args[1:])
+	if set.NArg() != 1 {
+		return fmt.Errorf("usage: %s [flags] <path-to-source>", args[0])
+	}
+	src := set.Arg(0)
+
+	p, err := asm.AssembleFile(src)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(src, filepath.Ext(src)) + ".ch8"
+	}
+	if err := ioutil.WriteFile(*out, p.Code, 0644); err != nil {
+		return err
+	}
+	if *symbols == "" {
+		return nil
+	}
+	f, err := os.Create(*symbols)
+	if err != nil {
+		return err
+	}
+	if err := p.WriteSymbols(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,482 @@
+// Package asm assembles CHIP-8 programs written in the syntax printed by the
+// disassembler.
+//
+// A line holds an optional label followed by an instruction or a directive.
+// Comments start with a semicolon. Numbers are decimal, hexadecimal with # or
+// 0x prefix or binary with 0b prefix. Labels can be used in place of numbers
+// with an optional offset, e.g. "data+2". Directives are:
+//
+//	DB byte, ...       bytes
+//	DW word, ...       big endian words
+//	ORG addr           continues at the address
+//	INCLUDE "path"     assembles the file relative to the current one
+package asm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// Origin is the address where programs are loaded.
+const Origin = 0x200
+
+// maxIncludeDepth limits nesting of included files.
+const maxIncludeDepth = 16
+
+// Error is an error in the source.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Program is an assembled program.
+type Program struct {
+	// Code is the binary loaded at Origin.
+	Code []byte
+	// Symbols holds addresses of labels.
+	Symbols map[string]int
+	// Lines holds source lines of instructions and data by address.
+	Lines map[int]symbols.Line
+}
+
+// statement is a parsed line of the source.
+type statement struct {
+	file string
+	line int
+	op   string
+	args []string
+	form *form
+	addr int
+	// text is the source of the statement.
+	text string
+}
+
+func (s *statement) errorf(format string, args ...interface{}) error {
+	return &Error{File: s.file, Line: s.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// size returns the number of bytes emitted by the statement.
+func (s *statement) size() int {
+	switch s.op {
+	case "DB":
+		return len(s.args)
+	case "DW":
+		return 2 * len(s.args)
+	case "ORG":
+		return 0
+	}
+	return s.form.size()
+}
+
+type assembler struct {
+	statements []*statement
+	symbols    map[string]int
+	addr       int
+	depth      int
+	// labels are defined at the address of the next statement.
+	pending []string
+}
+
+// AssembleFile assembles the source file at path.
+func AssembleFile(path string) (*Program, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(path, src)
+}
+
+// Assemble assembles the source. Included files are read relative to the
+// directory of name.
+func Assemble(name string, src []byte) (*Program, error) {
+	a := &assembler{
+		symbols: make(map[string]int),
+		addr:    Origin,
+	}
+	if err := a.parse(name, src); err != nil {
+		return nil, err
+	}
+	return a.encode()
+}
+
+// parse parses the source and assigns addresses to statements and labels.
+func (a *assembler) parse(name string, src []byte) error {
+	for n, text := range strings.Split(string(src), "\n") {
+		s := &statement{file: name, line: n + 1}
+		text = stripComment(text)
+		for {
+			label, rest, ok := cutLabel(text)
+			if !ok {
+				break
+			}
+			if err := a.define(s, label); err != nil {
+				return err
+			}
+			text = rest
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		s.op = strings.ToUpper(fields[0])
+		s.text = strings.TrimSpace(text)
+		operands := strings.TrimSpace(text[strings.Index(text, fields[0])+len(fields[0]):])
+		if operands != "" {
+			for _, arg := range strings.Split(operands, ",") {
+				s.args = append(s.args, strings.TrimSpace(arg))
+			}
+		}
+		if err := a.statement(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statement adds the parsed statement to the program.
+func (a *assembler) statement(s *statement) error {
+	switch s.op {
+	case "INCLUDE":
+		return a.include(s)
+	case "ORG":
+		if len(s.args) != 1 {
+			return s.errorf("ORG needs an address")
+		}
+		addr, err := a.eval(s, s.args[0], true)
+		if err != nil {
+			return err
+		}
+		if addr < Origin || addr > 0xFFFF {
+			return s.errorf("address %#x is outside of the program", addr)
+		}
+		a.addr = addr
+	case "DB", "DW":
+		if len(s.args) == 0 {
+			return s.errorf("%s needs values", s.op)
+		}
+	default:
+		for k := range forms {
+			if forms[k].op == s.op && forms[k].match(s.args) {
+				s.form = &forms[k]
+				break
+			}
+		}
+		if s.form == nil {
+			if !isMnemonic(s.op) {
+				return s.errorf("unknown instruction %q", s.op)
+			}
+			return s.errorf("invalid operands of %s: %s", s.op, strings.Join(s.args, ", "))
+		}
+	}
+	for _, label := range a.pending {
+		a.symbols[label] = a.addr
+	}
+	a.pending = a.pending[:0]
+	s.addr = a.addr
+	a.addr += s.size()
+	a.statements = append(a.statements, s)
+	return nil
+}
+
+// define defines the label at the current address.
+func (a *assembler) define(s *statement, label string) error {
+	if _, ok := register(label); ok || keywords[strings.ToUpper(label)] {
+		return s.errorf("reserved label name %q", label)
+	}
+	if _, ok := a.symbols[label]; ok {
+		return s.errorf("label %q is already defined", label)
+	}
+	for _, l := range a.pending {
+		if l == label {
+			return s.errorf("label %q is already defined", label)
+		}
+	}
+	// The address is not known until the next statement, because it may be
+	// changed with ORG.
+	a.symbols[label] = a.addr
+	a.pending = append(a.pending, label)
+	return nil
+}
+
+// include assembles the included file.
+func (a *assembler) include(s *statement) error {
+	if len(s.args) != 1 {
+		return s.errorf("INCLUDE needs a path")
+	}
+	path, err := strconv.Unquote(s.args[0])
+	if err != nil {
+		return s.errorf("invalid path %s", s.args[0])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(s.file), path)
+	}
+	if a.depth == maxIncludeDepth {
+		return s.errorf("too many nested includes")
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s.errorf("%v", err)
+	}
+	a.depth++
+	defer func() { a.depth-- }()
+	return a.parse(path, src)
+}
+
+// encode emits the code of statements.
+func (a *assembler) encode() (*Program, error) {
+	var code []byte
+	lines := make(map[int]symbols.Line)
+	written := make(map[int]bool)
+	emit := func(s *statement, addr int, b ...byte) error {
+		for k, v := range b {
+			at := addr + k - Origin
+			if written[at] {
+				return s.errorf("code overlaps at %#x", addr+k)
+			}
+			written[at] = true
+			for len(code) <= at {
+				code = append(code, 0)
+			}
+			code[at] = v
+		}
+		return nil
+	}
+
+	for _, s := range a.statements {
+		var b []byte
+		switch s.op {
+		case "ORG":
+			continue
+		case "DB":
+			for _, arg := range s.args {
+				v, err := a.value(s, arg, -0x80, 0xFF)
+				if err != nil {
+					return nil, err
+				}
+				b = append(b, byte(v))
+			}
+		case "DW":
+			for _, arg := range s.args {
+				v, err := a.value(s, arg, -0x8000, 0xFFFF)
+				if err != nil {
+					return nil, err
+				}
+				b = append(b, byte(v>>8), byte(v))
+			}
+		default:
+			var err error
+			if b, err = a.instruction(s); err != nil {
+				return nil, err
+			}
+		}
+		if s.addr+len(b) > 0x10000 {
+			return nil, s.errorf("program does not fit into the memory")
+		}
+		if err := emit(s, s.addr, b...); err != nil {
+			return nil, err
+		}
+		lines[s.addr] = symbols.Line{File: s.file, Line: s.line, Text: s.text}
+	}
+	return &Program{Code: code, Symbols: a.symbols, Lines: lines}, nil
+}
+
+// instruction encodes the instruction.
+func (a *assembler) instruction(s *statement) ([]byte, error) {
+	opcode := s.form.opcode
+	var long []byte
+	for k, spec := range s.form.args {
+		arg := s.args[k]
+		var v int
+		var err error
+		switch spec {
+		case "x", "y":
+			v, _ = register(arg)
+		case "n", "p":
+			v, err = a.value(s, arg, 0, 0xF)
+		case "b":
+			v, err = a.value(s, arg, -0x80, 0xFF)
+		case "a":
+			v, err = a.value(s, arg, 0, 0xFFF)
+		case "l":
+			v, err = a.value(s, strings.Fields(arg)[1], 0, 0xFFFF)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch spec {
+		case "x", "p":
+			opcode |= uint16(v) << 8
+		case "y":
+			opcode |= uint16(v) << 4
+		case "n":
+			opcode |= uint16(v)
+		case "b":
+			opcode |= uint16(v) & 0xFF
+		case "a":
+			opcode |= uint16(v)
+		case "l":
+			long = []byte{byte(v >> 8), byte(v)}
+		}
+	}
+	return append([]byte{byte(opcode >> 8), byte(opcode)}, long...), nil
+}
+
+// value evaluates the expression and checks its range.
+func (a *assembler) value(s *statement, expr string, min, max int) (int, error) {
+	v, err := a.eval(s, expr, false)
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, s.errorf("value %s out of range", expr)
+	}
+	return v, nil
+}
+
+// eval evaluates sum of numbers and labels. Labels defined later can not be
+// used if resolved is set.
+func (a *assembler) eval(s *statement, expr string, resolved bool) (int, error) {
+	total, sign := 0, 1
+	rest := expr
+	for {
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "-") {
+			sign, rest = -sign, rest[1:]
+			continue
+		}
+		k := strings.IndexAny(rest, "+-")
+		term := rest
+		if k >= 0 {
+			term = rest[:k]
+		}
+		v, err := a.term(s, strings.TrimSpace(term), resolved)
+		if err != nil {
+			return 0, err
+		}
+		total += sign * v
+		if k < 0 {
+			break
+		}
+		sign = 1
+		if rest[k] == '-' {
+			sign = -1
+		}
+		rest = rest[k+1:]
+	}
+	return total, nil
+}
+
+// term evaluates a number or a label.
+func (a *assembler) term(s *statement, term string, resolved bool) (int, error) {
+	if term == "" {
+		return 0, s.errorf("missing value")
+	}
+	if v, ok := parseNumber(term); ok {
+		return v, nil
+	}
+	v, ok := a.symbols[term]
+	if !ok || resolved && a.isPending(term) {
+		return 0, s.errorf("undefined label %q", term)
+	}
+	return v, nil
+}
+
+func (a *assembler) isPending(label string) bool {
+	for _, l := range a.pending {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses decimal, #hex, 0xhex and 0bbinary numbers.
+func parseNumber(s string) (int, bool) {
+	base := 10
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "#"):
+		base, s = 16, s[1:]
+	case strings.HasPrefix(lower, "0x"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(lower, "0b"):
+		base, s = 2, s[2:]
+	}
+	v, err := strconv.ParseUint(s, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// stripComment removes the comment from the line. Semicolons in strings are
+// kept.
+func stripComment(line string) string {
+	quoted := false
+	for k := 0; k < len(line); k++ {
+		switch line[k] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:k]
+			}
+		}
+	}
+	return line
+}
+
+// cutLabel returns the label at the start of the line and the rest of it.
+func cutLabel(line string) (label, rest string, ok bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	k := strings.IndexByte(trimmed, ':')
+	if k <= 0 || !isIdentifier(trimmed[:k]) {
+		return "", line, false
+	}
+	return trimmed[:k], trimmed[k+1:], true
+}
+
+func isIdentifier(s string) bool {
+	for k := 0; k < len(s); k++ {
+		c := s[k]
+		switch {
+		case c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && k > 0:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isMnemonic(op string) bool {
+	for _, f := range forms {
+		if f.op == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Table returns labels and source lines of the program.
+func (p *Program) Table() *symbols.Table {
+	return symbols.FromMaps(p.Symbols, p.Lines)
+}
+
+// WriteSymbols writes labels and source lines in the symbol file format.
+func (p *Program) WriteSymbols(w io.Writer) error {
+	return p.Table().Write(w)
+}
@@ -0,0 +1,172 @@
+package asm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssembleInstructions(t *testing.T) {
+	testCases := map[string]struct {
+		src  string
+		want []byte
+	}{
+		"clear_screen":      {src: "CLS", want: []byte{0x00, 0xE0}},
+		"lower_case":        {src: "cls", want: []byte{0x00, 0xE0}},
+		"scroll_down":       {src: "SCD 4", want: []byte{0x00, 0xC4}},
+		"jump":              {src: "JP #2A4", want: []byte{0x12, 0xA4}},
+		"jump_v0":           {src: "JP V0, 0x300", want: []byte{0xB3, 0x00}},
+		"skip_equal_byte":   {src: "SE V1, #0F", want: []byte{0x31, 0x0F}},
+		"skip_equal_reg":    {src: "SE V1, V2", want: []byte{0x51, 0x20}},
+		"save_range":        {src: "SAVE V1, V3", want: []byte{0x51, 0x32}},
+		"load_byte":         {src: "LD VA, 255", want: []byte{0x6A, 0xFF}},
+		"load_negative":     {src: "LD VA, -1", want: []byte{0x6A, 0xFF}},
+		"load_register":     {src: "LD V1, V2", want: []byte{0x81, 0x20}},
+		"load_index":        {src: "LD I, #310", want: []byte{0xA3, 0x10}},
+		"load_long":         {src: "LD I, LONG #1234", want: []byte{0xF0, 0x00, 0x12, 0x34}},
+		"load_delay":        {src: "LD V3, DT", want: []byte{0xF3, 0x07}},
+		"wait_key":          {src: "LD V3, K", want: []byte{0xF3, 0x0A}},
+		"font":              {src: "LD F, V3", want: []byte{0xF3, 0x29}},
+		"store_registers":   {src: "LD [I], V3", want: []byte{0xF3, 0x55}},
+		"load_registers":    {src: "LD V3, [I]", want: []byte{0xF3, 0x65}},
+		"add_index":         {src: "ADD I, V3", want: []byte{0xF3, 0x1E}},
+		"add_registers":     {src: "ADD V1, V2", want: []byte{0x81, 0x24}},
+		"shift_left":        {src: "SHL V1, V2", want: []byte{0x81, 0x2E}},
+		"draw":              {src: "DRW V1, V2, 15", want: []byte{0xD1, 0x2F}},
+		"skip_not_pressed":  {src: "SKNP V3", want: []byte{0xE3, 0xA1}},
+		"plane":             {src: "PLANE 3", want: []byte{0xF3, 0x01}},
+		"binary_data":       {src: "DB 0b10000001, 2", want: []byte{0x81, 0x02}},
+		"words":             {src: "DW #1234, 5", want: []byte{0x12, 0x34, 0x00, 0x05}},
+		"comment_and_label": {src: "start: JP start ; loop forever", want: []byte{0x12, 0x00}},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p, err := Assemble("test.asm", []byte(test.src))
+			require.NoError(t, err)
+			assert.Equal(t, test.want, p.Code)
+		})
+	}
+}
+
+func TestAssembleLabels(t *testing.T) {
+	src := `
+	CALL sub
+	JP end
+sub:
+	LD I, data+1
+	RET
+	ORG #210
+data:	DB 1, 2
+end:	JP end
+`
+	p, err := Assemble("test.asm", []byte(src))
+	require.NoError(t, err)
+	code := []byte{
+		0x22, 0x04, 0x12, 0x12, 0xA2, 0x11, 0x00, 0xEE,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0x01, 0x02, 0x12, 0x12,
+	}
+	assert.Equal(t, code, p.Code)
+	assert.Equal(t, map[string]int{"sub": 0x204, "data": 0x210, "end": 0x212}, p.Symbols)
+
+	var b bytes.Buffer
+	require.NoError(t, p.WriteSymbols(&b))
+	want := `0200 source test.asm:2 CALL sub
+0202 source test.asm:3 JP end
+0204 label sub
+0204 source test.asm:5 LD I, data+1
+0206 source test.asm:6 RET
+0210 label data
+0210 source test.asm:8 DB 1, 2
+0212 label end
+0212 source test.asm:9 JP end
+`
+	assert.Equal(t, want, b.String())
+}
+
+func TestAssembleErrors(t *testing.T) {
+	testCases := map[string]struct {
+		src     string
+		wantErr string
+	}{
+		"unknown_instruction": {
+			src:     "CLS\nFOO V1",
+			wantErr: `test.asm:2: unknown instruction "FOO"`,
+		},
+		"invalid_operands": {
+			src:     "LD V1, V2, V3",
+			wantErr: "test.asm:1: invalid operands of LD: V1, V2, V3",
+		},
+		"undefined_label": {
+			src:     "\n\tJP nowhere",
+			wantErr: `test.asm:2: undefined label "nowhere"`,
+		},
+		"duplicate_label": {
+			src:     "a: CLS\na: CLS",
+			wantErr: `test.asm:2: label "a" is already defined`,
+		},
+		"reserved_label": {
+			src:     "V1: CLS",
+			wantErr: `test.asm:1: reserved label name "V1"`,
+		},
+		"out_of_range": {
+			src:     "LD V1, 256",
+			wantErr: "test.asm:1: value 256 out of range",
+		},
+		"org_below_start": {
+			src:     "ORG #100",
+			wantErr: "test.asm:1: address 0x100 is outside of the program",
+		},
+		"overlap": {
+			src:     "CLS\nORG #200\nRET",
+			wantErr: "test.asm:3: code overlaps at 0x200",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Assemble("test.asm", []byte(test.src))
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestAssembleInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sprites.asm"), []byte("sprite: DB #F0\nBAD"), 0644))
+	main := filepath.Join(dir, "main.asm")
+	require.NoError(t, ioutil.WriteFile(main, []byte("LD I, sprite\nINCLUDE \"sprites.asm\""), 0644))
+
+	_, err = AssembleFile(main)
+	assert.EqualError(t, err, filepath.Join(dir, "sprites.asm")+`:2: unknown instruction "BAD"`)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sprites.asm"), []byte("sprite: DB #F0"), 0644))
+	p, err := AssembleFile(main)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xA2, 0x02, 0xF0}, p.Code)
+}
+
+func TestDisassemblerRoundTrip(t *testing.T) {
+	rom := []byte{
+		0x00, 0xE0, 0x22, 0x0C, 0xA2, 0x14, 0x3F, 0x01,
+		0x12, 0x02, 0x00, 0xFD, 0x60, 0x05, 0xF0, 0x00,
+		0x02, 0x15, 0x00, 0xEE, 0xF0, 0x90, 0x90, 0xF0,
+		0x81, 0x28,
+	}
+	var src bytes.Buffer
+	_, err := disasm.Disassemble(rom, Origin).WriteTo(&src)
+	require.NoError(t, err)
+
+	p, err := Assemble("rom.asm", src.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, rom, p.Code)
+}
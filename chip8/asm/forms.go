@@ -0,0 +1,153 @@
+package asm
+
+import "strings"
+
+// form is a syntax of an instruction. Operands are described with:
+//
+//	x, y  register encoded at the X or Y position of the opcode
+//	n     4-bit number in the lowest nibble
+//	p     4-bit number at the X position
+//	b     8-bit number
+//	a     12-bit address
+//	l     16-bit address after LONG keyword, it follows the opcode
+//
+// Other operands are keywords matched literally.
+type form struct {
+	op     string
+	args   []string
+	opcode uint16
+}
+
+func f(op, args string, opcode uint16) form {
+	var a []string
+	if args != "" {
+		a = strings.Split(args, " ")
+	}
+	return form{op: op, args: a, opcode: opcode}
+}
+
+// size returns the size of the instruction in bytes.
+func (f form) size() int {
+	for _, a := range f.args {
+		if a == "l" {
+			return 4
+		}
+	}
+	return 2
+}
+
+var forms = []form{
+	f("CLS", "", 0x00E0),
+	f("RET", "", 0x00EE),
+	f("SCD", "n", 0x00C0),
+	f("SCU", "n", 0x00D0),
+	f("SCR", "", 0x00FB),
+	f("SCL", "", 0x00FC),
+	f("EXIT", "", 0x00FD),
+	f("LOW", "", 0x00FE),
+	f("HIGH", "", 0x00FF),
+	f("JP", "V0 a", 0xB000),
+	f("JP", "a", 0x1000),
+	f("CALL", "a", 0x2000),
+	f("SE", "x y", 0x5000),
+	f("SE", "x b", 0x3000),
+	f("SNE", "x y", 0x9000),
+	f("SNE", "x b", 0x4000),
+	f("SAVE", "x y", 0x5002),
+	f("LOAD", "x y", 0x5003),
+	f("LD", "x y", 0x8000),
+	f("LD", "x DT", 0xF007),
+	f("LD", "x K", 0xF00A),
+	f("LD", "x [I]", 0xF065),
+	f("LD", "x R", 0xF085),
+	f("LD", "x b", 0x6000),
+	f("LD", "I l", 0xF000),
+	f("LD", "I a", 0xA000),
+	f("LD", "DT x", 0xF015),
+	f("LD", "ST x", 0xF018),
+	f("LD", "F x", 0xF029),
+	f("LD", "HF x", 0xF030),
+	f("LD", "B x", 0xF033),
+	f("LD", "[I] x", 0xF055),
+	f("LD", "R x", 0xF075),
+	f("ADD", "I x", 0xF01E),
+	f("ADD", "x y", 0x8004),
+	f("ADD", "x b", 0x7000),
+	f("OR", "x y", 0x8001),
+	f("AND", "x y", 0x8002),
+	f("XOR", "x y", 0x8003),
+	f("SUB", "x y", 0x8005),
+	f("SHR", "x y", 0x8006),
+	f("SUBN", "x y", 0x8007),
+	f("SHL", "x y", 0x800E),
+	f("RND", "x b", 0xC000),
+	f("DRW", "x y n", 0xD000),
+	f("SKP", "x", 0xE09E),
+	f("SKNP", "x", 0xE0A1),
+	f("PLANE", "p", 0xF001),
+	f("AUDIO", "", 0xF002),
+	f("PITCH", "x", 0xF03A),
+}
+
+// keywords are operands which can not be used as labels.
+var keywords = map[string]bool{
+	"I": true, "[I]": true, "DT": true, "ST": true, "K": true, "F": true,
+	"HF": true, "B": true, "R": true, "LONG": true,
+}
+
+// register returns the number of Vx register.
+func register(s string) (int, bool) {
+	if len(s) != 2 || (s[0] != 'V' && s[0] != 'v') {
+		return 0, false
+	}
+	return hexDigit(s[1])
+}
+
+func hexDigit(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10, true
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10, true
+	}
+	return 0, false
+}
+
+// match returns true if operands have the syntax of the form.
+func (f form) match(args []string) bool {
+	if len(args) != len(f.args) {
+		return false
+	}
+	for k, spec := range f.args {
+		arg := args[k]
+		_, isReg := register(arg)
+		isKeyword := keywords[strings.ToUpper(arg)]
+		switch spec {
+		case "x", "y":
+			if !isReg {
+				return false
+			}
+		case "n", "p", "b", "a":
+			if isReg || isKeyword || hasLong(arg) {
+				return false
+			}
+		case "l":
+			if !hasLong(arg) {
+				return false
+			}
+		default:
+			if !strings.EqualFold(arg, spec) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasLong returns true if the operand starts with LONG keyword.
+func hasLong(arg string) bool {
+	fields := strings.Fields(arg)
+	return len(fields) == 2 && strings.EqualFold(fields[0], "LONG")
+}
@@ -0,0 +1,111 @@
+// Package audio implements sound output of CHIP-8 buzzer.
+package audio
+
+import "math"
+
+const (
+	// SampleRate is the default sample rate of generated audio in Hz.
+	SampleRate = 44100
+	// Frequency is the default frequency of the buzzer in Hz.
+	Frequency = 440
+
+	// frameRate is the rate at which sound timer is decremented.
+	frameRate = 60
+	// amplitude of generated samples.
+	amplitude = math.MaxInt16 / 4
+)
+
+// Audio defines interface of CHIP8 sound output.
+type Audio interface {
+	// SetPattern sets XO-CHIP audio pattern buffer and its pitch. The
+	// pattern is played instead of the square wave.
+	SetPattern(pattern []byte, pitch byte)
+	// Frame outputs sound for a single 60Hz frame. The buzzer sounds while
+	// active is true.
+	Frame(active bool)
+	// Close stops the output and flushes buffered data.
+	Close() error
+}
+
+// Generator generates samples of the buzzer. By default it produces a square
+// wave. When XO-CHIP pattern is set, bits of the pattern are played instead.
+type Generator struct {
+	sampleRate int
+	frequency  float64
+
+	pattern []byte
+	// rate is the playback rate of the pattern in bits per second.
+	rate float64
+	// phase is a position in the wave period or in the pattern.
+	phase float64
+	// frames counts generated frames to spread samples evenly.
+	frames int
+}
+
+// NewGenerator creates a square wave generator.
+func NewGenerator(sampleRate int, frequency float64) *Generator {
+	return &Generator{
+		sampleRate: sampleRate,
+		frequency:  frequency,
+	}
+}
+
+// SetPattern makes the generator play XO-CHIP pattern at given pitch.
+func (g *Generator) SetPattern(pattern []byte, pitch byte) {
+	g.pattern = append(g.pattern[:0], pattern...)
+	g.rate = 4000 * math.Pow(2, (float64(pitch)-64)/48)
+}
+
+// Frame returns samples for a single frame. Samples are silent when the
+// buzzer is not active.
+func (g *Generator) Frame(active bool) []int16 {
+	n := (g.frames+1)*g.sampleRate/frameRate - g.frames*g.sampleRate/frameRate
+	g.frames = (g.frames + 1) % frameRate
+
+	samples := make([]int16, n)
+	if !active {
+		g.phase = 0
+		return samples
+	}
+	for k := range samples {
+		samples[k] = g.next()
+	}
+	return samples
+}
+
+func (g *Generator) next() int16 {
+	if len(g.pattern) > 0 {
+		bits := len(g.pattern) * 8
+		bit := int(g.phase) % bits
+		g.phase += g.rate / float64(g.sampleRate)
+		if g.phase >= float64(bits) {
+			g.phase -= float64(bits)
+		}
+		if g.pattern[bit/8]>>(7-bit%8)&0x1 == 1 {
+			return amplitude
+		}
+		return -amplitude
+	}
+
+	sample := int16(-amplitude)
+	if g.phase < 0.5 {
+		sample = amplitude
+	}
+	g.phase += g.frequency / float64(g.sampleRate)
+	if g.phase >= 1 {
+		g.phase--
+	}
+	return sample
+}
+
+// Nop is an audio output which discards the sound.
+type Nop struct{}
+
+// SetPattern implements Audio interface.
+func (Nop) SetPattern(pattern []byte, pitch byte) {}
+
+// Frame implements Audio interface.
+func (Nop) Frame(active bool) {}
+
+// Close implements Audio interface.
+func (Nop) Close() error { return nil }
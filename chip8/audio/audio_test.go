@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorSquareWave(t *testing.T) {
+	g := NewGenerator(600, 150)
+	samples := g.Frame(true)
+	assert.Len(t, samples, 10)
+	// Period of the wave is 4 samples.
+	want := []int16{
+		amplitude, amplitude, -amplitude, -amplitude,
+		amplitude, amplitude, -amplitude, -amplitude,
+		amplitude, amplitude,
+	}
+	assert.Equal(t, want, samples)
+}
+
+func TestGeneratorSilenceWhenInactive(t *testing.T) {
+	g := NewGenerator(600, 100)
+	assert.Equal(t, make([]int16, 10), g.Frame(false))
+}
+
+func TestGeneratorSpreadsSamplesOverSecond(t *testing.T) {
+	g := NewGenerator(SampleRate, Frequency)
+	total := 0
+	for f := 0; f < frameRate; f++ {
+		total += len(g.Frame(true))
+	}
+	assert.Equal(t, SampleRate, total)
+}
+
+func TestGeneratorPattern(t *testing.T) {
+	// Pitch 64 plays 4000 bits per second.
+	g := NewGenerator(4000, Frequency)
+	g.SetPattern([]byte{0xF0, 0x0F}, 64)
+	samples := g.Frame(true)
+	want := []int16{
+		amplitude, amplitude, amplitude, amplitude,
+		-amplitude, -amplitude, -amplitude, -amplitude,
+		-amplitude, -amplitude, -amplitude, -amplitude,
+		amplitude, amplitude, amplitude, amplitude,
+	}
+	assert.Equal(t, want, samples[:16])
+	// Pattern is repeated.
+	assert.Equal(t, want, samples[16:32])
+}
+
+func TestBellRingsOnActivation(t *testing.T) {
+	var buf bytes.Buffer
+	b := NewBell(&buf)
+	b.Frame(false)
+	b.Frame(true)
+	b.Frame(true)
+	b.Frame(false)
+	b.Frame(true)
+	assert.Equal(t, "\a\a", buf.String())
+	assert.NoError(t, b.Close())
+}
@@ -0,0 +1,33 @@
+package audio
+
+import "io"
+
+// Bell is an audio output which rings the terminal bell when the buzzer is
+// activated. It is a fallback for terminal frontends which can not play
+// sound.
+type Bell struct {
+	w      io.Writer
+	active bool
+}
+
+// NewBell creates an audio output which writes bell character to w.
+func NewBell(w io.Writer) *Bell {
+	return &Bell{w: w}
+}
+
+// SetPattern implements Audio interface. Patterns can not be played by the
+// bell.
+func (b *Bell) SetPattern(pattern []byte, pitch byte) {}
+
+// Frame implements Audio interface.
+func (b *Bell) Frame(active bool) {
+	if active && !b.active {
+		b.w.Write([]byte("\a"))
+	}
+	b.active = active
+}
+
+// Close implements Audio interface.
+func (b *Bell) Close() error {
+	return nil
+}
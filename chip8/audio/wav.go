@@ -0,0 +1,120 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	wavHeaderSize    = 44
+	wavBitsPerSample = 16
+	wavChannels      = 1
+)
+
+// WAV writes the sound to a 16 bit mono PCM WAV stream.
+type WAV struct {
+	w   io.WriteSeeker
+	gen *Generator
+	// size is the number of bytes of written samples.
+	size int
+	// closer is closed together with the stream when it is owned by WAV.
+	closer io.Closer
+	// err is the first error of writing samples.
+	err error
+}
+
+// NewWAV creates an audio output which writes the sound to w. The header is
+// completed when the output is closed.
+func NewWAV(w io.WriteSeeker, sampleRate int) (*WAV, error) {
+	a := &WAV{
+		w:   w,
+		gen: NewGenerator(sampleRate, Frequency),
+	}
+	if err := a.writeHeader(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewWAVFile creates an audio output which writes the sound to a file at
+// path.
+func NewWAVFile(path string) (*WAV, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating wav file: %v", err)
+	}
+	a, err := NewWAV(f, SampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.closer = f
+	return a, nil
+}
+
+// SetPattern implements Audio interface.
+func (a *WAV) SetPattern(pattern []byte, pitch byte) {
+	a.gen.SetPattern(pattern, pitch)
+}
+
+// Frame implements Audio interface.
+func (a *WAV) Frame(active bool) {
+	samples := a.gen.Frame(active)
+	if a.err != nil {
+		return
+	}
+	if err := binary.Write(a.w, binary.LittleEndian, samples); err != nil {
+		a.err = fmt.Errorf("writing wav samples: %v", err)
+		return
+	}
+	a.size += len(samples) * wavBitsPerSample / 8
+}
+
+// Close completes the header with the size of written data.
+func (a *WAV) Close() error {
+	err := a.err
+	if err == nil {
+		err = a.finish()
+	}
+	if a.closer != nil {
+		if cerr := a.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (a *WAV) finish() error {
+	if _, err := a.w.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking wav header: %v", err)
+	}
+	return a.writeHeader()
+}
+
+func (a *WAV) writeHeader() error {
+	sampleRate := uint32(a.gen.sampleRate)
+	blockAlign := uint16(wavChannels * wavBitsPerSample / 8)
+	header := []interface{}{
+		[]byte("RIFF"),
+		uint32(wavHeaderSize - 8 + a.size),
+		[]byte("WAVE"),
+		[]byte("fmt "),
+		uint32(16),
+		uint16(1), // PCM
+		uint16(wavChannels),
+		sampleRate,
+		sampleRate * uint32(blockAlign),
+		blockAlign,
+		uint16(wavBitsPerSample),
+		[]byte("data"),
+		uint32(a.size),
+	}
+	for _, v := range header {
+		if err := binary.Write(a.w, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("writing wav header: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAVFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "out.wav")
+
+	a, err := NewWAVFile(path)
+	require.NoError(t, err)
+	a.Frame(true)
+	a.Frame(false)
+	require.NoError(t, a.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	dataSize := 2 * SampleRate / frameRate * 2
+	require.Len(t, b, wavHeaderSize+dataSize)
+
+	assert.Equal(t, "RIFF", string(b[0:4]))
+	assert.Equal(t, uint32(wavHeaderSize-8+dataSize), binary.LittleEndian.Uint32(b[4:8]))
+	assert.Equal(t, "WAVE", string(b[8:12]))
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(b[20:22]))
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(b[22:24]))
+	assert.Equal(t, uint32(SampleRate), binary.LittleEndian.Uint32(b[24:28]))
+	assert.Equal(t, uint16(16), binary.LittleEndian.Uint16(b[34:36]))
+	assert.Equal(t, "data", string(b[36:40]))
+	assert.Equal(t, uint32(dataSize), binary.LittleEndian.Uint32(b[40:44]))
+
+	// First frame is audible, second is silent.
+	first := int16(binary.LittleEndian.Uint16(b[wavHeaderSize:]))
+	last := int16(binary.LittleEndian.Uint16(b[len(b)-2:]))
+	assert.Equal(t, int16(amplitude), first)
+	assert.Equal(t, int16(0), last)
+}
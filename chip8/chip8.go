@@ -2,22 +2,98 @@ package chip8
 
 import (
 	"encoding/binary"
-	"flag"
 	"fmt"
-	"math/rand"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/Pawka/chip8-emulator/chip8/audio"
+	"github.com/Pawka/chip8-emulator/chip8/coverage"
 	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/Pawka/chip8-emulator/chip8/gdb"
+	"github.com/Pawka/chip8-emulator/chip8/profile"
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+	"github.com/Pawka/chip8-emulator/chip8/trace"
 )
 
 // Chip8 is and interface of CHIP-8 emulator.
 type Chip8 interface {
-	// Run executes provided rom.
-	Run(ctx Ctx)
+	// Run executes provided rom. It returns an error when the program can not
+	// be executed further.
+	Run(ctx Ctx) error
+	// Step executes given number of cycles of the rom without waiting for
+	// the real time. Timers are decremented according to the CPU speed.
+	Step(cycles int) error
+	// Display returns the display of the emulator. Use it with headless
+	// display to inspect the screen.
+	Display() display.Display
 }
 
 type chip8 struct {
 	display display.Display
+	audio   audio.Audio
+	// fb is the video memory. It is presented to the display once per frame.
+	fb     *framebuffer
+	quirks Quirks
+	sched  *scheduler
+	// path of the rom.
+	path string
+	// statePath is a path of the snapshot loaded at start.
+	statePath string
+	// slot is the selected save state slot.
+	slot int
+	// started is set when the rom is loaded to the memory.
+	started bool
+	// frameCycles is the number of cycles left in the current frame.
+	frameCycles int
+	// debug is set when the debugger panel is shown.
+	debug bool
+	dbg   *debugger
+	// rewind keeps states of previous frames.
+	rewind *rewinder
+	// seed of the random number generator.
+	seed int64
+	rng  rng
+	// frames is the number of frames executed and polls is the number of
+	// keyboard polls in the current frame. They index keys in movies.
+	frames, polls int
+	// record is the movie being recorded and replay is the movie being
+	// replayed. Paths are of the movie files.
+	record, replay         *movie
+	recordPath, replayPath string
+	// syms names addresses in disassembly, traces and crash reports. It is
+	// nil when no symbols are loaded.
+	syms        *symbols.Table
+	symbolsPath string
+	// cycles is the number of executed instructions.
+	cycles uint64
+	// tracer writes executed instructions to the trace file at tracePath. It
+	// is nil when tracing is disabled.
+	tracer      *tracer
+	tracePath   string
+	traceFormat trace.Format
+	traceFilter trace.Filter
+	// profile counts executed instructions when profiling is enabled. It is
+	// written to profilePath and reportPath on exit.
+	profile     *profile.Profile
+	profilePath string
+	reportPath  string
+	// coverage counts executed addresses. It is merged into the file at
+	// coveragePath on exit.
+	coverage     *coverage.Coverage
+	coveragePath string
+	// palette and imageScale define how screenshots and GIF frames are
+	// drawn. screenshotCycle is the cycle after which a screenshot is taken,
+	// zero disables it.
+	palette         display.Palette
+	imageScale      int
+	screenshotCycle uint64
+	// gif records every frame when gifPath is set.
+	gif     *display.GIF
+	gifPath string
+	// mu guards the state while a frame is executed, so it can be accessed
+	// by the GDB server.
+	mu sync.Mutex
 
 	ram *ram
 	// v is vector of registers. CHIP-8 has 16 8-bit data registers named V0 to
@@ -35,37 +111,121 @@ type chip8 struct {
 	// 16bit register (For memory address)
 	i int
 
+	// hires is set when SUPER-CHIP high resolution mode is enabled.
+	hires bool
+	// exited is set when the program exits with 00FD instruction.
+	exited bool
+	// flags are SUPER-CHIP RPL user flags saved with FX75.
+	flags [registersCount]byte
+
+	// plane is a bit mask of XO-CHIP bit planes selected for drawing.
+	plane byte
+	// pattern is XO-CHIP audio pattern buffer which is played while sound
+	// timer is active.
+	pattern [patternSize]byte
+	// pitch defines playback rate of the audio pattern.
+	pitch byte
+
+	// vblank is set when the vertical blank interrupt happens. It is used by
+	// DisplayWait quirk.
+	vblank bool
+
 	// Map key rune to byte value. Key values are from 0x0 to 0xF.
 	_keysMap map[rune]byte
 }
 
 const registersCount = 16
+const patternSize = 16
+const defaultPitch = 64
 const stackSize = 16
 const timerInitialValue = 60
 
+const (
+	screenWidth  = 64
+	screenHeight = 32
+
+	hiresScreenWidth  = 128
+	hiresScreenHeight = 64
+)
+
+// Positions of fonts in the memory.
+const (
+	fontOffset    = 0x0
+	fontSize      = 10
+	bigFontOffset = 0xA0
+	bigFontSize   = 10
+)
+
 // NewChip8 creates a new instance of emulator.
-func NewChip8(ctx Ctx) Chip8 {
-	var d display.Display
+func NewChip8(ctx Ctx) (Chip8, error) {
+	var d display.Display = display.NewHeadless()
+	var a audio.Audio = audio.Nop{}
 
-	// Do not initialize a new display during test run.
-	// Creating it breaks test output.
-	if ctx.IsDisplay() == true && flag.Lookup("test.v") == nil {
+	if ctx.IsDisplay() {
 		var err error
-		d, err = display.New()
+		d, err = display.New(display.Options{
+			Render:   ctx.render,
+			Scale:    ctx.scale,
+			Palette:  ctx.palette,
+			Graphics: ctx.graphics,
+		})
 		if err != nil {
-			// TODO: Return as error
-			panic(err)
+			return nil, err
 		}
+		a = audio.NewBell(os.Stdout)
+	}
+	if ctx.IsWeb() {
+		w, err := display.NewWeb(ctx.web, ctx.palette)
+		if err != nil {
+			return nil, err
+		}
+		d, a = w, w.Audio()
+	}
+
+	quirks := ctx.Quirks()
+	size := memorySize
+	if quirks.ExtendedMemory {
+		size = extendedMemorySize
+	}
+
+	seed := ctx.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
 
 	c := &chip8{
-		display:    d,
-		ram:        newRAM(),
-		v:          make([]byte, registersCount),
-		stack:      make([]uint16, 0, stackSize),
-		delayTimer: timerInitialValue,
-		soundTimer: timerInitialValue,
-		pc:         0x200,
+		display:         d,
+		audio:           a,
+		fb:              newFramebuffer(screenWidth, screenHeight),
+		quirks:          quirks,
+		sched:           newScheduler(ctx.cyclesPerSecond),
+		debug:           ctx.IsDebug(),
+		dbg:             newDebugger(ctx),
+		rewind:          newRewinder(ctx.rewindDepth, ctx.rewindMemory<<20),
+		path:            ctx.path,
+		statePath:       ctx.loadState,
+		recordPath:      ctx.record,
+		replayPath:      ctx.replay,
+		symbolsPath:     ctx.symbols,
+		tracePath:       ctx.trace,
+		traceFormat:     ctx.traceFormat,
+		traceFilter:     ctx.traceFilter,
+		profilePath:     ctx.profile,
+		reportPath:      ctx.profileReport,
+		coveragePath:    ctx.coverage,
+		palette:         ctx.palette,
+		imageScale:      ctx.imageScale,
+		screenshotCycle: ctx.screenshotCycle,
+		gifPath:         ctx.gif,
+		seed:            seed,
+		rng:             newRNG(seed),
+		ram:             newRAM(size),
+		v:               make([]byte, registersCount),
+		stack:           make([]uint16, 0, stackSize),
+		delayTimer:      timerInitialValue,
+		pc:              0x200,
+		plane:           0x1,
+		pitch:           defaultPitch,
 
 		_keysMap: map[rune]byte{
 			'1': 0x1,
@@ -87,7 +247,7 @@ func NewChip8(ctx Ctx) Chip8 {
 		},
 	}
 
-	return c
+	return c, nil
 }
 
 func (c *chip8) loadCharSprites(ram []byte) {
@@ -207,71 +367,505 @@ func (c *chip8) loadCharSprites(ram []byte) {
 	}
 
 	for p, val := range font {
-		copy(ram[p*10:], val)
+		copy(ram[fontOffset+int(p)*fontSize:], val)
+	}
+
+	// SUPER-CHIP 8x10 font. Letters come from XO-CHIP.
+	bigFont := [][]byte{
+		{0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C},
+		{0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C},
+		{0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF},
+		{0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C},
+		{0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06},
+		{0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C},
+		{0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C},
+		{0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60},
+		{0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C},
+		{0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C},
+		{0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3},
+		{0xFC, 0xFE, 0xC3, 0xC3, 0xFE, 0xFE, 0xC3, 0xC3, 0xFE, 0xFC},
+		{0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C},
+		{0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC},
+		{0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF},
+		{0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0},
+	}
+	for p, val := range bigFont {
+		copy(ram[bigFontOffset+p*bigFontSize:], val)
 	}
 }
 
+// width returns width of the screen in current resolution.
+func (c *chip8) width() int {
+	if c.hires {
+		return hiresScreenWidth
+	}
+	return screenWidth
+}
+
+// height returns height of the screen in current resolution.
+func (c *chip8) height() int {
+	if c.hires {
+		return hiresScreenHeight
+	}
+	return screenHeight
+}
+
+// planes returns the number of selected bit planes.
+func (c *chip8) planes() int {
+	n := 0
+	for p := c.plane; p > 0; p >>= 1 {
+		n += int(p & 0x1)
+	}
+	return n
+}
+
+// skip skips the next instruction. XO-CHIP F000 NNNN instruction is 4 bytes
+// long, so it is skipped entirely.
+func (c *chip8) skip() {
+	if int(c.pc)+2 <= len(c.ram.Memory) &&
+		binary.BigEndian.Uint16(c.ram.Memory[c.pc:c.pc+2]) == 0xF000 {
+		c.pc += 2
+	}
+	c.pc += 2
+}
+
+// saveRange stores registers from VX to VY in memory starting at I. Registers
+// are stored in reverse order when X is greater than Y.
+func (c *chip8) saveRange(x, y int) error {
+	n := x - y
+	if n < 0 {
+		n = -n
+	}
+	m, err := c.store(c.i, n+1)
+	if err != nil {
+		return err
+	}
+	for k := range m {
+		m[k] = c.v[x+k*rangeStep(x, y)]
+	}
+	return nil
+}
+
+// loadRange loads registers from VX to VY from memory starting at I.
+func (c *chip8) loadRange(x, y int) error {
+	n := x - y
+	if n < 0 {
+		n = -n
+	}
+	m, err := c.mem(c.i, n+1)
+	if err != nil {
+		return err
+	}
+	for k, val := range m {
+		c.v[x+k*rangeStep(x, y)] = val
+	}
+	return nil
+}
+
+func rangeStep(x, y int) int {
+	if x > y {
+		return -1
+	}
+	return 1
+}
+
+// boolToByte returns 1 for true, so conditions can be stored in VF.
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// setHighRes switches between low and high resolution modes.
+func (c *chip8) setHighRes(hires bool) {
+	c.hires = hires
+	c.fb.setResolution(c.width(), c.height())
+}
+
 // Run implements the interface
-func (c *chip8) Run(ctx Ctx) {
-	c.loadCharSprites(c.ram.Memory)
-	c.ram.Load(ctx.path)
+func (c *chip8) Run(ctx Ctx) error {
+	if err := c.start(); err != nil {
+		c.display.Close()
+		return err
+	}
 
 	if ctx.disassemble {
-		for pc := 0x200; pc < memorySize; pc = pc + 2 {
-			fmt.Println(c.disassemble(pc))
+		_, err := c.disassemble().WriteTo(os.Stdout)
+		return err
+	}
+
+	if ctx.wav != "" {
+		a, err := audio.NewWAVFile(ctx.wav)
+		if err != nil {
+			c.display.Close()
+			return err
 		}
-		return
+		c.audio = a
+	}
+	defer c.audio.Close()
+
+	var target *gdbTarget
+	if ctx.gdb != "" {
+		srv, err := gdb.Listen(ctx.gdb)
+		if err != nil {
+			c.display.Close()
+			return err
+		}
+		defer srv.Close()
+		target = newGDBTarget(c)
+		go srv.Serve(target)
 	}
 
 	quit := make(chan struct{})
-	if ctx.IsDisplay() {
-		go func() {
-			c.display.Show()
-			close(quit)
-		}()
-	} else {
+	go func() {
+		c.display.Show()
 		close(quit)
-	}
+	}()
 
-	c.pc = 0x200
+	ticker := c.sched.ticker()
+	defer ticker.Stop()
 
+	var err error
 loop:
-	for {
+	for !c.exited {
 		select {
 		case <-quit:
 			break loop
-		case <-time.After(time.Millisecond * 10):
-			c.exec(c.pc)
-			if c.delayTimer > 0 {
-				c.delayTimer--
+		case <-ticker.C:
+			c.mu.Lock()
+			err = c.frame(c.sched.next())
+			c.mu.Unlock()
+			if err != nil {
+				break loop
+			}
+			var done bool
+			if done, err = c.replayDone(); done {
+				break loop
+			}
+		}
+	}
+
+	if c.record != nil {
+		if serr := c.saveMovie(c.recordPath); err == nil {
+			err = serr
+		}
+	}
+	if terr := c.closeTrace(); err == nil {
+		err = terr
+	}
+	if perr := c.writeProfile(); err == nil {
+		err = perr
+	}
+	if c.coverage != nil {
+		if cerr := c.coverage.Save(c.coveragePath); err == nil {
+			err = cerr
+		}
+	}
+	if gerr := c.saveGIF(); err == nil {
+		err = gerr
+	}
+	if target != nil {
+		target.stop(err)
+	}
+	// Restore the terminal before the error is reported.
+	c.display.Close()
+	<-quit
+
+	return err
+}
+
+// Step implements the interface.
+func (c *chip8) Step(cycles int) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+
+	for cycles > 0 && !c.exited {
+		if c.frameCycles == 0 {
+			c.frameCycles = c.sched.next()
+		}
+		if c.frameCycles > 0 {
+			if !c.dbg.before(c) {
+				break
+			}
+			if err := c.step(); err != nil {
+				return err
 			}
+			c.dbg.after(c)
+			c.frameCycles--
+			cycles--
 		}
+		if c.frameCycles == 0 {
+			c.tick()
+		}
+	}
+	c.present()
+	if c.tracer != nil {
+		return c.tracer.w.Flush()
 	}
+	return nil
+}
+
+// Display implements the interface.
+func (c *chip8) Display() display.Display {
+	return c.display
 }
 
-func (c *chip8) exec(pc uint16) {
-	c.display.Debug(c.disassemble(int(pc)))
+// start loads fonts and the rom to the memory once.
+func (c *chip8) start() error {
+	if c.started {
+		return nil
+	}
+	c.loadCharSprites(c.ram.Memory)
+	if err := c.ram.Load(c.path); err != nil {
+		return err
+	}
+	c.pc = programStartPos
+	if err := c.loadSymbols(); err != nil {
+		return err
+	}
+	if c.statePath != "" {
+		if err := c.loadStateFile(c.statePath); err != nil {
+			return err
+		}
+	}
+	if err := c.startMovie(); err != nil {
+		return err
+	}
+	if err := c.startTrace(); err != nil {
+		return err
+	}
+	if c.profilePath != "" || c.reportPath != "" {
+		c.profile = profile.New(programStartPos)
+	}
+	if c.coveragePath != "" {
+		c.coverage = coverage.New(c.ram.romHash)
+	}
+	c.startGIF()
+	c.started = true
+	return nil
+}
+
+// frame executes given number of cycles and then ticks timers once. Timers
+// are stopped while the program is paused in the debugger.
+func (c *chip8) frame(cycles int) error {
+	c.commands()
+	if c.rewind.hold > 0 {
+		// Rewound frames are shown instead of executing the program.
+		c.rewind.hold--
+		c.rewindFrame()
+		c.present()
+		c.showDebug()
+		return nil
+	}
+	paused := c.dbg.paused
+	if !paused {
+		c.rewind.push(c.encodeState())
+	}
+	for n := 0; n < cycles && !c.exited; n++ {
+		if !c.dbg.before(c) {
+			break
+		}
+		if err := c.step(); err != nil {
+			return err
+		}
+		c.rewind.cycles++
+		c.dbg.after(c)
+	}
+	if paused {
+		c.present()
+	} else {
+		c.tick()
+	}
+	c.showDebug()
+	return nil
+}
+
+// step executes the instruction at PC and counts the cycle. Instructions
+// which fail are not traced.
+func (c *chip8) step() error {
+	pc := c.pc
+	t := c.tracer
+	if t != nil {
+		t.before(c, pc)
+	}
+	if c.profile != nil && int(pc)+2 <= len(c.ram.Memory) {
+		c.profile.Exec(pc, binary.BigEndian.Uint16(c.ram.Memory[pc:]))
+	}
+	if err := c.exec(pc); err != nil {
+		return err
+	}
+	c.cycles++
+	if c.coverage != nil {
+		c.coverage.Hit(int(pc))
+	}
+	if c.cycles == c.screenshotCycle {
+		if _, err := c.screenshot(); err != nil {
+			return err
+		}
+	}
+	if t != nil && t.active {
+		return t.after(c)
+	}
+	return nil
+}
+
+// commands executes commands issued by the user with hotkeys.
+func (c *chip8) commands() {
+	ctrl, ok := c.display.(display.Controller)
+	if !ok {
+		return
+	}
+	for cmd := ctrl.PollCommand(); cmd != display.CommandNone; cmd = ctrl.PollCommand() {
+		if c.movieCommand(cmd) {
+			c.display.Debug("Not available while a movie is recorded or replayed")
+			continue
+		}
+		switch cmd {
+		case display.CommandSaveState:
+			c.report(c.saveStateFile(c.slotPath()), "Saved slot %d", c.slot)
+		case display.CommandLoadState:
+			c.report(c.loadStateFile(c.slotPath()), "Loaded slot %d", c.slot)
+		case display.CommandPrevSlot:
+			c.slot = (c.slot + saveSlots - 1) % saveSlots
+			c.display.Debug(fmt.Sprintf("Slot %d", c.slot))
+		case display.CommandNextSlot:
+			c.slot = (c.slot + 1) % saveSlots
+			c.display.Debug(fmt.Sprintf("Slot %d", c.slot))
+		case display.CommandRewind:
+			c.rewind.hold = rewindHold
+		case display.CommandStepBack:
+			if c.dbg.paused {
+				c.stepBack()
+			}
+		case display.CommandScreenshot:
+			path, err := c.screenshot()
+			c.report(err, "Saved %s", path)
+		default:
+			if c.debug {
+				c.dbg.command(c, cmd)
+			}
+		}
+	}
+}
+
+// report shows the result of a command on the display.
+func (c *chip8) report(err error, format string, args ...interface{}) {
+	if err != nil {
+		c.display.Debug(err.Error())
+		return
+	}
+	c.display.Debug(fmt.Sprintf(format, args...))
+}
+
+// showDebug shows the state of the CPU in the debugger panel.
+func (c *chip8) showDebug() {
+	if panel, ok := c.display.(display.DebugPanel); c.debug && ok {
+		panel.ShowDebug(c.dbg.state(c))
+	}
+}
+
+// tick decrements timers and outputs sound of the frame. It is called at 60Hz.
+func (c *chip8) tick() {
+	c.audio.Frame(c.soundTimer > 0)
+	if c.delayTimer > 0 {
+		c.delayTimer--
+	}
+	if c.soundTimer > 0 {
+		c.soundTimer--
+	}
+	c.vblank = true
+	c.frames++
+	c.polls = 0
+	if c.gif != nil {
+		c.gif.Frame(c.fb.frame())
+	}
+	c.present()
+}
+
+// present sends the framebuffer to the display if it has changed.
+func (c *chip8) present() {
+	if !c.fb.dirty {
+		return
+	}
+	c.display.Present(c.fb.frame())
+	c.fb.dirty = false
+}
+
+// store returns n bytes of memory starting at addr to be written by the
+// instruction. Writes are reported to the debugger watchpoints.
+func (c *chip8) store(addr, n int) ([]byte, error) {
+	m, err := c.mem(addr, n)
+	if err != nil {
+		return nil, err
+	}
+	c.dbg.write(addr, n)
+	return m, nil
+}
+
+// mem returns n bytes of memory starting at addr.
+func (c *chip8) mem(addr, n int) ([]byte, error) {
+	if addr < 0 || addr+n > len(c.ram.Memory) {
+		return nil, fmt.Errorf("%w: %#04x", ErrMemoryOutOfBounds, addr)
+	}
+	return c.ram.Memory[addr : addr+n], nil
+}
+
+func (c *chip8) exec(pc uint16) error {
+	if int(pc)+2 > len(c.ram.Memory) {
+		return c.fault(pc, 0, ErrPCOutOfRange)
+	}
+	// Instructions executed again after a step back are not logged twice.
+	if !c.rewind.replaying {
+		c.display.Debug(c.line(int(pc)))
+	}
 	code := binary.BigEndian.Uint16(c.ram.Memory[pc : pc+2])
 	first := code & 0xF000 >> 12
 
 	switch first {
 	case 0x0:
-		switch code & 0x00FF {
-		case 0xE0:
+		switch {
+		case code&0xFFF0 == 0x00C0:
+			n := code & 0x000F
+			c.fb.scroll(0, int(n), c.plane)
+			c.pc += 2
+		case code&0xFFF0 == 0x00D0:
+			n := code & 0x000F
+			c.fb.scroll(0, -int(n), c.plane)
 			c.pc += 2
-			c.display.Clear()
-		case 0xEE:
+		case code == 0x00E0:
+			c.pc += 2
+			c.fb.clear(c.plane)
+		case code == 0x00EE:
+			if len(c.stack) == 0 {
+				return c.fault(pc, code, ErrStackUnderflow)
+			}
 			c.pc = c.stack[len(c.stack)-1]
 			c.stack = c.stack[:len(c.stack)-1]
+		case code == 0x00FB:
+			c.fb.scroll(4, 0, c.plane)
+			c.pc += 2
+		case code == 0x00FC:
+			c.fb.scroll(-4, 0, c.plane)
+			c.pc += 2
+		case code == 0x00FD:
+			c.exited = true
+		case code == 0x00FE:
+			c.setHighRes(false)
+			c.pc += 2
+		case code == 0x00FF:
+			c.setHighRes(true)
+			c.pc += 2
 		default:
-			panic("Not implemented")
+			return c.fault(pc, code, ErrUnknownOpcode)
 		}
 	case 0x1:
 		addr := code & 0x0FFF
 		c.pc = addr
 	case 0x2:
-		if len(c.stack) == stackSize-1 {
-			panic("Stack overflow")
+		if len(c.stack) == stackSize {
+			return c.fault(pc, code, ErrStackOverflow)
 		}
 		addr := code & 0x0FFF
 		c.stack = append(c.stack, c.pc+2)
@@ -281,21 +875,36 @@ func (c *chip8) exec(pc uint16) {
 		nn := code & 0x00FF
 		c.pc += 2
 		if uint8(nn) == c.v[vx] {
-			c.pc += 2
+			c.skip()
 		}
 	case 0x4:
 		vx := code & 0x0F00 >> 8
 		nn := code & 0x00FF
 		c.pc += 2
 		if uint8(nn) != c.v[vx] {
-			c.pc += 2
+			c.skip()
 		}
 	case 0x5:
 		vx := code & 0x0F00 >> 8
 		vy := code & 0x00F0 >> 4
-		c.pc += 2
-		if c.v[vy] == c.v[vx] {
+		switch code & 0x000F {
+		case 0x0:
 			c.pc += 2
+			if c.v[vy] == c.v[vx] {
+				c.skip()
+			}
+		case 0x2:
+			if err := c.saveRange(int(vx), int(vy)); err != nil {
+				return c.fault(pc, code, err)
+			}
+			c.pc += 2
+		case 0x3:
+			if err := c.loadRange(int(vx), int(vy)); err != nil {
+				return c.fault(pc, code, err)
+			}
+			c.pc += 2
+		default:
+			return c.fault(pc, code, ErrUnknownOpcode)
 		}
 	case 0x6:
 		vx := code & 0x0F00 >> 8
@@ -316,78 +925,98 @@ func (c *chip8) exec(pc uint16) {
 			c.v[vx] = c.v[vy]
 		case 0x1:
 			c.v[vx] = c.v[vx] | c.v[vy]
+			c.resetVF()
 		case 0x2:
 			c.v[vx] = c.v[vx] & c.v[vy]
+			c.resetVF()
 		case 0x3:
 			c.v[vx] = c.v[vx] ^ c.v[vy]
+			c.resetVF()
 		case 0x4:
+			// VF is written last, so the flag wins when X is F.
 			res := uint16(c.v[vx]) + uint16(c.v[vy])
-			c.v[0xF] = 0
-			if res > 0xFF {
-				c.v[0xF] = 1
-			}
-			c.v[vx] = c.v[vx] + c.v[vy]
+			c.v[vx] = byte(res)
+			c.v[0xF] = byte(res >> 8)
 		case 0x5:
-			c.v[0xF] = 0
-			// NOTE: Not sure if 0 should enable underoverflow flag.
-			if c.v[vx] < c.v[vy] {
-				c.v[0xF] = 1
-			}
+			// VF is set when there is no borrow.
+			flag := boolToByte(c.v[vx] >= c.v[vy])
 			c.v[vx] = c.v[vx] - c.v[vy]
+			c.v[0xF] = flag
 		case 0x6:
-			c.v[0xF] = c.v[vx] & 0x1
-			c.v[vx] = c.v[vy] >> 1
+			src := c.shiftSource(vx, vy)
+			c.v[vx] = src >> 1
+			c.v[0xF] = src & 0x1
 		case 0x7:
-			c.v[0xF] = 0
-			if c.v[vy] > c.v[vx] {
-				c.v[0xF] = 1
-			}
+			flag := boolToByte(c.v[vy] >= c.v[vx])
 			c.v[vx] = c.v[vy] - c.v[vx]
+			c.v[0xF] = flag
 		case 0xE:
-			c.v[0xF] = c.v[vx] >> 7
-			c.v[vx] = c.v[vy] << 1
+			src := c.shiftSource(vx, vy)
+			c.v[vx] = src << 1
+			c.v[0xF] = src >> 7
 		default:
-			panic("Not implemented")
+			return c.fault(pc, code, ErrUnknownOpcode)
 		}
 		c.pc += 2
 	case 0x9:
 		vx := code & 0x0F00 >> 8
 		vy := code & 0x00F0 >> 4
-		if vx != vy {
-			c.pc += 2
-		}
 		c.pc += 2
+		if c.v[vx] != c.v[vy] {
+			c.skip()
+		}
 	case 0xA:
 		addr := code & 0x0FFF
 		c.i = int(addr)
 		c.pc += 2
 	case 0xB:
 		addr := code & 0x0FFF
-		c.pc = addr + uint16(c.v[0])
+		if c.quirks.JumpVX {
+			vx := code & 0x0F00 >> 8
+			c.pc = addr + uint16(c.v[vx])
+		} else {
+			c.pc = addr + uint16(c.v[0])
+		}
 	case 0xC:
 		vx := code & 0x0F00 >> 8
 		last := code & 0x00FF
-		s := rand.NewSource(time.Now().UnixNano())
-		r := rand.New(s)
-		c.v[vx] = byte(r.Intn(256)) & byte(last)
+		c.v[vx] = c.rng.byte() & byte(last)
 		c.pc += 2
 	case 0xD:
-		// TODO: Implement I writing and XOR.
+		if c.quirks.DisplayWait {
+			if !c.vblank {
+				// Execute the instruction again on the next frame.
+				return nil
+			}
+			c.vblank = false
+		}
 		vx := code & 0x0F00 >> 8
 		vy := code & 0x00F0 >> 4
 		last := code & 0x000F
-		x := c.v[vx]
-		y := c.v[vy]
-		if true == c.display.Sprite(int(x), int(y), c.ram.Memory[c.i:c.i+int(last)]) {
+		x := int(c.v[vx]) % c.width()
+		y := int(c.v[vy]) % c.height()
+		size := int(last)
+		large := last == 0
+		if large {
+			// SUPER-CHIP draws 16x16 sprite when N is 0.
+			size = 32
+		}
+		// XO-CHIP reads sprite data for every selected plane.
+		payload, err := c.mem(c.i, size*c.planes())
+		if err != nil {
+			return c.fault(pc, code, err)
+		}
+		c.v[0xF] = 0
+		if true == c.drawSprite(x, y, payload, large) {
 			c.v[0xF] = 1
 		}
 		c.pc += 2
 	case 0xE:
 		// Collect keys pressed during the cycle.
 		pressed := make(map[byte]bool)
-		for key := c.display.PollKey(); key != nil; key = c.display.PollKey() {
+		for key := c.pollKey(); key != nil; key = c.pollKey() {
 			pressed[c._keysMap[*key]] = true
-			if _, ok := c._keysMap[*key]; ok {
+			if _, ok := c._keysMap[*key]; ok && !c.rewind.replaying {
 				c.display.Debug(fmt.Sprintf("Key: %#v", c._keysMap[*key]))
 			}
 		}
@@ -396,25 +1025,53 @@ func (c *chip8) exec(pc uint16) {
 		end := code & 0x00FF
 		switch end {
 		case 0x9E:
+			c.pc += 2
 			if pressed[c.v[vx]] == true {
-				c.pc += 2
+				c.skip()
 			}
 		case 0xA1:
+			c.pc += 2
 			if pressed[c.v[vx]] != true {
-				c.pc += 2
+				c.skip()
 			}
 		default:
-			panic("Not implemented")
+			return c.fault(pc, code, ErrUnknownOpcode)
 		}
-		c.pc += 2
 	case 0xF:
 		vx := code & 0x0F00 >> 8
 		end := code & 0x00FF
 		switch end {
+		case 0x00:
+			if vx != 0 {
+				return c.fault(pc, code, ErrUnknownOpcode)
+			}
+			// F000 NNNN loads 16 bit address from the next word.
+			m, err := c.mem(int(pc)+2, 2)
+			if err != nil {
+				return c.fault(pc, code, err)
+			}
+			c.i = int(binary.BigEndian.Uint16(m))
+			c.pc += 2
+		case 0x01:
+			c.plane = byte(vx) & 0x3
+		case 0x02:
+			if vx != 0 {
+				return c.fault(pc, code, ErrUnknownOpcode)
+			}
+			m, err := c.mem(c.i, patternSize)
+			if err != nil {
+				return c.fault(pc, code, err)
+			}
+			copy(c.pattern[:], m)
+			c.audio.SetPattern(c.pattern[:], c.pitch)
 		case 0x07:
 			c.v[vx] = c.delayTimer
 		case 0x0A:
-			key := c.display.PollKey()
+			key := c.pollKey()
+			if key == nil {
+				// Execute the instruction again until a key is pressed.
+				return nil
+			}
 			c.v[vx] = c._keysMap[*key]
 		case 0x15:
 			c.delayTimer = c.v[vx]
@@ -424,147 +1081,87 @@ func (c *chip8) exec(pc uint16) {
 			// NOTE: It is possible range overflow should be handled.
 			c.i += int(c.v[vx])
 			c.v[0xF] = 0
-			if c.i > memorySize-1 {
+			if c.i > len(c.ram.Memory)-1 {
 				c.v[0xF] = 1
 			}
 		case 0x29:
-			c.i = int(vx) * 10
+			c.i = fontOffset + int(c.v[vx]&0xF)*fontSize
+		case 0x30:
+			c.i = bigFontOffset + int(c.v[vx]&0xF)*bigFontSize
+		case 0x3A:
+			c.pitch = c.v[vx]
+			c.audio.SetPattern(c.pattern[:], c.pitch)
 		case 0x33:
+			m, err := c.store(c.i, 3)
+			if err != nil {
+				return c.fault(pc, code, err)
+			}
 			val := c.v[vx]
-			c.ram.Memory[c.i] = val / 100
-			c.ram.Memory[c.i+1] = val % 100 / 10
-			c.ram.Memory[c.i+2] = val % 10
+			m[0] = val / 100
+			m[1] = val % 100 / 10
+			m[2] = val % 10
 		case 0x55:
-			for i := 0; i <= int(vx); i++ {
-				c.ram.Memory[c.i+i] = c.v[i]
+			m, err := c.store(c.i, int(vx)+1)
+			if err != nil {
+				return c.fault(pc, code, err)
 			}
+			copy(m, c.v[:vx+1])
+			c.incrementI(int(vx))
 		case 0x65:
-			for i := 0; i <= int(vx); i++ {
-				c.v[i] = c.ram.Memory[c.i+i]
+			m, err := c.mem(c.i, int(vx)+1)
+			if err != nil {
+				return c.fault(pc, code, err)
 			}
+			copy(c.v, m)
+			c.incrementI(int(vx))
+		case 0x75:
+			copy(c.flags[:], c.v[:vx+1])
+		case 0x85:
+			copy(c.v, c.flags[:vx+1])
 		default:
-			panic("Not implemented")
+			return c.fault(pc, code, ErrUnknownOpcode)
 		}
 		c.pc += 2
 	default:
-		panic("Not implemented")
+		return c.fault(pc, code, ErrUnknownOpcode)
 	}
-}
 
-func (c *chip8) disassemble(pc int) string {
-	code := binary.BigEndian.Uint16(c.ram.Memory[pc : pc+2])
-	first := code & 0xF000 >> 12
+	return nil
+}
 
-	var expl string
-	switch first {
-	case 0x0:
-		switch code & 0x00FF {
-		case 0xEE:
-			expl = "return;"
-		case 0xE0:
-			expl = "disp_clear();"
-		}
-	case 0x1:
-		addr := code & 0x0FFF
-		expl = fmt.Sprintf("JMP #%x", addr)
-	case 0x2:
-		addr := code & 0x0FFF
-		expl = fmt.Sprintf("CALL #%x", addr)
-	case 0x3:
-		vx := code & 0x0F00 >> 8
-		nn := code & 0x00FF
-		expl = fmt.Sprintf("SE V%X, %X", vx, nn)
-	case 0x4:
-		vx := code & 0x0F00 >> 8
-		nn := code & 0x00FF
-		expl = fmt.Sprintf("SNE V%X, %X", vx, nn)
-	case 0x5:
-		vx := code & 0x0F00 >> 8
-		vy := code & 0x00F0 >> 4
-		expl = fmt.Sprintf("SE V%X, V%X", vx, vy)
-	case 0x6:
-		vx := code & 0x0F00 >> 8
-		nn := code & 0x00FF
-		expl = fmt.Sprintf("LD V%X, %X", vx, nn)
-	case 0x7:
-		vx := code & 0x0F00 >> 8
-		nn := code & 0x00FF
-		expl = fmt.Sprintf("ADD V%X, %X", vx, nn)
-	case 0x8:
-		vx := code & 0x0F00 >> 8
-		vy := code & 0x00F0 >> 4
-		last := code & 0x000F
-		switch last {
-		case 0x0:
-			expl = fmt.Sprintf("SUB V%X, V%X", vx, vy)
-		case 0x6:
-			expl = fmt.Sprintf("SHR V%X, V%X", vx, vy)
-		case 0x7:
-			expl = fmt.Sprintf("SUBN V%X, V%X", vx, vy)
-		case 0xE:
-			expl = fmt.Sprintf("SHL V%X, V%X", vx, vy)
-		default:
-			expl = fmt.Sprintf("> %X", first)
-		}
-	case 0x9:
-		vx := code & 0x0F00 >> 8
-		vy := code & 0x00F0 >> 4
-		expl = fmt.Sprintf("SNE V%X, V%X", vx, vy)
-	case 0xA:
-		addr := code & 0x0FFF
-		expl = fmt.Sprintf("LD I, #%x", addr)
-	case 0xB:
-		addr := code & 0x0FFF
-		expl = fmt.Sprintf("JMP V0, #%x", addr)
-	case 0xC:
-		vx := code & 0x0F00 >> 8
-		nn := code & 0x00FF
-		expl = fmt.Sprintf("RND V%X, %X", vx, nn)
-	case 0xD:
-		vx := code & 0x0F00 >> 8
-		vy := code & 0x00F0 >> 4
-		n := code & 0x000F
-		expl = fmt.Sprintf("DRV V%X, V%X, %X", vx, vy, n)
-	case 0xE:
-		vx := code & 0x0F00 >> 8
-		last := code & 0x00FF
-		switch last {
-		case 0x9E:
-			expl = fmt.Sprintf("SKP V%X", vx)
-		case 0xA1:
-			expl = fmt.Sprintf("SKPN V%X", vx)
-		}
-	case 0xF:
-		vx := code & 0x0F00 >> 8
-		last := code & 0x00FF
-		switch last {
-		case 0x07:
-			expl = fmt.Sprintf("LD V%X, DT", vx)
-		case 0x0A:
-			expl = fmt.Sprintf("LD V%X, KEY", vx)
-		case 0x15:
-			expl = fmt.Sprintf("LD DT, V%X", vx)
-		case 0x18:
-			expl = fmt.Sprintf("LD ST V%X", vx)
-		case 0x1E:
-			expl = fmt.Sprintf("ADD I, V%X", vx)
-		case 0x29:
-			expl = fmt.Sprintf("LD I, FONT(V%X)", vx)
-		case 0x33:
-			expl = fmt.Sprintf("BCD V%X", vx)
-		case 0x55:
-			expl = fmt.Sprintf("LD [I], V%X", vx)
-		case 0x65:
-			expl = fmt.Sprintf("LD V%X, [I]", vx)
-		}
+// resetVF resets VF after logic operations when VFReset quirk is enabled.
+func (c *chip8) resetVF() {
+	if c.quirks.VFReset {
+		c.v[0xF] = 0
+	}
+}
 
-	default:
-		expl = fmt.Sprintf("> %X", first)
+// shiftSource returns the value of register which has to be shifted.
+func (c *chip8) shiftSource(vx, vy uint16) byte {
+	if c.quirks.ShiftVX {
+		return c.v[vx]
 	}
+	return c.v[vy]
+}
 
-	if code != 0x0 {
-		return fmt.Sprintf("%04x\t%04X\t%s\n", pc, code, expl)
+// incrementI changes I after FX55 and FX65 according to LoadStore quirk.
+func (c *chip8) incrementI(x int) {
+	switch c.quirks.LoadStore {
+	case IncrementX:
+		c.i += x
+	case IncrementXPlusOne:
+		c.i += x + 1
 	}
+}
 
-	return ""
+// drawSprite draws the sprite at x, y on selected planes. Payload holds
+// sprite data for every selected plane. Large sprites are 16x16 pixels. When
+// Wrap quirk is enabled, parts of the sprite which do not fit on the screen
+// are drawn at the opposite edges.
+func (c *chip8) drawSprite(x, y int, payload []byte, large bool) bool {
+	spriteWidth := 8
+	if large {
+		spriteWidth = 16
+	}
+	return c.fb.sprite(x, y, spriteWidth, payload, c.plane, c.quirks.Wrap)
 }
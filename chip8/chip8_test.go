@@ -1,15 +1,20 @@
 package chip8
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/Pawka/chip8-emulator/chip8/octo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type displayMock struct {
-	clear, show, point, sprite, pollkey bool
-	x, y                                int
-	payload                             []byte
+	show, close bool
+	// Frames passed to Present.
+	frames []display.Frame
 	// Keys to be returned by PollKey method
 	keys []*rune
 }
@@ -18,23 +23,12 @@ func (d *displayMock) Show() {
 	d.show = true
 }
 
-func (d *displayMock) Point(x int, y int) bool {
-	d.point = true
-	d.x = x
-	d.y = y
-	return false
+func (d *displayMock) Close() {
+	d.close = true
 }
 
-func (d *displayMock) Sprite(x int, y int, payload []byte) bool {
-	d.sprite = true
-	d.x = x
-	d.y = y
-	d.payload = payload
-	return true
-}
-
-func (d *displayMock) Clear() {
-	d.clear = true
+func (d *displayMock) Present(f display.Frame) {
+	d.frames = append(d.frames, f)
 }
 
 func (d *displayMock) Debug(line string) {
@@ -50,6 +44,14 @@ func (d *displayMock) PollKey() *rune {
 	return val
 }
 
+// newTestChip8 creates emulator with headless display.
+func newTestChip8(t *testing.T, ctx Ctx) *chip8 {
+	ctx.headless = true
+	c, err := NewChip8(ctx)
+	require.NoError(t, err)
+	return c.(*chip8)
+}
+
 func TestExec(t *testing.T) {
 	testCases := map[string]struct {
 		opcode uint16
@@ -60,10 +62,13 @@ func TestExec(t *testing.T) {
 		"clear_display": {
 			opcode: 0x00E0,
 			setup: func(ch *chip8) {
-				ch.display = &displayMock{}
+				ch.plane = 0x1
+				ch.fb.pixels[0] = 0x3
+				ch.fb.pixels[5] = 0x1
 			},
 			assert: func(t *testing.T, ch *chip8) {
-				assert.True(t, ch.display.(*displayMock).clear)
+				assert.Equal(t, byte(0x2), ch.fb.pixel(0, 0))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(5, 0))
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
 		},
@@ -78,6 +83,85 @@ func TestExec(t *testing.T) {
 				assert.Equal(t, uint16(0x260), ch.pc)
 			},
 		},
+		// 00CN
+		"scroll_down": {
+			opcode: 0x00C5,
+			setup: func(ch *chip8) {
+				ch.fb.pixels[0] = 0x1
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x0), ch.fb.pixel(0, 0))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(0, 5))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// 00DN
+		"scroll_up": {
+			opcode: 0x00D3,
+			setup: func(ch *chip8) {
+				ch.fb.pixels[3*screenWidth] = 0x1
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x0), ch.fb.pixel(0, 3))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(0, 0))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// 00FB
+		"scroll_right": {
+			opcode: 0x00FB,
+			setup: func(ch *chip8) {
+				ch.fb.pixels[0] = 0x1
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x0), ch.fb.pixel(0, 0))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(4, 0))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// 00FC
+		"scroll_left": {
+			opcode: 0x00FC,
+			setup: func(ch *chip8) {
+				ch.fb.pixels[4] = 0x1
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x0), ch.fb.pixel(4, 0))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(0, 0))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// 00FD
+		"exit": {
+			opcode: 0x00FD,
+			assert: func(t *testing.T, ch *chip8) {
+				assert.True(t, ch.exited)
+				assert.Equal(t, uint16(0x200), ch.pc)
+			},
+		},
+		// 00FE
+		"low_resolution": {
+			opcode: 0x00FE,
+			setup: func(ch *chip8) {
+				ch.setHighRes(true)
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.False(t, ch.hires)
+				assert.Equal(t, 64, ch.fb.width)
+				assert.Equal(t, 32, ch.fb.height)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// 00FF
+		"high_resolution": {
+			opcode: 0x00FF,
+			assert: func(t *testing.T, ch *chip8) {
+				assert.True(t, ch.hires)
+				assert.Equal(t, 128, ch.fb.width)
+				assert.Equal(t, 64, ch.fb.height)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
 		// 1NNN
 		"jmp": {
 			opcode: 0x12EE,
@@ -146,6 +230,56 @@ func TestExec(t *testing.T) {
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
 		},
+		"skip_if_registers_equal_skips_long_instruction": {
+			opcode: 0x5540,
+			setup: func(ch *chip8) {
+				ch.ram.Memory[0x202] = 0xF0
+				ch.ram.Memory[0x203] = 0x00
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint16(0x206), ch.pc)
+			},
+		},
+		// 5XY2
+		"save_vx_to_vy_range": {
+			opcode: 0x5132,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				ch.v[1] = 0x11
+				ch.v[2] = 0x12
+				ch.v[3] = 0x13
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, []byte{0x11, 0x12, 0x13, 0}, ch.ram.Memory[0x300:0x304])
+				assert.Equal(t, 0x300, ch.i)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		"save_vx_to_vy_range_in_reverse_order": {
+			opcode: 0x5312,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				ch.v[1] = 0x11
+				ch.v[2] = 0x12
+				ch.v[3] = 0x13
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, []byte{0x13, 0x12, 0x11, 0}, ch.ram.Memory[0x300:0x304])
+			},
+		},
+		// 5XY3
+		"load_vx_to_vy_range": {
+			opcode: 0x5233,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0x12, 0x13})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, []byte{0, 0, 0x12, 0x13, 0}, ch.v[:5])
+				assert.Equal(t, 0x300, ch.i)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
 		// 6XNN
 		"set_nn_value_to_x": {
 			opcode: 0x6540,
@@ -254,12 +388,12 @@ func TestExec(t *testing.T) {
 		"substract_nn_value_from_x_with_overflow_flag_set_to_0": {
 			opcode: 0x8235,
 			setup: func(ch *chip8) {
-				ch.v[2] = 0x2
-				ch.v[3] = 0x1
+				ch.v[2] = 0x1
+				ch.v[3] = 0x2
 				ch.v[0xF] = 0xFF
 			},
 			assert: func(t *testing.T, ch *chip8) {
-				assert.Equal(t, uint8(0x1), ch.v[2])
+				assert.Equal(t, uint8(0xFF), ch.v[2])
 				assert.Equal(t, uint8(0x0), ch.v[0xF])
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
@@ -267,21 +401,60 @@ func TestExec(t *testing.T) {
 		"substract_nn_value_from_x_with_overflow_flag_set_to_1": {
 			opcode: 0x8235,
 			setup: func(ch *chip8) {
-				ch.v[2] = 0x1
+				ch.v[2] = 0x2
 				ch.v[3] = 0x2
 				ch.v[0xF] = 0xFF
 			},
 			assert: func(t *testing.T, ch *chip8) {
-				assert.Equal(t, uint8(0xFF), ch.v[2])
+				assert.Equal(t, uint8(0x0), ch.v[2])
 				assert.Equal(t, uint8(0x1), ch.v[0xF])
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
 		},
+		"substract_from_vf_keeps_flag": {
+			opcode: 0x8F35,
+			setup: func(ch *chip8) {
+				ch.v[3] = 0x5
+				ch.v[0xF] = 0x3
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		"substract_vf_from_vy_keeps_flag": {
+			opcode: 0x8F37,
+			setup: func(ch *chip8) {
+				ch.v[3] = 0x5
+				ch.v[0xF] = 0x3
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x1), ch.v[0xF])
+			},
+		},
+		"add_to_vf_keeps_carry": {
+			opcode: 0x8F34,
+			setup: func(ch *chip8) {
+				ch.v[3] = 0x20
+				ch.v[0xF] = 0x10
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		"right_shift_to_vf_keeps_flag": {
+			opcode: 0x8F36,
+			setup: func(ch *chip8) {
+				ch.v[3] = 0x6
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
 		"right_shift_with_vf_set_to_0": {
 			opcode: 0x8236,
 			setup: func(ch *chip8) {
-				ch.v[2] = 0x4
-				ch.v[3] = 0x5
+				ch.v[2] = 0x5
+				ch.v[3] = 0x4
 				ch.v[0xF] = 0xFF
 			},
 			assert: func(t *testing.T, ch *chip8) {
@@ -319,12 +492,12 @@ func TestExec(t *testing.T) {
 		"set_vx_equal_vy_minus_xy_when_vx_is_not_less_than_vy": {
 			opcode: 0x8237,
 			setup: func(ch *chip8) {
-				ch.v[2] = 0x4
+				ch.v[2] = 0x5
 				ch.v[3] = 0x4
 				ch.v[0xF] = 0xFF
 			},
 			assert: func(t *testing.T, ch *chip8) {
-				assert.Equal(t, uint8(0x0), ch.v[2])
+				assert.Equal(t, uint8(0xFF), ch.v[2])
 				assert.Equal(t, uint8(0x0), ch.v[0xF])
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
@@ -345,8 +518,8 @@ func TestExec(t *testing.T) {
 		"left_shift_with_vf_set_to_1": {
 			opcode: 0x823E,
 			setup: func(ch *chip8) {
-				ch.v[2] = 0xFF
-				ch.v[3] = 0x8
+				ch.v[2] = 0x0
+				ch.v[3] = 0x88
 				ch.v[0xF] = 0xFF
 			},
 			assert: func(t *testing.T, ch *chip8) {
@@ -405,7 +578,6 @@ func TestExec(t *testing.T) {
 		"draw_a_sprite": {
 			opcode: 0xD123,
 			setup: func(ch *chip8) {
-				ch.display = &displayMock{}
 				ch.v[1] = 10
 				ch.v[2] = 20
 				ch.i = 0x300
@@ -413,13 +585,60 @@ func TestExec(t *testing.T) {
 				ch.ram.Memory[0x301] = 0x3
 				ch.ram.Memory[0x302] = 0x4
 				ch.ram.Memory[0x303] = 0x5
+				ch.fb.pixels[21*screenWidth+17] = 0x1
 			},
 			assert: func(t *testing.T, ch *chip8) {
-				assert.True(t, ch.display.(*displayMock).sprite)
 				assert.Equal(t, byte(1), ch.v[0xF])
-				assert.Equal(t, 10, ch.display.(*displayMock).x)
-				assert.Equal(t, 20, ch.display.(*displayMock).y)
-				assert.Equal(t, []byte{0x2, 0x3, 0x4}, ch.display.(*displayMock).payload)
+				assert.Equal(t, byte(0x1), ch.fb.pixel(16, 20))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(16, 21))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(17, 21))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(15, 22))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(15, 23))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// DXY0
+		"draw_a_large_sprite": {
+			opcode: 0xD120,
+			setup: func(ch *chip8) {
+				ch.setHighRes(true)
+				ch.v[1] = 100
+				ch.v[2] = 70
+				ch.i = 0x300
+				ch.ram.Memory[0x300] = 0x80
+				ch.ram.Memory[0x31F] = 0x01
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0), ch.v[0xF])
+				assert.Equal(t, byte(0x1), ch.fb.pixel(100, 6))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(115, 21))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(115, 22))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		"draw_a_sprite_on_both_planes": {
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.plane = 0x3
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0x80, 0xC0, 0xC0, 0x00})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x3), ch.fb.pixel(0, 0))
+				assert.Equal(t, byte(0x2), ch.fb.pixel(1, 0))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(0, 1))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(1, 1))
+			},
+		},
+		"do_not_draw_a_sprite_without_planes": {
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.plane = 0x0
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0xFF, 0xFF})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, make([]byte, len(ch.fb.pixels)), ch.fb.pixels)
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
 		},
@@ -479,6 +698,55 @@ func TestExec(t *testing.T) {
 				assert.Equal(t, uint16(0x202), ch.pc)
 			},
 		},
+		// F000 NNNN
+		"set_i_to_long_address": {
+			opcode: 0xF000,
+			setup: func(ch *chip8) {
+				ch.ram = newRAM(extendedMemorySize)
+				ch.ram.Memory[0x200] = 0xF0
+				ch.ram.Memory[0x202] = 0xAB
+				ch.ram.Memory[0x203] = 0xCD
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, 0xABCD, ch.i)
+				assert.Equal(t, uint16(0x204), ch.pc)
+			},
+		},
+		// FN01
+		"select_planes": {
+			opcode: 0xF201,
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x2), ch.plane)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// F002
+		"load_audio_pattern": {
+			opcode: 0xF002,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				for k := 0; k < patternSize; k++ {
+					ch.ram.Memory[0x300+k] = byte(k)
+				}
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0xF), ch.pattern[patternSize-1])
+				assert.Equal(t, ch.pattern[:], ch.audio.(*audioMock).pattern)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// FX3A
+		"set_pitch": {
+			opcode: 0xF33A,
+			setup: func(ch *chip8) {
+				ch.v[3] = 0x70
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x70), ch.pitch)
+				assert.Equal(t, byte(0x70), ch.audio.(*audioMock).pitch)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
 		// FX07
 		"set_delay_timer_value_to_vx": {
 			opcode: 0xF407,
@@ -558,11 +826,25 @@ func TestExec(t *testing.T) {
 		// FX29
 		"point_i_to_font_position": {
 			opcode: 0xF429,
+			setup: func(ch *chip8) {
+				ch.v[0x4] = 4
+			},
 			assert: func(t *testing.T, ch *chip8) {
 				assert.Equal(t, uint16(0x202), ch.pc)
 				assert.Equal(t, 40, ch.i)
 			},
 		},
+		// FX30
+		"point_i_to_big_font_position": {
+			opcode: 0xF430,
+			setup: func(ch *chip8) {
+				ch.v[0x4] = 2
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint16(0x202), ch.pc)
+				assert.Equal(t, bigFontOffset+20, ch.i)
+			},
+		},
 		// FX33
 		"store_decimal_at_vx_to_i": {
 			opcode: 0xF433,
@@ -595,6 +877,31 @@ func TestExec(t *testing.T) {
 				assert.Equal(t, 2, ch.i)
 			},
 		},
+		// FX75
+		"save_v0_to_vx_to_flags": {
+			opcode: 0xF275,
+			setup: func(ch *chip8) {
+				ch.v[0x0] = 0x10
+				ch.v[0x1] = 0x11
+				ch.v[0x2] = 0x12
+				ch.v[0x3] = 0x13
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, []byte{0x10, 0x11, 0x12, 0}, ch.flags[:4])
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		// FX85
+		"load_v0_to_vx_from_flags": {
+			opcode: 0xF285,
+			setup: func(ch *chip8) {
+				copy(ch.flags[:], []byte{0x10, 0x11, 0x12, 0x13})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, []byte{0x10, 0x11, 0x12, 0}, ch.v[:4])
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
 		// FX65
 		"fill_v0_to_vx_registers_from_memory": {
 			opcode: 0xF465,
@@ -617,16 +924,516 @@ func TestExec(t *testing.T) {
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
 			ctx := Ctx{}
-			chip8 := NewChip8(ctx).(*chip8)
+			chip8 := newTestChip8(t, ctx)
 			a := (test.opcode & 0xFF00) >> 8
 			b := test.opcode & 0x00FF
 			chip8.ram.Memory[0x200] = uint8(a)
 			chip8.ram.Memory[0x200+1] = uint8(b)
+			chip8.display = &displayMock{}
+			chip8.audio = &audioMock{}
 			if test.setup != nil {
 				test.setup(chip8)
 			}
-			chip8.exec(programStartPos)
+			require.NoError(t, chip8.exec(programStartPos))
 			test.assert(t, chip8)
 		})
 	}
 }
+
+func TestExecErrors(t *testing.T) {
+	testCases := map[string]struct {
+		opcode uint16
+		setup  func(ch *chip8)
+		want   error
+	}{
+		"unknown_machine_code_routine": {
+			opcode: 0x0123,
+			want:   ErrUnknownOpcode,
+		},
+		"unknown_arithmetic_operation": {
+			opcode: 0x8128,
+			want:   ErrUnknownOpcode,
+		},
+		"unknown_key_operation": {
+			opcode: 0xE1FF,
+			want:   ErrUnknownOpcode,
+		},
+		"unknown_misc_operation": {
+			opcode: 0xF1FF,
+			want:   ErrUnknownOpcode,
+		},
+		"call_with_full_stack": {
+			opcode: 0x2300,
+			setup: func(ch *chip8) {
+				for i := 0; i < stackSize; i++ {
+					ch.stack = append(ch.stack, 0x200)
+				}
+			},
+			want: ErrStackOverflow,
+		},
+		"return_with_empty_stack": {
+			opcode: 0x00EE,
+			want:   ErrStackUnderflow,
+		},
+		"draw_sprite_outside_of_memory": {
+			opcode: 0xD125,
+			setup: func(ch *chip8) {
+				ch.i = memorySize - 2
+			},
+			want: ErrMemoryOutOfBounds,
+		},
+		"store_decimal_outside_of_memory": {
+			opcode: 0xF133,
+			setup: func(ch *chip8) {
+				ch.i = memorySize - 1
+			},
+			want: ErrMemoryOutOfBounds,
+		},
+		"store_registers_outside_of_memory": {
+			opcode: 0xFF55,
+			setup: func(ch *chip8) {
+				ch.i = memorySize - 4
+			},
+			want: ErrMemoryOutOfBounds,
+		},
+		"load_registers_outside_of_memory": {
+			opcode: 0xFF65,
+			setup: func(ch *chip8) {
+				ch.i = memorySize
+			},
+			want: ErrMemoryOutOfBounds,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			chip8 := newTestChip8(t, Ctx{})
+			chip8.ram.Memory[0x200] = uint8(test.opcode >> 8)
+			chip8.ram.Memory[0x200+1] = uint8(test.opcode)
+			chip8.display = &displayMock{}
+			chip8.v[0x3] = 0x42
+			if test.setup != nil {
+				test.setup(chip8)
+			}
+			err := chip8.exec(programStartPos)
+			assert.True(t, errors.Is(err, test.want), "got %v", err)
+
+			var cpuErr *CPUError
+			require.True(t, errors.As(err, &cpuErr))
+			assert.Equal(t, uint16(programStartPos), cpuErr.PC)
+			assert.Equal(t, test.opcode, cpuErr.Opcode)
+			assert.Equal(t, byte(0x42), cpuErr.V[0x3])
+			assert.Equal(t, uint16(programStartPos), chip8.pc)
+		})
+	}
+}
+
+func TestExecPCOutOfRange(t *testing.T) {
+	chip8 := newTestChip8(t, Ctx{})
+	chip8.display = &displayMock{}
+	chip8.pc = memorySize - 1
+	err := chip8.exec(chip8.pc)
+	assert.True(t, errors.Is(err, ErrPCOutOfRange), "got %v", err)
+}
+
+func TestCPUErrorReport(t *testing.T) {
+	err := &CPUError{
+		Err:    ErrStackUnderflow,
+		PC:     0x2A0,
+		Opcode: 0x00EE,
+		I:      0x300,
+		Stack:  []uint16{0x202, 0x20A},
+	}
+	err.V[0xA] = 0xFF
+	report := err.Report()
+	assert.Contains(t, report, "stack underflow")
+	assert.Contains(t, report, "PC: 02A0  Opcode: 00EE  I: 0300")
+	assert.Contains(t, report, "VA: FF")
+	assert.Contains(t, report, "Stack: 020A 0202")
+	assert.EqualError(t, err, "stack underflow at 0x02a0 (opcode 00EE)")
+}
+
+func TestQuirks(t *testing.T) {
+	testCases := map[string]struct {
+		quirks Quirks
+		opcode uint16
+		setup  func(ch *chip8)
+		assert func(t *testing.T, ch *chip8)
+	}{
+		// 8XY6
+		"right_shift_vy": {
+			opcode: 0x8236,
+			setup: func(ch *chip8) {
+				ch.v[2] = 0x8
+				ch.v[3] = 0x5
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x2), ch.v[2])
+				assert.Equal(t, uint8(0x1), ch.v[0xF])
+			},
+		},
+		"right_shift_vx_in_place": {
+			quirks: Quirks{ShiftVX: true},
+			opcode: 0x8236,
+			setup: func(ch *chip8) {
+				ch.v[2] = 0x8
+				ch.v[3] = 0x5
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x4), ch.v[2])
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		// 8XYE
+		"left_shift_vy": {
+			opcode: 0x823E,
+			setup: func(ch *chip8) {
+				ch.v[2] = 0x81
+				ch.v[3] = 0x2
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x4), ch.v[2])
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		"left_shift_vx_in_place": {
+			quirks: Quirks{ShiftVX: true},
+			opcode: 0x823E,
+			setup: func(ch *chip8) {
+				ch.v[2] = 0x81
+				ch.v[3] = 0x2
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x2), ch.v[2])
+				assert.Equal(t, uint8(0x1), ch.v[0xF])
+			},
+		},
+		// FX55
+		"store_leaves_i_untouched": {
+			opcode: 0xF355,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, 0x300, ch.i)
+			},
+		},
+		"store_increments_i_by_x": {
+			quirks: Quirks{LoadStore: IncrementX},
+			opcode: 0xF355,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, 0x303, ch.i)
+			},
+		},
+		"store_increments_i_by_x_plus_one": {
+			quirks: Quirks{LoadStore: IncrementXPlusOne},
+			opcode: 0xF355,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, 0x304, ch.i)
+			},
+		},
+		// FX65
+		"load_increments_i_by_x_plus_one": {
+			quirks: Quirks{LoadStore: IncrementXPlusOne},
+			opcode: 0xF365,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				ch.ram.Memory[0x303] = 0x42
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, 0x304, ch.i)
+				assert.Equal(t, uint8(0x42), ch.v[3])
+			},
+		},
+		// BNNN
+		"jump_with_v0": {
+			opcode: 0xB310,
+			setup: func(ch *chip8) {
+				ch.v[0] = 0x1
+				ch.v[3] = 0x2
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint16(0x311), ch.pc)
+			},
+		},
+		"jump_with_vx": {
+			quirks: Quirks{JumpVX: true},
+			opcode: 0xB310,
+			setup: func(ch *chip8) {
+				ch.v[0] = 0x1
+				ch.v[3] = 0x2
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint16(0x312), ch.pc)
+			},
+		},
+		// 8XY1, 8XY2, 8XY3
+		"or_keeps_vf": {
+			opcode: 0x8121,
+			setup: func(ch *chip8) {
+				ch.v[0xF] = 0x5
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x5), ch.v[0xF])
+			},
+		},
+		"or_resets_vf": {
+			quirks: Quirks{VFReset: true},
+			opcode: 0x8121,
+			setup: func(ch *chip8) {
+				ch.v[0xF] = 0x5
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		"and_resets_vf": {
+			quirks: Quirks{VFReset: true},
+			opcode: 0x8122,
+			setup: func(ch *chip8) {
+				ch.v[0xF] = 0x5
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		"xor_resets_vf": {
+			quirks: Quirks{VFReset: true},
+			opcode: 0x8123,
+			setup: func(ch *chip8) {
+				ch.v[0xF] = 0x5
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, uint8(0x0), ch.v[0xF])
+			},
+		},
+		// DXYN
+		"sprite_is_clipped": {
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.v[1] = 60
+				ch.v[2] = 31
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0xFF, 0xFF})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x1), ch.fb.pixel(63, 31))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(0, 31))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(60, 0))
+			},
+		},
+		"sprite_is_wrapped": {
+			quirks: Quirks{Wrap: true},
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.v[1] = 60
+				ch.v[2] = 31
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0xFF, 0xFF})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x1), ch.fb.pixel(60, 31))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(3, 31))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(60, 0))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(3, 0))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(4, 0))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(60, 1))
+			},
+		},
+		"large_sprite_is_wrapped": {
+			quirks: Quirks{Wrap: true},
+			opcode: 0xD120,
+			setup: func(ch *chip8) {
+				ch.setHighRes(true)
+				ch.v[1] = 120
+				ch.v[2] = 10
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0xFF, 0xFF})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x1), ch.fb.pixel(127, 10))
+				assert.Equal(t, byte(0x1), ch.fb.pixel(7, 10))
+				assert.Equal(t, byte(0x0), ch.fb.pixel(8, 10))
+			},
+		},
+		"sprite_position_wraps_around_screen": {
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.v[1] = 70
+				ch.v[2] = 33
+				ch.i = 0x300
+				copy(ch.ram.Memory[0x300:], []byte{0x80, 0x00})
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x1), ch.fb.pixel(6, 1))
+			},
+		},
+		"sprite_is_drawn_without_display_wait": {
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				ch.ram.Memory[0x300] = 0x80
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x1), ch.fb.pixel(0, 0))
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+		"sprite_waits_for_vblank": {
+			quirks: Quirks{DisplayWait: true},
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.i = 0x300
+				ch.ram.Memory[0x300] = 0x80
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x0), ch.fb.pixel(0, 0))
+				assert.Equal(t, uint16(0x200), ch.pc)
+			},
+		},
+		"sprite_is_drawn_on_vblank": {
+			quirks: Quirks{DisplayWait: true},
+			opcode: 0xD122,
+			setup: func(ch *chip8) {
+				ch.vblank = true
+				ch.i = 0x300
+				ch.ram.Memory[0x300] = 0x80
+			},
+			assert: func(t *testing.T, ch *chip8) {
+				assert.Equal(t, byte(0x1), ch.fb.pixel(0, 0))
+				assert.False(t, ch.vblank)
+				assert.Equal(t, uint16(0x202), ch.pc)
+			},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			chip8 := newTestChip8(t, Ctx{})
+			chip8.quirks = test.quirks
+			chip8.ram.Memory[0x200] = uint8(test.opcode >> 8)
+			chip8.ram.Memory[0x200+1] = uint8(test.opcode)
+			chip8.display = &displayMock{}
+			if test.setup != nil {
+				test.setup(chip8)
+			}
+			require.NoError(t, chip8.exec(programStartPos))
+			test.assert(t, chip8)
+		})
+	}
+}
+
+func TestQuirksProfiles(t *testing.T) {
+	assert.Equal(t, []string{"chip48", "chip8", "schip", "xochip"}, QuirksProfiles())
+
+	ctx := Ctx{quirks: "chip8"}
+	assert.Equal(t, IncrementXPlusOne, ctx.Quirks().LoadStore)
+	assert.Equal(t, Quirks{}, Ctx{}.Quirks())
+
+	xochip := newTestChip8(t, Ctx{quirks: "xochip"})
+	assert.Len(t, xochip.ram.Memory, extendedMemorySize)
+}
+
+func TestStepWithHeadlessDisplay(t *testing.T) {
+	ctx, err := NewCtxFromArgs([]string{"program", "-headless", "testdata/draw.ch8"})
+	require.NoError(t, err)
+	c, err := NewChip8(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Step(4))
+
+	d, ok := c.Display().(*display.Headless)
+	require.True(t, ok)
+	assert.False(t, d.Pixel(0, 0))
+	assert.True(t, d.Pixel(2, 0))
+	assert.True(t, d.Pixel(3, 0))
+	assert.True(t, d.Pixel(1, 1))
+	assert.True(t, d.Pixel(4, 1))
+	assert.False(t, d.Pixel(2, 1))
+	assert.Equal(t, byte(0), c.(*chip8).v[0xF])
+}
+
+func TestStepTicksTimers(t *testing.T) {
+	ctx, err := NewCtxFromArgs([]string{"program", "-headless", "-cps", "120", "testdata/draw.ch8"})
+	require.NoError(t, err)
+	c, err := NewChip8(ctx)
+	require.NoError(t, err)
+	c.(*chip8).delayTimer = 10
+
+	require.NoError(t, c.Step(5))
+	assert.Equal(t, byte(8), c.(*chip8).delayTimer)
+}
+
+func TestDrawCollisionSetsVF(t *testing.T) {
+	ch := newTestChip8(t, Ctx{})
+	ch.i = 0x300
+	ch.ram.Memory[0x300] = 0xFF
+	// DRW V0, V0, 1 twice.
+	copy(ch.ram.Memory[0x200:], []byte{0xD0, 0x01, 0xD0, 0x01})
+
+	require.NoError(t, ch.exec(ch.pc))
+	assert.Equal(t, byte(0), ch.v[0xF])
+	require.NoError(t, ch.exec(ch.pc))
+	assert.Equal(t, byte(1), ch.v[0xF])
+	assert.Equal(t, byte(0), ch.fb.pixel(0, 0))
+}
+
+func TestTickPresentsChangedFramebuffer(t *testing.T) {
+	ch := newTestChip8(t, Ctx{})
+	d := &displayMock{}
+	ch.display = d
+	ch.i = 0x300
+	ch.ram.Memory[0x300] = 0x80
+	copy(ch.ram.Memory[0x200:], []byte{0xD0, 0x01})
+
+	ch.tick()
+	require.Len(t, d.frames, 1)
+	require.NoError(t, ch.exec(ch.pc))
+	assert.Equal(t, byte(0), d.frames[0].Pixel(0, 0))
+
+	ch.tick()
+	require.Len(t, d.frames, 2)
+	assert.Equal(t, byte(1), d.frames[1].Pixel(0, 0))
+
+	// Nothing is presented when the framebuffer is not changed.
+	ch.tick()
+	assert.Len(t, d.frames, 2)
+}
+
+func TestOctoComparisons(t *testing.T) {
+	testCases := []struct {
+		op   string
+		want [3]bool
+	}{
+		// Results of 3, 5 and 7 compared with 5.
+		{op: "==", want: [3]bool{false, true, false}},
+		{op: "!=", want: [3]bool{true, false, true}},
+		{op: "<", want: [3]bool{true, false, false}},
+		{op: ">", want: [3]bool{false, false, true}},
+		{op: "<=", want: [3]bool{true, true, false}},
+		{op: ">=", want: [3]bool{false, true, true}},
+	}
+	for _, test := range testCases {
+		for i, v := range []int{3, 5, 7} {
+			for _, rhs := range []string{"5", "v2"} {
+				name := fmt.Sprintf("%d_%s_%s", v, test.op, rhs)
+				t.Run(name, func(t *testing.T) {
+					src := fmt.Sprintf(": main v0 := %d v1 := 0 v2 := 5 if v0 %s %s then v1 := 1 loop again",
+						v, test.op, rhs)
+					p, err := octo.Compile("test.8o", []byte(src))
+					require.NoError(t, err)
+					c := newTestChip8(t, Ctx{path: binaryPath})
+					require.NoError(t, c.start())
+					copy(c.ram.Memory[programStartPos:], p.Code)
+					require.NoError(t, c.Step(20))
+
+					assert.Equal(t, test.want[i], c.v[1] == 1)
+				})
+			}
+		}
+	}
+}
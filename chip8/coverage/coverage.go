@@ -0,0 +1,169 @@
+// Package coverage records which instructions of a rom were executed and
+// reports them as an annotated disassembly or HTML page.
+package coverage
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrROMMismatch is returned when coverage of different roms is merged.
+var ErrROMMismatch = errors.New("coverage is of another rom")
+
+// version is the version of the coverage file format.
+const version = 1
+
+// Coverage holds the number of executions of instructions by address.
+// Coverage file is a text file:
+//
+//	chip8-coverage 1
+//	rom <SHA-256 of the rom>
+//	runs <number of merged runs>
+//	hit <address> <count>
+//	...
+type Coverage struct {
+	ROM  [sha256.Size]byte
+	Runs int
+	Hits map[int]uint64
+}
+
+// New creates coverage of a single run of the rom.
+func New(rom [sha256.Size]byte) *Coverage {
+	return &Coverage{ROM: rom, Runs: 1, Hits: make(map[int]uint64)}
+}
+
+// Hit counts execution of the instruction at addr.
+func (c *Coverage) Hit(addr int) {
+	c.Hits[addr]++
+}
+
+// Merge adds hits of other runs of the same rom.
+func (c *Coverage) Merge(o *Coverage) error {
+	if c.ROM != o.ROM {
+		return ErrROMMismatch
+	}
+	c.Runs += o.Runs
+	for addr, n := range o.Hits {
+		c.Hits[addr] += n
+	}
+	return nil
+}
+
+// Addresses returns executed addresses in ascending order.
+func (c *Coverage) Addresses() []int {
+	addrs := make([]int, 0, len(c.Hits))
+	for addr := range c.Hits {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	return addrs
+}
+
+// Write writes the coverage file.
+func (c *Coverage) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "chip8-coverage %d\n", version)
+	fmt.Fprintf(b, "rom %x\n", c.ROM)
+	fmt.Fprintf(b, "runs %d\n", c.Runs)
+	for _, addr := range c.Addresses() {
+		fmt.Fprintf(b, "hit %04X %d\n", addr, c.Hits[addr])
+	}
+	return b.Flush()
+}
+
+// Read reads the coverage file.
+func Read(r io.Reader) (*Coverage, error) {
+	c := &Coverage{Hits: make(map[int]uint64)}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch {
+		case n == 1:
+			if fields[0] != "chip8-coverage" || len(fields) != 2 || fields[1] != strconv.Itoa(version) {
+				return nil, errors.New("unsupported coverage format")
+			}
+		case fields[0] == "rom" && len(fields) == 2:
+			var b []byte
+			b, err = hex.DecodeString(fields[1])
+			if err != nil || len(b) != sha256.Size {
+				err = fmt.Errorf("invalid hash %q", fields[1])
+			}
+			copy(c.ROM[:], b)
+		case fields[0] == "runs" && len(fields) == 2:
+			c.Runs, err = strconv.Atoi(fields[1])
+		case fields[0] == "hit" && len(fields) == 3:
+			err = c.parseHit(fields[1:])
+		default:
+			err = errors.New("unknown record")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("coverage line %d: %v", n, err)
+		}
+	}
+	return c, s.Err()
+}
+
+func (c *Coverage) parseHit(fields []string) error {
+	addr, err := strconv.ParseUint(fields[0], 16, 16)
+	if err != nil {
+		return fmt.Errorf("invalid address %q", fields[0])
+	}
+	n, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid count %q", fields[1])
+	}
+	c.Hits[int(addr)] += n
+	return nil
+}
+
+// Load reads the coverage file at path.
+func Load(path string) (*Coverage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save merges the coverage with the one saved at path, if there is any, and
+// writes the result to path.
+func (c *Coverage) Save(path string) error {
+	merged := New(c.ROM)
+	merged.Runs = 0
+	if err := merged.Merge(c); err != nil {
+		return err
+	}
+	if prev, err := Load(path); err == nil {
+		if err := merged.Merge(prev); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := merged.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,127 @@
+package coverage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var rom = []byte{
+	0x60, 0x02, // 200: LD V0, 2
+	0xB2, 0x06, // 202: JP V0, 206
+	0x00, 0xFD, // 204: EXIT
+	0x00, 0xE0, // 206: never found by the disassembler
+	0x12, 0x04, // 208: JP 204
+	0xF0, 0x90, // 20A: data
+}
+
+func newCoverage(hits map[int]uint64) *Coverage {
+	c := New(sha256.Sum256(rom))
+	for addr, n := range hits {
+		c.Hits[addr] = n
+	}
+	return c
+}
+
+func TestWriteRead(t *testing.T) {
+	c := newCoverage(map[int]uint64{0x200: 3, 0x202: 1})
+	var b bytes.Buffer
+	require.NoError(t, c.Write(&b))
+	assert.True(t, strings.HasPrefix(b.String(), "chip8-coverage 1\nrom "))
+	assert.True(t, strings.HasSuffix(b.String(), "runs 1\nhit 0200 3\nhit 0202 1\n"))
+
+	read, err := Read(&b)
+	require.NoError(t, err)
+	assert.Equal(t, c, read)
+}
+
+func TestReadErrors(t *testing.T) {
+	testCases := map[string]struct {
+		src     string
+		wantErr string
+	}{
+		"format":  {src: "chip8-movie 1\n", wantErr: "unsupported coverage format"},
+		"version": {src: "chip8-coverage 2\n", wantErr: "unsupported coverage format"},
+		"hash":    {src: "chip8-coverage 1\nrom 12\n", wantErr: `coverage line 2: invalid hash "12"`},
+		"address": {src: "chip8-coverage 1\nhit 10000 1\n", wantErr: `coverage line 2: invalid address "10000"`},
+		"count":   {src: "chip8-coverage 1\nhit 0200 x\n", wantErr: `coverage line 2: invalid count "x"`},
+		"record":  {src: "chip8-coverage 1\nmiss 0200\n", wantErr: "coverage line 2: unknown record"},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.src))
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := newCoverage(map[int]uint64{0x200: 3, 0x202: 1})
+	require.NoError(t, c.Merge(newCoverage(map[int]uint64{0x200: 1, 0x204: 1})))
+	assert.Equal(t, 2, c.Runs)
+	assert.Equal(t, map[int]uint64{0x200: 4, 0x202: 1, 0x204: 1}, c.Hits)
+
+	other := New(sha256.Sum256([]byte{0x00}))
+	assert.Equal(t, ErrROMMismatch, c.Merge(other))
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "game.cov")
+
+	require.NoError(t, newCoverage(map[int]uint64{0x200: 1}).Save(path))
+	require.NoError(t, newCoverage(map[int]uint64{0x200: 2, 0x202: 1}).Save(path))
+	c, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Runs)
+	assert.Equal(t, map[int]uint64{0x200: 3, 0x202: 1}, c.Hits)
+
+	other := New(sha256.Sum256([]byte{0x00}))
+	assert.True(t, errors.Is(other.Save(path), ErrROMMismatch))
+}
+
+func TestReport(t *testing.T) {
+	c := newCoverage(map[int]uint64{0x200: 2, 0x202: 2, 0x206: 1})
+	syms := symbols.New()
+	syms.AddLabel(0x200, "main")
+	syms.AddLine(0x200, symbols.Line{File: "game.8o", Line: 2, Text: "v0 := 2"})
+	r := NewReport(rom, 0x200, c, syms)
+
+	hit, total := r.Summary()
+	assert.Equal(t, 3, hit)
+	assert.Equal(t, 5, total)
+
+	var b bytes.Buffer
+	require.NoError(t, r.WriteListing(&b))
+	want := `Coverage: 3 of 5 instructions (60.0%), merged runs: 1
+
+                main:
+       2  0200  	LD V0, #02	; game.8o:2: v0 := 2
+       2  0202  	JP V0, #206
+                L204:
+   #####  0204  	EXIT
+       1  0206  	CLS
+   #####  0208  	JP L204
+       -  020A  	DB #F0, #90
+`
+	assert.Equal(t, want, b.String())
+
+	b.Reset()
+	require.NoError(t, r.WriteHTML(&b, "Coverage of <game>"))
+	html := b.String()
+	assert.Contains(t, html, "<title>Coverage of &lt;game&gt;</title>")
+	assert.Contains(t, html, `<tr class="hit"><td class="hits">1</td><td>0206</td><td>CLS</td></tr>`)
+	assert.Contains(t, html, `<tr class="miss"><td class="hits">#####</td><td>0204</td><td>EXIT</td></tr>`)
+	assert.Contains(t, html, `<span class="comment">; game.8o:2: v0 := 2</span>`)
+}
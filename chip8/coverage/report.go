@@ -0,0 +1,141 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// Report is coverage of the disassembled rom.
+type Report struct {
+	cov     *Coverage
+	entries []disasm.Entry
+}
+
+// NewReport disassembles the rom loaded at origin. Executed addresses which
+// can not be found by following the control flow, e.g. targets of indirect
+// jumps, are disassembled too. Labels and source lines are taken from syms,
+// which may be nil.
+func NewReport(rom []byte, origin int, cov *Coverage, syms *symbols.Table) *Report {
+	p := disasm.Disassemble(rom, origin)
+	for _, addr := range cov.Addresses() {
+		if _, ok := p.Instruction(addr); !ok {
+			p.Trace(addr)
+		}
+	}
+	p.Annotate(syms)
+	return &Report{cov: cov, entries: p.Entries()}
+}
+
+// Summary returns the number of executed instructions and the number of all
+// instructions.
+func (r *Report) Summary() (hit, total int) {
+	for _, e := range r.entries {
+		if e.Code {
+			total++
+			if r.cov.Hits[e.Addr] > 0 {
+				hit++
+			}
+		}
+	}
+	return hit, total
+}
+
+func (r *Report) summary() string {
+	hit, total := r.Summary()
+	percent := 0.0
+	if total > 0 {
+		percent = float64(hit) * 100 / float64(total)
+	}
+	return fmt.Sprintf("Coverage: %d of %d instructions (%.1f%%), merged runs: %d", hit, total, percent, r.cov.Runs)
+}
+
+// hits returns the hit count column of the entry: the count for executed
+// instructions, ##### for instructions which were never executed and - for
+// data.
+func (r *Report) hits(e disasm.Entry) string {
+	switch {
+	case !e.Code:
+		return "-"
+	case r.cov.Hits[e.Addr] == 0:
+		return "#####"
+	}
+	return fmt.Sprint(r.cov.Hits[e.Addr])
+}
+
+// WriteListing writes the disassembly with hit counts of instructions.
+func (r *Report) WriteListing(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "%s\n\n", r.summary())
+	for _, e := range r.entries {
+		if e.Label != "" {
+			fmt.Fprintf(b, "%16s%s:\n", "", e.Label)
+			continue
+		}
+		fmt.Fprintf(b, "%8s  %04X  \t%s", r.hits(e), e.Addr, e.Text)
+		if e.Comment != "" {
+			fmt.Fprintf(b, "\t; %s", e.Comment)
+		}
+		b.WriteString("\n")
+	}
+	return b.Flush()
+}
+
+// htmlRow is a line of the HTML report.
+type htmlRow struct {
+	disasm.Entry
+	Hits  string
+	Class string
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.8em; white-space: pre; }
+td.hits { text-align: right; }
+tr.hit { background: #dfd; }
+tr.miss { background: #fdd; }
+tr.data { color: #888; }
+tr.label td { font-weight: bold; }
+.comment { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}</p>
+<table>
+{{range .Rows}}{{if .Label}}<tr class="label"><td></td><td></td><td>{{.Label}}:</td></tr>
+{{else}}<tr class="{{.Class}}"><td class="hits">{{.Hits}}</td><td>{{printf "%04X" .Addr}}</td><td>{{.Text}}{{if .Comment}} <span class="comment">; {{.Comment}}</span>{{end}}</td></tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as an HTML page. Executed instructions are
+// green and instructions which were never executed are red.
+func (r *Report) WriteHTML(w io.Writer, title string) error {
+	rows := make([]htmlRow, 0, len(r.entries))
+	for _, e := range r.entries {
+		row := htmlRow{Entry: e, Hits: r.hits(e), Class: "data"}
+		if e.Code {
+			row.Class = "hit"
+			if r.cov.Hits[e.Addr] == 0 {
+				row.Class = "miss"
+			}
+		}
+		rows = append(rows, row)
+	}
+	return htmlReport.Execute(w, struct {
+		Title, Summary string
+		Rows           []htmlRow
+	}{title, r.summary(), rows})
+}
@@ -0,0 +1,19 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverage(t *testing.T) {
+	c := newTestChip8(t, Ctx{path: binaryPath, coverage: "game.cov"})
+	require.NoError(t, c.start())
+	// LD V0, 1; JP 206; LD V0, 2; ADD V0, 1; JP 206.
+	copy(c.ram.Memory[programStartPos:], []byte{0x60, 0x01, 0x12, 0x06, 0x60, 0x02, 0x70, 0x01, 0x12, 0x06})
+	require.NoError(t, c.Step(6))
+
+	assert.Equal(t, c.ram.romHash, c.coverage.ROM)
+	assert.Equal(t, map[int]uint64{0x200: 1, 0x202: 1, 0x206: 2, 0x208: 2}, c.coverage.Hits)
+}
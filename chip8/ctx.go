@@ -3,19 +3,105 @@ package chip8
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/Pawka/chip8-emulator/chip8/trace"
 )
 
 // Ctx is context of the program which holds command line arguments.
 type Ctx struct {
 	disassemble bool
 	path        string
+	// quirks is a name of quirks profile. Empty name stands for default
+	// behaviour.
+	quirks string
+	// cyclesPerSecond is the number of instructions executed per second.
+	cyclesPerSecond int
+	// wav is a path of the file where sound is recorded.
+	wav string
+	// headless runs the emulator without the terminal display.
+	headless bool
+	// debug starts the program paused in the debugger.
+	debug bool
+	// Conditions which pause the program in the debugger.
+	breakpoints    []uint16
+	watchpoints    []addrRange
+	registerBreaks []registerBreak
+	// gdb is the address of the GDB server.
+	gdb string
+	// loadState is a path of the snapshot loaded at start.
+	loadState string
+	// rewindDepth is the number of frames kept for rewinding.
+	rewindDepth int
+	// rewindMemory is the memory budget of the rewind buffer in megabytes.
+	rewindMemory int
+	// seed of the random number generator. Zero picks a random seed.
+	seed int64
+	// record is a path of the movie file where input is recorded.
+	record string
+	// replay is a path of the movie file which is replayed.
+	replay string
+	// symbols is a path of the symbol file or assembler listing.
+	symbols string
+	// trace is a path of the file where executed instructions are written.
+	trace       string
+	traceFormat trace.Format
+	traceFilter trace.Filter
+	// profile is a path of the pprof profile and profileReport is a path of
+	// the text report written on exit.
+	profile       string
+	profileReport string
+	// coverage is a path of the coverage file where executed addresses are
+	// merged on exit.
+	coverage string
+	// render selects how pixels are drawn in the terminal and scale enlarges
+	// them.
+	render display.Render
+	scale  int
+	// graphics selects the protocol of drawing frames as bitmaps.
+	graphics display.Graphics
+	// palette holds colours of pixels on the terminal display, screenshots
+	// and GIF recordings.
+	palette display.Palette
+	// imageScale enlarges pixels of screenshots and GIF recordings.
+	imageScale int
+	// screenshotCycle is the cycle after which a screenshot is taken. Zero
+	// disables it.
+	screenshotCycle uint64
+	// gif is a path of the animated GIF where frames are recorded.
+	gif string
+	// web is the address where the browser display is served.
+	web string
+}
+
+// Quirks returns quirks of selected profile.
+func (c Ctx) Quirks() Quirks {
+	return quirksProfiles[c.quirks]
+}
+
+// IsDebug returns true if the debugger is enabled. Breakpoints enable the
+// debugger without pausing the program at start.
+func (c Ctx) IsDebug() bool {
+	return c.debug || c.gdb != "" || len(c.breakpoints) > 0 || len(c.watchpoints) > 0 ||
+		len(c.registerBreaks) > 0
 }
 
-// IsDisplay returns true if display is supposed to be created.
+// IsDisplay returns true if terminal display is supposed to be created.
 func (c Ctx) IsDisplay() bool {
-	return !c.disassemble
+	return !c.disassemble && !c.headless && c.web == ""
+}
+
+// IsWeb returns true if the display is served to browsers.
+func (c Ctx) IsWeb() bool {
+	return !c.disassemble && c.web != ""
 }
 
+// defaultImageScale enlarges pixels of screenshots, so the low resolution
+// screen is 512x256 pixels.
+const defaultImageScale = 8
+
 const (
 	_ = iota
 
@@ -28,8 +114,109 @@ func NewCtxFromArgs(args []string) (Ctx, error) {
 	ctx := Ctx{}
 	set := flag.NewFlagSet(args[0], flag.ExitOnError)
 	set.BoolVar(&ctx.disassemble, "d", false, "Run disassembler for given program")
+	set.StringVar(&ctx.quirks, "quirks", "", quirksUsage())
+	set.IntVar(&ctx.cyclesPerSecond, "cps", defaultCyclesPerSecond, "Instructions executed per second")
+	set.StringVar(&ctx.wav, "wav", "", "Record sound to WAV file at given path")
+	set.BoolVar(&ctx.headless, "headless", false, "Run without the terminal display")
+	set.BoolVar(&ctx.debug, "debug", false, "Start the program paused in the debugger")
+	breakpoints := set.String("break", "", "Pause at comma separated addresses, e.g. 0x200,0x2A4")
+	watchpoints := set.String("watch", "", "Pause on memory write to comma separated addresses or ranges, e.g. 0x300-0x30F")
+	registerBreaks := set.String("break-reg", "", "Pause when register gets value, e.g. V3=0x10")
+	set.StringVar(&ctx.gdb, "gdb", "", "Start paused and wait for GDB at given port or address, e.g. 1234")
+	set.StringVar(&ctx.loadState, "load-state", "", "Load state from the snapshot file at start")
+	set.IntVar(&ctx.rewindDepth, "rewind-depth", defaultRewindDepth, "Number of frames kept for rewinding, 0 disables rewinding")
+	set.IntVar(&ctx.rewindMemory, "rewind-memory", defaultRewindMemory, "Memory budget of the rewind buffer in megabytes")
+	set.Int64Var(&ctx.seed, "seed", 0, "Seed of the random number generator, 0 picks a random seed")
+	set.StringVar(&ctx.record, "record", "", "Record input to the movie file at given path")
+	set.StringVar(&ctx.replay, "replay", "", "Replay input from the movie file and verify the screen at the end")
+	set.StringVar(&ctx.symbols, "symbols", "", "Load labels and source lines from the symbol file or .lst listing")
+	set.StringVar(&ctx.trace, "trace", "", "Write executed instructions to the trace file at given path")
+	traceFormat := set.String("trace-format", "text", "Format of the trace: text, json or binary")
+	traceAddrs := set.String("trace-addr", "", "Trace instructions at addresses in the range, e.g. 0x200-0x2FF")
+	traceOps := set.String("trace-ops", "", "Trace comma separated opcode classes, e.g. 8,D,F")
+	traceCycles := set.String("trace-cycles", "", "Trace instructions in the cycle range, e.g. 1000-2000")
+	set.StringVar(&ctx.profile, "profile", "", "Write pprof profile of executed instructions on exit")
+	set.StringVar(&ctx.profileReport, "profile-report", "", "Write report of hot spots and subroutine cycles on exit")
+	set.StringVar(&ctx.coverage, "coverage", "", "Merge executed addresses into the coverage file on exit")
+	render := set.String("render", "block", "Draw pixels with terminal cells: block, half or braille")
+	set.IntVar(&ctx.scale, "scale", 1, "Enlarge pixels by given integer factor")
+	graphics := set.String("graphics", "auto", "Draw frames as bitmaps: auto, sixel, kitty or cells for the render, defaults to cells if -render is set")
+	palette := set.String("palette", display.DefaultPalette, "Colours of pixels: "+strings.Join(display.PaletteNames(), ", ")+" or a name from the palette file")
+	paletteFile := set.String("palette-file", "", "Load user defined palettes from the file at given path")
+	set.IntVar(&ctx.imageScale, "image-scale", defaultImageScale, "Enlarge pixels of screenshots and GIF recordings by given integer factor")
+	set.Uint64Var(&ctx.screenshotCycle, "screenshot-at-cycle", 0, "Save the screen to a PNG file next to the rom after given cycle")
+	set.StringVar(&ctx.gif, "gif", "", "Record every frame to the animated GIF at given path")
+	set.StringVar(&ctx.web, "web", "", "Serve the display to browsers at given port or address, e.g. :8080")
 	set.Parse(args[1:])
 
+	var err error
+	if ctx.breakpoints, err = parseBreakpoints(*breakpoints); err != nil {
+		return ctx, err
+	}
+	if ctx.watchpoints, err = parseWatchpoints(*watchpoints); err != nil {
+		return ctx, err
+	}
+	if ctx.registerBreaks, err = parseRegisterBreaks(*registerBreaks); err != nil {
+		return ctx, err
+	}
+	if ctx.render, err = display.ParseRender(*render); err != nil {
+		return ctx, err
+	}
+	if ctx.graphics, err = display.ParseGraphics(*graphics); err != nil {
+		return ctx, err
+	}
+	explicit := make(map[string]bool)
+	set.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if explicit["render"] {
+		// The selected render is not replaced with detected bitmap graphics.
+		if !explicit["graphics"] {
+			ctx.graphics = display.GraphicsCells
+		}
+		if ctx.graphics == display.GraphicsSixel || ctx.graphics == display.GraphicsKitty {
+			return ctx, fmt.Errorf("-render %s conflicts with -graphics %s", *render, *graphics)
+		}
+	}
+	if ctx.palette, err = display.LookupPalette(*palette, *paletteFile); err != nil {
+		return ctx, err
+	}
+	if ctx.scale < 1 {
+		return ctx, fmt.Errorf("scale must be positive, got %d", ctx.scale)
+	}
+	if ctx.imageScale < 1 {
+		return ctx, fmt.Errorf("image scale must be positive, got %d", ctx.imageScale)
+	}
+	if ctx.traceFormat, err = trace.ParseFormat(*traceFormat); err != nil {
+		return ctx, err
+	}
+	if ctx.traceFilter.Addrs, err = trace.ParseRange(*traceAddrs); err != nil {
+		return ctx, err
+	}
+	if ctx.traceFilter.Classes, err = trace.ParseClasses(*traceOps); err != nil {
+		return ctx, err
+	}
+	if ctx.traceFilter.Cycles, err = trace.ParseRange(*traceCycles); err != nil {
+		return ctx, err
+	}
+
+	if ctx.cyclesPerSecond <= 0 {
+		return ctx, fmt.Errorf("cycles per second must be positive, got %d", ctx.cyclesPerSecond)
+	}
+
+	if ctx.rewindDepth < 0 || ctx.rewindMemory < 0 {
+		return ctx, errors.New("rewind depth and memory must not be negative")
+	}
+
+	if ctx.record != "" && ctx.replay != "" {
+		return ctx, errors.New("movie can not be recorded and replayed at the same time")
+	}
+	if (ctx.record != "" || ctx.replay != "") && ctx.loadState != "" {
+		return ctx, errors.New("movie can not start from a loaded state")
+	}
+
+	if _, ok := quirksProfiles[ctx.quirks]; ctx.quirks != "" && !ok {
+		return ctx, fmt.Errorf("unknown quirks profile %q", ctx.quirks)
+	}
+
 	if set.NArg() < PathArgPosition {
 		return ctx, errors.New("provide path to program")
 	}
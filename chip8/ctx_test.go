@@ -1,12 +1,20 @@
 package chip8
 
 import (
+	"math"
 	"testing"
 
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/Pawka/chip8-emulator/chip8/trace"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewCtxFromArgs(t *testing.T) {
+	classic, err := display.LookupPalette(display.DefaultPalette, "")
+	assert.NoError(t, err)
+	amber, err := display.LookupPalette("amber", "")
+	assert.NoError(t, err)
+
 	testCases := map[string]struct {
 		args    []string
 		want    Ctx
@@ -15,20 +23,433 @@ func TestNewCtxFromArgs(t *testing.T) {
 		"happy_path": {
 			args: []string{"program", "file"},
 			want: Ctx{
-				path: "file",
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
 			},
 		},
 		"disassembler_flag_provided": {
 			args: []string{"program", "-d", "file"},
 			want: Ctx{
-				disassemble: true,
-				path:        "file",
+				disassemble:     true,
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+		},
+		"quirks_profile_provided": {
+			args: []string{"program", "-quirks", "schip", "file"},
+			want: Ctx{
+				path:            "file",
+				quirks:          "schip",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+		},
+		"unknown_quirks_profile": {
+			args: []string{"program", "-quirks", "foo", "file"},
+			want: Ctx{
+				quirks:          "foo",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+			wantErr: `unknown quirks profile "foo"`,
+		},
+		"cycles_per_second_provided": {
+			args: []string{"program", "-cps", "1000", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: 1000,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+		},
+		"cycles_per_second_not_positive": {
+			args: []string{"program", "-cps", "0", "file"},
+			want: Ctx{
+				cyclesPerSecond: 0,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+			wantErr: "cycles per second must be positive, got 0",
+		},
+		"wav_path_provided": {
+			args: []string{"program", "-wav", "out.wav", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				wav:             "out.wav",
+			},
+		},
+		"headless_flag_provided": {
+			args: []string{"program", "-headless", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				headless:        true,
+			},
+		},
+		"debugger_flags_provided": {
+			args: []string{"program", "-debug", "-break", "0x200,0x2A4", "-watch", "0x300-0x30F",
+				"-break-reg", "V3=0x10", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				debug:           true,
+				breakpoints:     []uint16{0x200, 0x2A4},
+				watchpoints:     []addrRange{{0x300, 0x30F}},
+				registerBreaks:  []registerBreak{{3, 0x10}},
+			},
+		},
+		"gdb_address_provided": {
+			args: []string{"program", "-gdb", "1234", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				gdb:             "1234",
+			},
+		},
+		"load_state_provided": {
+			args: []string{"program", "-load-state", "file.state1", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				loadState:       "file.state1",
+			},
+		},
+		"rewind_flags_provided": {
+			args: []string{"program", "-rewind-depth", "120", "-rewind-memory", "4", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     120,
+				rewindMemory:    4,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+		},
+		"movie_flags_provided": {
+			args: []string{"program", "-seed", "42", "-record", "game.movie", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				seed:            42,
+				record:          "game.movie",
+			},
+		},
+		"symbols_flag_provided": {
+			args: []string{"program", "-symbols", "game.sym", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				symbols:         "game.sym",
+			},
+		},
+		"trace_flags_provided": {
+			args: []string{"program", "-trace", "game.trace", "-trace-format", "json", "-trace-addr", "0x200-0x2FF",
+				"-trace-ops", "8,D", "-trace-cycles", "100-", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				trace:           "game.trace",
+				traceFormat:     trace.JSON,
+				traceFilter: trace.Filter{
+					Addrs:   trace.Range{From: 0x200, To: 0x2FF},
+					Cycles:  trace.Range{From: 100, To: math.MaxUint64},
+					Classes: 1<<0x8 | 1<<0xD,
+				},
+			},
+		},
+		"profile_flags_provided": {
+			args: []string{"program", "-profile", "cpu.pprof", "-profile-report", "report.txt", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				profile:         "cpu.pprof",
+				profileReport:   "report.txt",
+			},
+		},
+		"coverage_flag_provided": {
+			args: []string{"program", "-coverage", "game.cov", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				coverage:        "game.cov",
+			},
+		},
+		"render_flags_provided": {
+			args: []string{"program", "-render", "half", "-scale", "2", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				render:          display.RenderHalf,
+				scale:           2,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsCells,
+			},
+		},
+		"render_with_auto_graphics": {
+			args: []string{"program", "-render", "braille", "-graphics", "auto", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				render:          display.RenderBraille,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+		},
+		"render_conflicts_with_graphics": {
+			args: []string{"program", "-render", "half", "-graphics", "kitty", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				render:          display.RenderHalf,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				graphics:        display.GraphicsKitty,
+			},
+			wantErr: "-render half conflicts with -graphics kitty",
+		},
+		"palette_provided": {
+			args: []string{"program", "-palette", "amber", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         amber,
+				graphics:        display.GraphicsAuto,
+			},
+		},
+		"unknown_palette": {
+			args: []string{"program", "-palette", "sepia", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				graphics:        display.GraphicsAuto,
+				imageScale:      defaultImageScale,
+			},
+			wantErr: `unknown palette "sepia"`,
+		},
+		"image_flags_provided": {
+			args: []string{"program", "-image-scale", "4", "-screenshot-at-cycle", "1000", "-gif", "game.gif", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				imageScale:      4,
+				screenshotCycle: 1000,
+				gif:             "game.gif",
+			},
+		},
+		"graphics_provided": {
+			args: []string{"program", "-graphics", "sixel", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				graphics:        display.GraphicsSixel,
+				palette:         classic,
+				imageScale:      defaultImageScale,
+			},
+		},
+		"web_provided": {
+			args: []string{"program", "-web", ":8080", "file"},
+			want: Ctx{
+				path:            "file",
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				graphics:        display.GraphicsAuto,
+				palette:         classic,
+				imageScale:      defaultImageScale,
+				web:             ":8080",
+			},
+		},
+		"invalid_scale": {
+			args: []string{"program", "-scale", "0", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				imageScale:      defaultImageScale,
+			},
+			wantErr: "scale must be positive, got 0",
+		},
+		"unknown_trace_format": {
+			args: []string{"program", "-trace-format", "xml", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+			wantErr: `unknown trace format "xml"`,
+		},
+		"record_and_replay": {
+			args: []string{"program", "-record", "a.movie", "-replay", "b.movie", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+				record:          "a.movie",
+				replay:          "b.movie",
+			},
+			wantErr: "movie can not be recorded and replayed at the same time",
+		},
+		"negative_rewind_depth": {
+			args: []string{"program", "-rewind-depth", "-1", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     -1,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
+			},
+			wantErr: "rewind depth and memory must not be negative",
+		},
+		"invalid_breakpoint": {
+			args: []string{"program", "-break", "0x10000", "file"},
+			want: Ctx{
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
 			},
+			wantErr: `invalid address "0x10000"`,
 		},
 		"no_program_path_provided": {
 			args: []string{"program", "-d"},
 			want: Ctx{
-				disassemble: true,
+				disassemble:     true,
+				cyclesPerSecond: defaultCyclesPerSecond,
+				rewindDepth:     defaultRewindDepth,
+				rewindMemory:    defaultRewindMemory,
+				scale:           1,
+				imageScale:      defaultImageScale,
+				palette:         classic,
+				graphics:        display.GraphicsAuto,
 			},
 			wantErr: "provide path to program",
 		},
@@ -0,0 +1,267 @@
+package chip8
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+	"github.com/Pawka/chip8-emulator/chip8/display"
+)
+
+// addrRange is a range of memory addresses. The end is inclusive.
+type addrRange struct {
+	start, end int
+}
+
+// registerBreak pauses the program when register V[reg] becomes value.
+type registerBreak struct {
+	reg   int
+	value byte
+}
+
+// debugger pauses the program on breakpoints and executes it instruction by
+// instruction.
+type debugger struct {
+	paused bool
+	// reason describes why the program is paused.
+	reason string
+
+	breakpoints    map[uint16]bool
+	watchpoints    []addrRange
+	registerBreaks []registerBreak
+
+	// stepping is set when a single instruction is executed while paused.
+	stepping bool
+	// resumed is set when the program continues, so the breakpoint at the
+	// current instruction is not hit again.
+	resumed bool
+	// stepOver is set while the subroutine called by the current instruction
+	// is executed. The program pauses when it returns to returnAddr with the
+	// stack of depth size.
+	stepOver   bool
+	returnAddr uint16
+	depth      int
+
+	// prev holds registers before the last instruction.
+	prev [registersCount]byte
+	// hit describes the watchpoint written by the last instruction.
+	hit string
+	// stopped is signaled when the program is paused or a step is done.
+	stopped chan struct{}
+}
+
+func newDebugger(ctx Ctx) *debugger {
+	d := &debugger{
+		paused:         ctx.debug || ctx.gdb != "",
+		reason:         "start",
+		breakpoints:    make(map[uint16]bool),
+		watchpoints:    ctx.watchpoints,
+		registerBreaks: ctx.registerBreaks,
+		stopped:        make(chan struct{}, 1),
+	}
+	for _, addr := range ctx.breakpoints {
+		d.breakpoints[addr] = true
+	}
+	return d
+}
+
+// before is called before every instruction. It returns false if the
+// instruction must not be executed.
+func (d *debugger) before(c *chip8) bool {
+	if d.paused && !d.stepping {
+		return false
+	}
+	if !d.paused && !d.resumed && d.breakpoints[c.pc] {
+		d.pause(fmt.Sprintf("breakpoint %04X", c.pc))
+		return false
+	}
+	d.resumed = false
+	copy(d.prev[:], c.v)
+	return true
+}
+
+// after is called after every instruction.
+func (d *debugger) after(c *chip8) {
+	if d.stepping {
+		d.stepping = false
+		d.reason = "step"
+		d.notify()
+	}
+	if d.stepOver && c.pc == d.returnAddr && len(c.stack) == d.depth {
+		d.pause("step over")
+	}
+	if d.hit != "" {
+		d.pause(d.hit)
+		d.hit = ""
+	}
+	for _, b := range d.registerBreaks {
+		if c.v[b.reg] == b.value && d.prev[b.reg] != b.value {
+			d.pause(fmt.Sprintf("V%X == %02X", b.reg, b.value))
+		}
+	}
+}
+
+// write is called when an instruction writes n bytes of memory at addr.
+func (d *debugger) write(addr, n int) {
+	for _, w := range d.watchpoints {
+		if addr <= w.end && addr+n-1 >= w.start {
+			d.hit = fmt.Sprintf("write %04X", addr)
+			return
+		}
+	}
+}
+
+func (d *debugger) pause(reason string) {
+	d.paused = true
+	d.reason = reason
+	d.stepOver = false
+	d.notify()
+}
+
+// notify signals that the program is stopped.
+func (d *debugger) notify() {
+	select {
+	case d.stopped <- struct{}{}:
+	default:
+	}
+}
+
+// resume continues the paused program.
+func (d *debugger) resume() {
+	d.paused = false
+	d.resumed = true
+}
+
+// step executes a single instruction and pauses the program.
+func (d *debugger) step() {
+	d.paused = true
+	d.stepping = true
+	d.resumed = true
+}
+
+// command executes a command issued by the user.
+func (d *debugger) command(c *chip8, cmd display.Command) {
+	switch cmd {
+	case display.CommandPause:
+		if d.paused {
+			d.resume()
+		} else {
+			d.pause("paused")
+		}
+	case display.CommandStep:
+		if d.paused {
+			d.step()
+		}
+	case display.CommandStepOver:
+		if !d.paused {
+			return
+		}
+		if int(c.pc)+2 > len(c.ram.Memory) || c.ram.Memory[c.pc]>>4 != 0x2 {
+			d.step()
+			return
+		}
+		d.resume()
+		d.stepOver = true
+		d.returnAddr = c.pc + 2
+		d.depth = len(c.stack)
+	}
+}
+
+// state returns the state of the CPU for the debugger panel.
+func (d *debugger) state(c *chip8) display.DebugState {
+	s := display.DebugState{
+		Paused:     d.paused,
+		Reason:     d.reason,
+		PC:         c.pc,
+		I:          c.i,
+		Stack:      append([]uint16(nil), c.stack...),
+		DelayTimer: c.delayTimer,
+		SoundTimer: c.soundTimer,
+	}
+	copy(s.V[:], c.v)
+	for pc := int(c.pc); pc+2 <= len(c.ram.Memory) && len(s.Code) < debugCodeLines; {
+		s.Code = append(s.Code, c.line(pc))
+		pc += disasm.Decode(c.ram.Memory, pc).Size
+	}
+	return s
+}
+
+// debugCodeLines is the number of instructions shown in the debugger panel.
+const debugCodeLines = 8
+
+// parseAddr parses a memory address. Hexadecimal addresses have 0x prefix.
+func parseAddr(s string) (int, error) {
+	addr, err := strconv.ParseUint(strings.TrimSpace(s), 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return int(addr), nil
+}
+
+// parseBreakpoints parses comma separated list of addresses.
+func parseBreakpoints(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var addrs []uint16
+	for _, f := range strings.Split(s, ",") {
+		addr, err := parseAddr(f)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, uint16(addr))
+	}
+	return addrs, nil
+}
+
+// parseWatchpoints parses comma separated list of addresses and address
+// ranges like 0x300-0x30F.
+func parseWatchpoints(s string) ([]addrRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ranges []addrRange
+	for _, f := range strings.Split(s, ",") {
+		parts := strings.SplitN(f, "-", 2)
+		start, err := parseAddr(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(parts) == 2 {
+			if end, err = parseAddr(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid address range %q", f)
+		}
+		ranges = append(ranges, addrRange{start, end})
+	}
+	return ranges, nil
+}
+
+// parseRegisterBreaks parses comma separated list of conditions like V3=0x10.
+func parseRegisterBreaks(s string) ([]registerBreak, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var breaks []registerBreak
+	for _, f := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(f), "=", 2)
+		if len(parts) != 2 || len(parts[0]) != 2 || (parts[0][0] != 'V' && parts[0][0] != 'v') {
+			return nil, fmt.Errorf("invalid register condition %q", f)
+		}
+		reg, err := strconv.ParseUint(parts[0][1:], 16, 4)
+		if err != nil {
+			return nil, fmt.Errorf("invalid register condition %q", f)
+		}
+		value, err := strconv.ParseUint(parts[1], 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid register condition %q", f)
+		}
+		breaks = append(breaks, registerBreak{int(reg), byte(value)})
+	}
+	return breaks, nil
+}
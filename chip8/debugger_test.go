@@ -0,0 +1,145 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// debugProgram calls a subroutine at 0x208 which stores V0 at 0x300.
+var debugProgram = []byte{
+	0x60, 0x05, // 200: LD V0, 05
+	0x22, 0x08, // 202: CALL 208
+	0x61, 0x07, // 204: LD V1, 07
+	0x12, 0x06, // 206: JP 206
+	0xA3, 0x00, // 208: LD I, 300
+	0xF0, 0x55, // 20A: LD [I], V0
+	0x00, 0xEE, // 20C: RET
+}
+
+func newDebugChip8(t *testing.T, ctx Ctx) *chip8 {
+	ch := newTestChip8(t, ctx)
+	ch.started = true
+	copy(ch.ram.Memory[programStartPos:], debugProgram)
+	return ch
+}
+
+func TestDebuggerStartsPaused(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{debug: true})
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x200), ch.pc)
+	assert.True(t, ch.dbg.paused)
+	assert.Equal(t, "start", ch.dbg.reason)
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{breakpoints: []uint16{0x20A}})
+	ch.delayTimer = 10
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x20A), ch.pc)
+	assert.True(t, ch.dbg.paused)
+	assert.Equal(t, "breakpoint 020A", ch.dbg.reason)
+	assert.Equal(t, byte(9), ch.delayTimer)
+
+	// Timers are stopped while paused.
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x20A), ch.pc)
+	assert.Equal(t, byte(9), ch.delayTimer)
+
+	ch.dbg.command(ch, display.CommandPause)
+	require.NoError(t, ch.frame(10))
+	assert.False(t, ch.dbg.paused)
+	assert.Equal(t, uint16(0x206), ch.pc)
+}
+
+func TestDebuggerStep(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{debug: true})
+
+	ch.dbg.command(ch, display.CommandStep)
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x202), ch.pc)
+	assert.True(t, ch.dbg.paused)
+
+	ch.dbg.command(ch, display.CommandStep)
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x208), ch.pc)
+}
+
+func TestDebuggerStepOver(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{debug: true})
+	ch.dbg.command(ch, display.CommandStepOver)
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x202), ch.pc)
+
+	ch.dbg.command(ch, display.CommandStepOver)
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x204), ch.pc)
+	assert.True(t, ch.dbg.paused)
+	assert.Equal(t, "step over", ch.dbg.reason)
+	assert.Equal(t, byte(5), ch.ram.Memory[0x300])
+}
+
+func TestDebuggerWatchpoint(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{watchpoints: []addrRange{{0x2FF, 0x300}}})
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x20C), ch.pc)
+	assert.True(t, ch.dbg.paused)
+	assert.Equal(t, "write 0300", ch.dbg.reason)
+}
+
+func TestDebuggerRegisterBreak(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{registerBreaks: []registerBreak{{1, 7}}})
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x206), ch.pc)
+	assert.True(t, ch.dbg.paused)
+	assert.Equal(t, "V1 == 07", ch.dbg.reason)
+}
+
+func TestDebuggerState(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{debug: true})
+	ch.v[3] = 0x42
+	ch.stack = append(ch.stack, 0x204)
+
+	s := ch.dbg.state(ch)
+	assert.True(t, s.Paused)
+	assert.Equal(t, uint16(0x200), s.PC)
+	assert.Equal(t, byte(0x42), s.V[3])
+	assert.Equal(t, []uint16{0x204}, s.Stack)
+	assert.Len(t, s.Code, debugCodeLines)
+	assert.Equal(t, "0200\t6005\tLD V0, #05", s.Code[0])
+}
+
+func TestParseDebuggerConditions(t *testing.T) {
+	breakpoints, err := parseBreakpoints("0x200, 0x2a4")
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0x200, 0x2A4}, breakpoints)
+
+	watchpoints, err := parseWatchpoints("0x300-0x30F,0x400")
+	require.NoError(t, err)
+	assert.Equal(t, []addrRange{{0x300, 0x30F}, {0x400, 0x400}}, watchpoints)
+
+	registerBreaks, err := parseRegisterBreaks("V3=0x10,vA=5")
+	require.NoError(t, err)
+	assert.Equal(t, []registerBreak{{3, 0x10}, {0xA, 5}}, registerBreaks)
+
+	_, err = parseBreakpoints("foo")
+	assert.EqualError(t, err, `invalid address "foo"`)
+	_, err = parseWatchpoints("0x30F-0x300")
+	assert.EqualError(t, err, `invalid address range "0x30F-0x300"`)
+	_, err = parseRegisterBreaks("VG=1")
+	assert.EqualError(t, err, `invalid register condition "VG=1"`)
+}
+
+func TestCtxIsDebug(t *testing.T) {
+	assert.False(t, Ctx{}.IsDebug())
+	assert.True(t, Ctx{debug: true}.IsDebug())
+	assert.True(t, Ctx{gdb: "1234"}.IsDebug())
+	assert.True(t, Ctx{breakpoints: []uint16{0x200}}.IsDebug())
+	assert.True(t, Ctx{registerBreaks: []registerBreak{{0, 1}}}.IsDebug())
+}
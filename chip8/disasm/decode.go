@@ -0,0 +1,243 @@
+// Package disasm disassembles CHIP-8, SUPER-CHIP and XO-CHIP programs.
+package disasm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Flow describes how an instruction changes the program counter.
+type Flow int
+
+const (
+	// Next continues with the next instruction.
+	Next Flow = iota
+	// Jump continues at the target.
+	Jump
+	// Call calls the subroutine at the target and continues with the next
+	// instruction after it returns.
+	Call
+	// Skip continues with the next instruction or the one after it.
+	Skip
+	// Return returns from a subroutine.
+	Return
+	// IndirectJump jumps to an address computed at runtime.
+	IndirectJump
+	// Exit stops the program.
+	Exit
+	// Invalid is not an instruction.
+	Invalid
+)
+
+// Instruction is a decoded instruction.
+type Instruction struct {
+	Addr   int
+	Opcode uint16
+	// Size is 4 for XO-CHIP long load and 2 for other instructions.
+	Size int
+	Flow Flow
+	// Target is the address referenced by the instruction or -1.
+	Target int
+
+	// format is the text of the instruction with %s in place of the target.
+	format string
+}
+
+// String returns the instruction in assembler syntax.
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format returns the instruction in assembler syntax. The target address is
+// replaced with the name returned by label unless it is empty.
+func (i Instruction) Format(label func(addr int) string) string {
+	if i.Target < 0 {
+		return i.format
+	}
+	name := ""
+	if label != nil {
+		name = label(i.Target)
+	}
+	if name == "" {
+		name = fmt.Sprintf("#%03X", i.Target)
+	}
+	return fmt.Sprintf(i.format, name)
+}
+
+// Line returns the instruction at addr with its address and opcode. It is
+// used for execution traces.
+func Line(mem []byte, addr int) string {
+	i := Decode(mem, addr)
+	return fmt.Sprintf("%04X\t%04X\t%s", addr, i.Opcode, i)
+}
+
+// Decode decodes the instruction at addr of the memory.
+func Decode(mem []byte, addr int) Instruction {
+	i := Instruction{Addr: addr, Size: 2, Target: -1, Flow: Invalid}
+	if addr < 0 || addr+2 > len(mem) {
+		i.Size = 0
+		return i
+	}
+	code := binary.BigEndian.Uint16(mem[addr:])
+	i.Opcode = code
+	i.Flow = Next
+
+	x := code & 0x0F00 >> 8
+	y := code & 0x00F0 >> 4
+	n := code & 0x000F
+	nn := code & 0x00FF
+	nnn := int(code & 0x0FFF)
+
+	set := func(format string, args ...interface{}) {
+		i.format = fmt.Sprintf(format, args...)
+	}
+	target := func(flow Flow, format string, addr int, args ...interface{}) {
+		i.Flow = flow
+		i.Target = addr
+		// The target is formatted later.
+		set(format, append(args, "%s")...)
+	}
+
+	switch code >> 12 {
+	case 0x0:
+		switch {
+		case code&0xFFF0 == 0x00C0:
+			set("SCD %d", n)
+		case code&0xFFF0 == 0x00D0:
+			set("SCU %d", n)
+		case code == 0x00E0:
+			set("CLS")
+		case code == 0x00EE:
+			i.Flow = Return
+			set("RET")
+		case code == 0x00FB:
+			set("SCR")
+		case code == 0x00FC:
+			set("SCL")
+		case code == 0x00FD:
+			i.Flow = Exit
+			set("EXIT")
+		case code == 0x00FE:
+			set("LOW")
+		case code == 0x00FF:
+			set("HIGH")
+		default:
+			i.Flow = Invalid
+		}
+	case 0x1:
+		target(Jump, "JP %s", nnn)
+	case 0x2:
+		target(Call, "CALL %s", nnn)
+	case 0x3:
+		i.Flow = Skip
+		set("SE V%X, #%02X", x, nn)
+	case 0x4:
+		i.Flow = Skip
+		set("SNE V%X, #%02X", x, nn)
+	case 0x5:
+		switch n {
+		case 0x0:
+			i.Flow = Skip
+			set("SE V%X, V%X", x, y)
+		case 0x2:
+			set("SAVE V%X, V%X", x, y)
+		case 0x3:
+			set("LOAD V%X, V%X", x, y)
+		default:
+			i.Flow = Invalid
+		}
+	case 0x6:
+		set("LD V%X, #%02X", x, nn)
+	case 0x7:
+		set("ADD V%X, #%02X", x, nn)
+	case 0x8:
+		ops := map[uint16]string{
+			0x0: "LD", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD",
+			0x5: "SUB", 0x6: "SHR", 0x7: "SUBN", 0xE: "SHL",
+		}
+		if op, ok := ops[n]; ok {
+			set("%s V%X, V%X", op, x, y)
+		} else {
+			i.Flow = Invalid
+		}
+	case 0x9:
+		if n == 0 {
+			i.Flow = Skip
+			set("SNE V%X, V%X", x, y)
+		} else {
+			i.Flow = Invalid
+		}
+	case 0xA:
+		target(Next, "LD I, %s", nnn)
+	case 0xB:
+		i.Flow = IndirectJump
+		set("JP V0, #%03X", nnn)
+	case 0xC:
+		set("RND V%X, #%02X", x, nn)
+	case 0xD:
+		set("DRW V%X, V%X, %d", x, y, n)
+	case 0xE:
+		switch nn {
+		case 0x9E:
+			i.Flow = Skip
+			set("SKP V%X", x)
+		case 0xA1:
+			i.Flow = Skip
+			set("SKNP V%X", x)
+		default:
+			i.Flow = Invalid
+		}
+	case 0xF:
+		switch nn {
+		case 0x00:
+			if x != 0 || addr+4 > len(mem) {
+				i.Flow = Invalid
+				break
+			}
+			i.Size = 4
+			target(Next, "LD I, LONG %s", int(binary.BigEndian.Uint16(mem[addr+2:])))
+		case 0x01:
+			set("PLANE %d", x)
+		case 0x02:
+			if x != 0 {
+				i.Flow = Invalid
+				break
+			}
+			set("AUDIO")
+		case 0x07:
+			set("LD V%X, DT", x)
+		case 0x0A:
+			set("LD V%X, K", x)
+		case 0x15:
+			set("LD DT, V%X", x)
+		case 0x18:
+			set("LD ST, V%X", x)
+		case 0x1E:
+			set("ADD I, V%X", x)
+		case 0x29:
+			set("LD F, V%X", x)
+		case 0x30:
+			set("LD HF, V%X", x)
+		case 0x33:
+			set("LD B, V%X", x)
+		case 0x3A:
+			set("PITCH V%X", x)
+		case 0x55:
+			set("LD [I], V%X", x)
+		case 0x65:
+			set("LD V%X, [I]", x)
+		case 0x75:
+			set("LD R, V%X", x)
+		case 0x85:
+			set("LD V%X, R", x)
+		default:
+			i.Flow = Invalid
+		}
+	}
+
+	if i.Flow == Invalid {
+		i.Target = -1
+		set("DW #%04X", code)
+	}
+	return i
+}
@@ -0,0 +1,143 @@
+package disasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	testCases := map[string]struct {
+		code   []byte
+		want   string
+		flow   Flow
+		target int
+	}{
+		"clear_screen":    {code: []byte{0x00, 0xE0}, want: "CLS", flow: Next, target: -1},
+		"return":          {code: []byte{0x00, 0xEE}, want: "RET", flow: Return, target: -1},
+		"scroll_down":     {code: []byte{0x00, 0xC4}, want: "SCD 4", flow: Next, target: -1},
+		"exit":            {code: []byte{0x00, 0xFD}, want: "EXIT", flow: Exit, target: -1},
+		"jump":            {code: []byte{0x12, 0xA4}, want: "JP #2A4", flow: Jump, target: 0x2A4},
+		"call":            {code: []byte{0x23, 0x00}, want: "CALL #300", flow: Call, target: 0x300},
+		"skip_equal":      {code: []byte{0x31, 0x0F}, want: "SE V1, #0F", flow: Skip, target: -1},
+		"skip_registers":  {code: []byte{0x91, 0x20}, want: "SNE V1, V2", flow: Skip, target: -1},
+		"save_range":      {code: []byte{0x51, 0x32}, want: "SAVE V1, V3", flow: Next, target: -1},
+		"copy_register":   {code: []byte{0x81, 0x20}, want: "LD V1, V2", flow: Next, target: -1},
+		"or":              {code: []byte{0x81, 0x21}, want: "OR V1, V2", flow: Next, target: -1},
+		"and":             {code: []byte{0x81, 0x22}, want: "AND V1, V2", flow: Next, target: -1},
+		"xor":             {code: []byte{0x81, 0x23}, want: "XOR V1, V2", flow: Next, target: -1},
+		"add_registers":   {code: []byte{0x81, 0x24}, want: "ADD V1, V2", flow: Next, target: -1},
+		"subtract":        {code: []byte{0x81, 0x25}, want: "SUB V1, V2", flow: Next, target: -1},
+		"load_index":      {code: []byte{0xA3, 0x10}, want: "LD I, #310", flow: Next, target: 0x310},
+		"indirect_jump":   {code: []byte{0xB3, 0x00}, want: "JP V0, #300", flow: IndirectJump, target: -1},
+		"draw":            {code: []byte{0xD1, 0x25}, want: "DRW V1, V2, 5", flow: Next, target: -1},
+		"skip_not_key":    {code: []byte{0xE3, 0xA1}, want: "SKNP V3", flow: Skip, target: -1},
+		"long_load":       {code: []byte{0xF0, 0x00, 0x12, 0x34}, want: "LD I, LONG #1234", flow: Next, target: 0x1234},
+		"wait_key":        {code: []byte{0xF4, 0x0A}, want: "LD V4, K", flow: Next, target: -1},
+		"bcd":             {code: []byte{0xF4, 0x33}, want: "LD B, V4", flow: Next, target: -1},
+		"machine_routine": {code: []byte{0x02, 0x34}, want: "DW #0234", flow: Invalid, target: -1},
+		"unknown_math":    {code: []byte{0x81, 0x28}, want: "DW #8128", flow: Invalid, target: -1},
+		"zero":            {code: []byte{0x00, 0x00}, want: "DW #0000", flow: Invalid, target: -1},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			i := Decode(test.code, 0)
+			assert.Equal(t, test.want, i.String())
+			assert.Equal(t, test.flow, i.Flow)
+			assert.Equal(t, test.target, i.Target)
+			assert.Equal(t, len(test.code), i.Size)
+		})
+	}
+}
+
+func TestLine(t *testing.T) {
+	mem := []byte{0x00, 0x00, 0x60, 0x05}
+	assert.Equal(t, "0002\t6005\tLD V0, #05", Line(mem, 2))
+}
+
+func TestDisassemble(t *testing.T) {
+	rom := []byte{
+		0x22, 0x0A, // 200: CALL 20A
+		0xA2, 0x10, // 202: LD I, 210
+		0x3F, 0x01, // 204: SE VF, 1
+		0x12, 0x02, // 206: JP 202
+		0x00, 0xFD, // 208: EXIT
+		0x60, 0x05, // 20A: LD V0, 5
+		0xD0, 0x02, // 20C: DRW V0, V0, 2
+		0x00, 0xEE, // 20E: RET
+		0xF0, 0x90, // 210: sprite
+		0x00, 0x00, // 212: never executed
+	}
+	p := Disassemble(rom, 0x200)
+
+	want := `	CALL sub_20A
+L202:
+	LD I, data_210
+	SE VF, #01
+	JP L202
+	EXIT
+sub_20A:
+	LD V0, #05
+	DRW V0, V0, 2
+	RET
+data_210:
+	DB #F0, #90, #00, #00
+`
+	var b bytes.Buffer
+	n, err := p.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, want, b.String())
+	assert.Equal(t, int64(len(want)), n)
+
+	_, ok := p.Instruction(0x210)
+	assert.False(t, ok)
+	assert.Equal(t, []int{0x200, 0x202, 0x204, 0x206, 0x208, 0x20A, 0x20C, 0x20E}, p.Addresses())
+}
+
+func TestDisassembleSkipsLongLoad(t *testing.T) {
+	rom := []byte{
+		0x30, 0x00, // 200: SE V0, 0
+		0xF0, 0x00, 0x02, 0x08, // 202: LD I, LONG 208
+		0x12, 0x06, // 206: JP 206
+		0x01, 0x02, // 208: data
+	}
+	p := Disassemble(rom, 0x200)
+	assert.Equal(t, []int{0x200, 0x202, 0x206}, p.Addresses())
+	assert.Equal(t, "data_208", p.Label(0x208))
+}
+
+func TestAnnotate(t *testing.T) {
+	rom := []byte{
+		0xA2, 0x05, // 200: LD I, 205
+		0xA2, 0x08, // 202: LD I, 208
+		0x60, 0x05, // 204: LD V0, 5
+		0x12, 0x06, // 206: JP 206
+	}
+	p := Disassemble(rom, 0x200)
+	table := symbols.New()
+	table.AddLabel(0x200, "main")
+	table.AddLabel(0x204, "set")
+	// Labels inside of an instruction and past the end of the rom.
+	table.AddLabel(0x205, "target")
+	table.AddLabel(0x208, "buf")
+	table.AddLine(0x204, symbols.Line{File: "t.8o", Line: 4, Text: ":next target v0 := 5"})
+	p.Annotate(table)
+
+	want := `main:
+	LD I, set+1
+	LD I, #208
+set:
+	LD V0, #05	; t.8o:4: :next target v0 := 5
+L206:
+	JP L206
+`
+	var b bytes.Buffer
+	_, err := p.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, want, b.String())
+	assert.Equal(t, "", p.Label(0x205))
+}
@@ -0,0 +1,308 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// dataPerLine is the number of bytes in a DB line.
+const dataPerLine = 8
+
+// Program is a disassembled program. Code is found by following the control
+// flow from the entry point, bytes which are never executed are data.
+type Program struct {
+	origin int
+	rom    []byte
+	// mem is the memory with the rom loaded at origin.
+	mem []byte
+	// code holds instructions by address.
+	code map[int]Instruction
+	// owner holds the address of the instruction each rom byte belongs to or
+	// -1 for data.
+	owner  []int
+	labels map[int]string
+	// comments are printed after instructions.
+	comments map[int]string
+}
+
+// Disassemble disassembles the rom loaded at origin. Programs start at the
+// origin.
+func Disassemble(rom []byte, origin int) *Program {
+	p := &Program{
+		origin:   origin,
+		rom:      rom,
+		mem:      make([]byte, origin+len(rom)),
+		code:     make(map[int]Instruction),
+		owner:    make([]int, len(rom)),
+		labels:   make(map[int]string),
+		comments: make(map[int]string),
+	}
+	copy(p.mem[origin:], rom)
+	for k := range p.owner {
+		p.owner[k] = -1
+	}
+	p.trace(origin)
+	p.label()
+	return p
+}
+
+// Trace decodes code reachable from addr, e.g. targets of indirect jumps
+// known from the execution. Labels set with SetLabel may be replaced, so set
+// them afterwards.
+func (p *Program) Trace(addr int) {
+	p.trace(addr)
+	p.label()
+}
+
+// contains returns true if addr is in the rom.
+func (p *Program) contains(addr int) bool {
+	return addr >= p.origin && addr < p.origin+len(p.rom)
+}
+
+// trace decodes instructions reachable from the entry point.
+func (p *Program) trace(entry int) {
+	queue := []int{entry}
+	for len(queue) > 0 {
+		addr := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for p.contains(addr) {
+			if _, ok := p.code[addr]; ok {
+				break
+			}
+			i := Decode(p.mem, addr)
+			if i.Flow == Invalid || !p.claim(i) {
+				break
+			}
+			next := addr + i.Size
+			switch i.Flow {
+			case Jump:
+				queue = append(queue, i.Target)
+			case Call:
+				queue = append(queue, i.Target)
+			case Skip:
+				// The skipped instruction may be a long one.
+				skipped := Decode(p.mem, next)
+				queue = append(queue, next+maxInt(skipped.Size, 2))
+			}
+			if i.Flow == Jump || i.Flow == Return || i.Flow == IndirectJump || i.Flow == Exit {
+				break
+			}
+			addr = next
+		}
+	}
+}
+
+// claim marks bytes of the instruction as code. It returns false if they
+// overlap with another instruction.
+func (p *Program) claim(i Instruction) bool {
+	if !p.contains(i.Addr + i.Size - 1) {
+		return false
+	}
+	for k := 0; k < i.Size; k++ {
+		if p.owner[i.Addr-p.origin+k] >= 0 {
+			return false
+		}
+	}
+	for k := 0; k < i.Size; k++ {
+		p.owner[i.Addr-p.origin+k] = i.Addr
+	}
+	p.code[i.Addr] = i
+	return true
+}
+
+// boundary returns true if addr is in the rom and is not inside of an
+// instruction. Only these addresses are printed, so only they can be named.
+func (p *Program) boundary(addr int) bool {
+	if !p.contains(addr) {
+		return false
+	}
+	owner := p.owner[addr-p.origin]
+	return owner < 0 || owner == addr
+}
+
+// label names addresses referenced by instructions. Addresses inside of an
+// instruction or outside of the rom are not named.
+func (p *Program) label() {
+	for _, i := range p.code {
+		if i.Target < 0 || !p.boundary(i.Target) {
+			continue
+		}
+		owner := p.owner[i.Target-p.origin]
+		var name string
+		switch {
+		case i.Flow == Call:
+			name = fmt.Sprintf("sub_%03X", i.Target)
+		case owner < 0:
+			name = fmt.Sprintf("data_%03X", i.Target)
+		default:
+			name = fmt.Sprintf("L%03X", i.Target)
+		}
+		// Subroutine names take precedence.
+		if prev, ok := p.labels[i.Target]; !ok || !strings.HasPrefix(prev, "sub_") {
+			p.labels[i.Target] = name
+		}
+	}
+}
+
+// SetLabel names the address. It replaces the generated label.
+func (p *Program) SetLabel(addr int, name string) {
+	p.labels[addr] = name
+}
+
+// SetComment sets the comment printed after the instruction at addr.
+func (p *Program) SetComment(addr int, comment string) {
+	p.comments[addr] = comment
+}
+
+// Annotate replaces generated labels with labels of the symbol table and
+// comments instructions with their source lines. Labels inside of an
+// instruction or outside of the rom are left out, operands referencing them
+// are printed as addresses.
+func (p *Program) Annotate(t *symbols.Table) {
+	for _, addr := range t.Labels() {
+		if p.boundary(addr) {
+			p.SetLabel(addr, t.Label(addr))
+		}
+	}
+	for addr := range p.code {
+		if l, ok := t.Line(addr); ok {
+			p.SetComment(addr, l.String())
+		}
+	}
+}
+
+// Label returns the name of the address or an empty string.
+func (p *Program) Label(addr int) string {
+	return p.labels[addr]
+}
+
+// operand returns the name of the address referenced by an instruction.
+// Addresses inside of a named instruction are named with the offset from it,
+// e.g. "next+1".
+func (p *Program) operand(addr int) string {
+	if name, ok := p.labels[addr]; ok {
+		return name
+	}
+	if !p.contains(addr) {
+		return ""
+	}
+	owner := p.owner[addr-p.origin]
+	if name, ok := p.labels[owner]; ok && owner >= 0 {
+		return fmt.Sprintf("%s+%d", name, addr-owner)
+	}
+	return ""
+}
+
+// Instruction returns the instruction at addr if it is code.
+func (p *Program) Instruction(addr int) (Instruction, bool) {
+	i, ok := p.code[addr]
+	return i, ok
+}
+
+// Addresses returns addresses of instructions in ascending order.
+func (p *Program) Addresses() []int {
+	addrs := make([]int, 0, len(p.code))
+	for addr := range p.code {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	return addrs
+}
+
+// Entry is a line of the disassembly: a label, an instruction or data bytes.
+type Entry struct {
+	Addr int
+	// Label is set for labels only.
+	Label string
+	// Code is set for instructions.
+	Code bool
+	// Text is the instruction or DB directive with data bytes.
+	Text    string
+	Comment string
+}
+
+// Entries returns lines of the disassembly in order of addresses.
+func (p *Program) Entries() []Entry {
+	var entries []Entry
+	var data []string
+	flush := func(addr int) {
+		if len(data) > 0 {
+			text := "DB " + strings.Join(data, ", ")
+			entries = append(entries, Entry{Addr: addr - len(data), Text: text})
+			data = data[:0]
+		}
+	}
+	for k := 0; k < len(p.rom); {
+		addr := p.origin + k
+		if name, ok := p.labels[addr]; ok {
+			flush(addr)
+			entries = append(entries, Entry{Addr: addr, Label: name})
+		}
+		if i, ok := p.code[addr]; ok {
+			flush(addr)
+			entries = append(entries, Entry{
+				Addr:    addr,
+				Code:    true,
+				Text:    i.Format(p.operand),
+				Comment: p.comments[addr],
+			})
+			k += i.Size
+			continue
+		}
+		data = append(data, fmt.Sprintf("#%02X", p.rom[k]))
+		k++
+		if len(data) == dataPerLine {
+			flush(addr + 1)
+		}
+	}
+	flush(p.origin + len(p.rom))
+	return entries
+}
+
+// WriteTo writes the program as assembler source.
+func (p *Program) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, e := range p.Entries() {
+		switch {
+		case e.Label != "":
+			fmt.Fprintf(cw, "%s:\n", e.Label)
+		case e.Comment != "":
+			fmt.Fprintf(cw, "\t%s\t; %s\n", e.Text, e.Comment)
+		default:
+			fmt.Fprintf(cw, "\t%s\n", e.Text)
+		}
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+// countWriter counts written bytes and keeps the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,39 @@
+package display
+
+// Command is a command issued by the user with a hotkey.
+type Command int
+
+const (
+	// CommandNone means no command is issued.
+	CommandNone Command = iota
+	// CommandPause pauses the running program or continues the paused one.
+	CommandPause
+	// CommandStep executes a single instruction.
+	CommandStep
+	// CommandStepOver executes a single instruction. Subroutine calls are
+	// executed until the subroutine returns.
+	CommandStepOver
+	// CommandSaveState saves the state of the emulator to the selected slot.
+	CommandSaveState
+	// CommandLoadState loads the state of the emulator from the selected
+	// slot.
+	CommandLoadState
+	// CommandPrevSlot selects the previous save state slot.
+	CommandPrevSlot
+	// CommandNextSlot selects the next save state slot.
+	CommandNextSlot
+	// CommandRewind rewinds the program by a few frames. It is repeated
+	// while the key is held.
+	CommandRewind
+	// CommandStepBack restores the state before the last instruction of the
+	// paused program.
+	CommandStepBack
+	// CommandScreenshot saves the screen to a PNG file.
+	CommandScreenshot
+)
+
+// Controller is implemented by displays which accept hotkeys.
+type Controller interface {
+	// PollCommand returns a command issued by the user.
+	PollCommand() Command
+}
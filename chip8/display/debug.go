@@ -0,0 +1,22 @@
+package display
+
+// DebugState is the state of the CPU shown by the debugger.
+type DebugState struct {
+	Paused bool
+	// Reason describes why the program is paused.
+	Reason     string
+	PC         uint16
+	I          int
+	V          [16]byte
+	Stack      []uint16
+	DelayTimer byte
+	SoundTimer byte
+	// Code holds disassembly of instructions starting at PC.
+	Code []string
+}
+
+// DebugPanel is implemented by displays which can show the debugger.
+type DebugPanel interface {
+	// ShowDebug shows the state of the CPU.
+	ShowDebug(s DebugState)
+}
@@ -1,7 +1,11 @@
 package display
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gdamore/tcell"
@@ -11,20 +15,23 @@ const (
 	width          = 64
 	height         = 32
 	debuggerHeight = 10
+	// panelWidth is the width of the debugger panel in characters.
+	panelWidth = 32
+	// Size of character cells in pixels when the terminal does not report
+	// it.
+	defaultCellWidth  = 8
+	defaultCellHeight = 16
 )
 
-// Display defines interface of CHIP8 display.
+// Display defines interface of CHIP8 display. The display only presents
+// frames rendered by the emulator and reads the keyboard.
 type Display interface {
-	// Clear the screen.
-	Clear()
-	// Show the screen.
+	// Show the screen. It blocks until the screen is closed.
 	Show()
-	// Point draws a point at x y. Return true if any pixel is flipped from high
-	// to low.
-	Point(x, y int) bool
-	// Sprite at x, y coordinates draws a sprite which is 8 symbols width and n
-	// lines height. Return true if any pixel is flipped from high to low.
-	Sprite(x, y int, payload []byte) bool
+	// Close the screen and restore the terminal.
+	Close()
+	// Present shows the frame. The display must not modify the frame.
+	Present(f Frame)
 
 	// PollKey returns a pressed key.
 	PollKey() *rune
@@ -33,24 +40,60 @@ type Display interface {
 	Debug(line string)
 }
 
-type display struct {
-	debugLines       []string
-	s                tcell.Screen
-	keych            chan rune
-	quit             chan struct{}
-	screen           [][]int
-	sprites          chan sprite
-	bgStyle, fgStyle tcell.Style
+// Options configure the terminal display.
+type Options struct {
+	Render Render
+	// Scale enlarges pixels by an integer factor. Zero stands for 1.
+	Scale int
+	// Palette holds colours of pixels. Zero value stands for the default
+	// palette.
+	Palette Palette
+	// Graphics draws frames as bitmaps instead of character cells.
+	Graphics Graphics
 }
 
-type sprite struct {
-	x, y        int
-	payload     []byte
-	collisionch chan bool
+type display struct {
+	debugLines []string
+	s          tcell.Screen
+	keych      chan rune
+	quit       chan struct{}
+	closeOnce  sync.Once
+	// shown is set when Show starts. The screen is finalized by Show, or by
+	// Close if Show never runs.
+	shown bool
+	// colors of pixels indexed by bit planes: not set, set on the first
+	// plane, on the second plane and on both planes.
+	colors    [4]tcell.Color
+	textStyle tcell.Style
+	render    Render
+	scale     int
+	palette   Palette
+
+	// graphics draws frames as bitmaps to tty unless it is GraphicsCells.
+	// image holds escape sequences of the last drawn frame until they are
+	// written after the screen is shown. cellW and cellH are the size of
+	// character cells in pixels.
+	graphics     Graphics
+	tty          *os.File
+	image        []byte
+	cellW, cellH int
+
+	mu sync.Mutex
+	// frame is the last presented frame.
+	frame Frame
+	// redraw is signaled when a new frame is presented.
+	redraw chan struct{}
+	// debug is the last state shown with ShowDebug.
+	debug *DebugState
+	cmdch chan Command
 }
 
 // New initializes a new display
-func New() (Display, error) {
+func New(opts Options) (Display, error) {
+	if opts.Graphics == GraphicsAuto {
+		// The terminal is queried before tcell takes it over.
+		opts.Graphics = detectGraphics()
+	}
 	s, err := tcell.NewScreen()
 	if err != nil {
 		return nil, fmt.Errorf("creating screen: %v", err)
@@ -59,36 +102,88 @@ func New() (Display, error) {
 	if err != nil {
 		return nil, fmt.Errorf("initializing screen: %v", err)
 	}
-	fg := tcell.StyleDefault.Background(tcell.ColorBlack)
-	bg := tcell.StyleDefault.Background(tcell.ColorWhite)
+	if opts.Scale < 1 {
+		opts.Scale = 1
+	}
+	if opts.Palette.Name == "" {
+		opts.Palette = palettes[DefaultPalette]
+	}
 	d := &display{
 		debugLines: make([]string, 0, debuggerHeight),
 		s:          s,
-		sprites:    make(chan sprite),
+		redraw:     make(chan struct{}, 1),
 		keych:      make(chan rune, 10),
-		bgStyle:    bg,
-		fgStyle:    fg,
+		cmdch:      make(chan Command, 10),
+		quit:       make(chan struct{}),
+		colors:     opts.Palette.terminalColors(s.Colors()),
+		textStyle:  tcell.StyleDefault.Background(tcell.ColorBlack),
+		render:     opts.Render,
+		scale:      opts.Scale,
+		palette:    opts.Palette,
+		graphics:   opts.Graphics,
+		frame: Frame{
+			Width:  width,
+			Height: height,
+			Pixels: make([]byte, width*height),
+		},
+	}
+	if d.graphics != GraphicsCells {
+		d.openGraphics()
 	}
 	return d, nil
 }
 
+// openGraphics opens the terminal for writing images. The display falls back
+// to character cells if the terminal can not be opened.
+func (d *display) openGraphics() {
+	tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0)
+	if err != nil {
+		d.graphics = GraphicsCells
+		return
+	}
+	d.tty = tty
+	d.cellW, d.cellH = cellSize(tty)
+	if d.cellW == 0 || d.cellH == 0 {
+		d.cellW, d.cellH = defaultCellWidth, defaultCellHeight
+	}
+}
+
 func (d *display) Show() {
+	d.mu.Lock()
+	select {
+	case <-d.quit:
+		// The screen is finalized by Close.
+		d.mu.Unlock()
+		return
+	default:
+	}
+	d.shown = true
+	d.mu.Unlock()
+
 	tcell.SetEncodingFallback(tcell.EncodingFallbackASCII)
 	d.s.SetStyle(tcell.StyleDefault.
 		Foreground(tcell.ColorWhite).
 		Background(tcell.ColorBlack))
 
-	d.quit = make(chan struct{})
 	go func() {
 		for {
 			ev := d.s.PollEvent()
 			switch ev := ev.(type) {
+			case nil:
+				// Screen is finalized.
+				return
 			case *tcell.EventKey:
 				if ev.Key() == tcell.KeyCtrlC ||
 					ev.Key() == tcell.KeyEscape {
-					close(d.quit)
+					d.Close()
 					return
 				}
+				if cmd, ok := commandKeys[ev.Key()]; ok {
+					select {
+					case d.cmdch <- cmd:
+					default:
+					}
+				}
 				keys := []rune{
 					'1', '2', '3', '4',
 					'q', 'w', 'e', 'r',
@@ -104,102 +199,236 @@ func (d *display) Show() {
 				}
 			case *tcell.EventResize:
 				d.s.Sync()
+				// Images are erased by the terminal.
+				select {
+				case d.redraw <- struct{}{}:
+				default:
+				}
 			}
 		}
 	}()
 
-	d.Clear()
-	d.s.Show()
+	d.drawFrame()
+	d.show()
 loop:
 	for {
 		select {
 		case <-d.quit:
 			break loop
-		case sp := <-d.sprites:
-			d.drawSprite(sp)
+		case <-d.redraw:
+			d.drawFrame()
 		case <-time.After(time.Millisecond * 50):
 		}
-		d.s.Show()
+		d.show()
 
 	}
+	d.fini()
+}
+
+// fini restores the terminal.
+func (d *display) fini() {
+	if d.graphics == GraphicsKitty {
+		d.tty.WriteString(kittyDelete)
+	}
 	d.s.Fini()
+	if d.tty != nil {
+		d.tty.Close()
+	}
+}
+
+// show updates the screen and writes the image of the last drawn frame over
+// it.
+func (d *display) show() {
+	d.s.Show()
+	if d.image != nil {
+		d.tty.Write(d.image)
+		d.image = nil
+	}
 }
 
-func (d *display) setContent(x int, y int, mainc rune, combc []rune, style tcell.Style) {
+func (d *display) setContent(w, h int, x int, y int, mainc rune, combc []rune, style tcell.Style) {
 	dw, dh := d.s.Size()
-	_y := dh/2 - height/2
-	_x := dw/2 - width/2
+	_y := dh/2 - h/2
+	_x := dw/2 - w/2
 	d.s.SetContent(_x+x, _y+y, mainc, combc, style)
 }
 
-func (d *display) isSetContent(x int, y int) bool {
-	dw, dh := d.s.Size()
-	_y := dh/2 - height/2
-	_x := dw/2 - width/2
-	_, _, style, _ := d.s.GetContent(_x+x, _y+y)
-	return style == d.getStyle(1)
+// drawFrame draws the last presented frame in the middle of the terminal and
+// the debugger panel next to it.
+func (d *display) drawFrame() {
+	d.mu.Lock()
+	f := d.frame
+	debug := d.debug
+	d.mu.Unlock()
+
+	var w, h int
+	if d.graphics != GraphicsCells {
+		w, h = d.drawImage(f)
+	} else {
+		w, h = d.drawCells(f)
+	}
+	if debug != nil {
+		d.drawPanel(w, h, debug)
+	}
 }
 
-func (d *display) DrawScreen(w, h int) {
+// drawCells draws the frame with character cells of the render. It returns
+// the size of the frame in cells.
+func (d *display) drawCells(f Frame) (w, h int) {
+	w, h, cells := d.render.cells(f, d.scale)
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
-			d.setContent(x, y, ' ', nil, d.bgStyle)
+			c := cells[y*w+x]
+			d.setContent(w, h, x, y, c.r, nil, d.style(c))
 		}
 	}
+	return w, h
 }
 
-func (d *display) getStyle(b byte) tcell.Style {
-	st := map[byte]tcell.Style{
-		0: d.bgStyle,
-		1: d.fgStyle,
+// drawImage clears cells under the frame and prepares the bitmap of the frame
+// to be written when the screen is shown. Pixels are as large as with
+// RenderHalf. It returns the size of the frame in cells.
+func (d *display) drawImage(f Frame) (w, h int) {
+	px := d.scale * d.cellH / 2
+	if px < 1 {
+		px = 1
 	}
-
-	return st[b]
+	img := f.Image(d.palette, px)
+	w = (img.Rect.Dx() + d.cellW - 1) / d.cellW
+	h = (img.Rect.Dy() + d.cellH - 1) / d.cellH
+	style := tcell.StyleDefault.Background(d.colors[0])
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d.setContent(w, h, x, y, ' ', nil, style)
+		}
+	}
+	dw, dh := d.s.Size()
+	var buf bytes.Buffer
+	if err := d.graphics.writeImage(&buf, img, dw/2-w/2, dh/2-h/2, w, h); err == nil {
+		d.image = buf.Bytes()
+	}
+	return w, h
 }
 
-func (d *display) drawSprite(s sprite) {
-	const spriteWidth = 8
-	collision := false
-
-	for row := 0; row < len(s.payload); row++ {
-		for i := spriteWidth - 1; i >= 0; i-- {
-			pixel := (s.payload[row] >> i) & 0x1
-			x := s.x + spriteWidth - i
-			y := s.y + row
-			if x < 0 || x >= width || y < 0 || y >= height {
-				continue
-			}
-			if collision == false {
-				set := d.isSetContent(x, y)
-				if set == true && pixel == 1 {
-					collision = true
-				}
+// drawPanel draws the debugger panel on the right side of the screen.
+func (d *display) drawPanel(w, h int, s *DebugState) {
+	style := tcell.StyleDefault.
+		Foreground(tcell.ColorWhite).
+		Background(tcell.ColorBlack)
+	for y, line := range panelLines(s) {
+		if y >= h {
+			break
+		}
+		runes := []rune(line)
+		for x := 0; x < panelWidth; x++ {
+			r := ' '
+			if x < len(runes) {
+				r = runes[x]
 			}
-			d.setContent(x, y, ' ', nil, d.getStyle(pixel))
+			d.setContent(w, h, w+2+x, y, r, nil, style)
 		}
 	}
-	s.collisionch <- collision
 }
 
-func (d *display) Point(x, y int) bool {
-	var point byte
-	point = 1 << 7
-	ch := make(chan bool)
-	sp := sprite{x, y, []byte{point}, ch}
-	d.sprites <- sp
-	return <-sp.collisionch
+// panelLines formats the state of the debugger.
+func panelLines(s *DebugState) []string {
+	status := "RUNNING"
+	if s.Paused {
+		status = "PAUSED: " + s.Reason
+	}
+	lines := []string{
+		status,
+		fmt.Sprintf("PC: %04X  I: %04X", s.PC, s.I),
+		fmt.Sprintf("DT: %02X    ST: %02X", s.DelayTimer, s.SoundTimer),
+	}
+	for i := 0; i < len(s.V); i += 4 {
+		lines = append(lines, fmt.Sprintf("V%X: %02X V%X: %02X V%X: %02X V%X: %02X",
+			i, s.V[i], i+1, s.V[i+1], i+2, s.V[i+2], i+3, s.V[i+3]))
+	}
+	stack := "Stack:"
+	for i := len(s.Stack) - 1; i >= 0; i-- {
+		stack += fmt.Sprintf(" %04X", s.Stack[i])
+	}
+	lines = append(lines, stack, "")
+	for i, code := range s.Code {
+		marker := "  "
+		if i == 0 {
+			marker = "> "
+		}
+		lines = append(lines, marker+strings.Replace(code, "\t", " ", -1))
+	}
+	lines = append(lines, "", "F8 pause/continue  F7 step back", "F10 step over  F11 step", "F12 screenshot")
+	return lines
 }
 
-func (d *display) Sprite(x, y int, payload []byte) bool {
-	ch := make(chan bool)
-	sp := sprite{x - 1, y, payload, ch}
-	d.sprites <- sp
-	return <-sp.collisionch
+// commandKeys maps hotkeys to commands.
+var commandKeys = map[tcell.Key]Command{
+	tcell.KeyBackspace:  CommandRewind,
+	tcell.KeyBackspace2: CommandRewind,
+	tcell.KeyF2:         CommandPrevSlot,
+	tcell.KeyF3:         CommandNextSlot,
+	tcell.KeyF5:         CommandSaveState,
+	tcell.KeyF7:         CommandStepBack,
+	tcell.KeyF8:         CommandPause,
+	tcell.KeyF9:         CommandLoadState,
+	tcell.KeyF10:        CommandStepOver,
+	tcell.KeyF11:        CommandStep,
+	tcell.KeyF12:        CommandScreenshot,
 }
 
-func (d *display) Clear() {
-	d.s.Clear()
-	d.DrawScreen(width, height)
+func (d *display) PollCommand() Command {
+	select {
+	case cmd := <-d.cmdch:
+		return cmd
+	default:
+		return CommandNone
+	}
+}
+
+func (d *display) ShowDebug(s DebugState) {
+	d.mu.Lock()
+	d.debug = &s
+	d.mu.Unlock()
+
+	select {
+	case d.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// style returns the style of the cell with colours of its pixels.
+func (d *display) style(c cell) tcell.Style {
+	return tcell.StyleDefault.
+		Foreground(d.colors[c.fg&3]).
+		Background(d.colors[c.bg&3])
+}
+
+func (d *display) Close() {
+	d.closeOnce.Do(func() {
+		d.mu.Lock()
+		close(d.quit)
+		shown := d.shown
+		d.mu.Unlock()
+		if !shown {
+			// Show is not running, so it can not restore the terminal.
+			d.fini()
+		}
+	})
+}
+
+func (d *display) Present(f Frame) {
+	d.mu.Lock()
+	if f.Width != d.frame.Width || f.Height != d.frame.Height {
+		// Remove the previous frame when resolution changes.
+		d.s.Clear()
+	}
+	d.frame = f
+	d.mu.Unlock()
+
+	select {
+	case d.redraw <- struct{}{}:
+	default:
+	}
 }
 
 func (d *display) PollKey() *rune {
@@ -222,6 +451,6 @@ func (d *display) Debug(line string) {
 	}
 
 	for i, l := range d.debugLines {
-		d.s.SetContent(0, i, ' ', []rune(l), d.fgStyle)
+		d.s.SetContent(0, i, ' ', []rune(l), d.textStyle)
 	}
 }
@@ -0,0 +1,49 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPanelLines(t *testing.T) {
+	s := &DebugState{
+		Paused:     true,
+		Reason:     "breakpoint 0204",
+		PC:         0x204,
+		I:          0x300,
+		Stack:      []uint16{0x202, 0x20A},
+		DelayTimer: 0x10,
+		Code:       []string{"0204\t6107\tLD V1, 7", "0206\t1206\tJMP #206"},
+	}
+	s.V[0xA] = 0xFF
+
+	lines := panelLines(s)
+	assert.Equal(t, "PAUSED: breakpoint 0204", lines[0])
+	assert.Equal(t, "PC: 0204  I: 0300", lines[1])
+	assert.Equal(t, "DT: 10    ST: 00", lines[2])
+	assert.Equal(t, "V8: 00 V9: 00 VA: FF VB: 00", lines[5])
+	assert.Equal(t, "Stack: 020A 0202", lines[7])
+	assert.Equal(t, "> 0204 6107 LD V1, 7", lines[9])
+	assert.Equal(t, "  0206 1206 JMP #206", lines[10])
+
+	s.Paused = false
+	assert.Equal(t, "RUNNING", panelLines(s)[0])
+}
+
+func TestCloseBeforeShow(t *testing.T) {
+	s := tcell.NewSimulationScreen("")
+	require.NoError(t, s.Init())
+	s.SetSize(80, 25)
+	d := &display{s: s, quit: make(chan struct{})}
+
+	// The screen is finalized when Show never runs, e.g. the rom fails to
+	// load.
+	d.Close()
+	w, h := s.Size()
+	assert.Zero(t, w)
+	assert.Zero(t, h)
+	d.Show()
+}
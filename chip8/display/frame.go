@@ -0,0 +1,18 @@
+package display
+
+// Frame is a snapshot of the emulator screen.
+type Frame struct {
+	Width, Height int
+	// Pixels holds bit planes of every pixel row by row. Zero stands for
+	// pixel which is not set. Original CHIP-8 programs use only the first
+	// plane.
+	Pixels []byte
+}
+
+// Pixel returns bit planes of the pixel at x, y.
+func (f Frame) Pixel(x, y int) byte {
+	if x < 0 || x >= f.Width || y < 0 || y >= f.Height {
+		return 0
+	}
+	return f.Pixels[y*f.Width+x]
+}
@@ -0,0 +1,206 @@
+package display
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Graphics is a protocol of drawing bitmaps in the terminal.
+type Graphics int
+
+// Graphics protocols of the terminal display.
+const (
+	// GraphicsCells draws pixels with character cells of the render.
+	GraphicsCells Graphics = iota
+	// GraphicsAuto detects the protocol supported by the terminal and falls
+	// back to character cells.
+	GraphicsAuto
+	// GraphicsSixel draws frames with DEC Sixel graphics.
+	GraphicsSixel
+	// GraphicsKitty draws frames with Kitty graphics protocol.
+	GraphicsKitty
+)
+
+var graphicsNames = map[string]Graphics{
+	"cells": GraphicsCells,
+	"auto":  GraphicsAuto,
+	"sixel": GraphicsSixel,
+	"kitty": GraphicsKitty,
+}
+
+// ParseGraphics returns the graphics protocol by its name: cells, auto, sixel
+// or kitty.
+func ParseGraphics(name string) (Graphics, error) {
+	g, ok := graphicsNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown graphics %q", name)
+	}
+	return g, nil
+}
+
+// ttyPath is the terminal the display draws to. tcell uses it too.
+const ttyPath = "/dev/tty"
+
+// graphicsQuery asks the terminal whether it supports Kitty graphics and for
+// primary device attributes, which list Sixel support. Every terminal answers
+// device attributes, so the reply ends with them.
+const graphicsQuery = "\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\\x1b[c"
+
+// deviceAttributes matches the reply to the primary device attributes query.
+var deviceAttributes = regexp.MustCompile(`\x1b\[\?([0-9;]*)c`)
+
+// detectGraphics queries the terminal for supported graphics protocols. It
+// returns GraphicsCells if the terminal supports none or does not reply.
+func detectGraphics() Graphics {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return GraphicsCells
+	}
+	defer tty.Close()
+	reply, err := queryTerminal(tty, graphicsQuery, deviceAttributes.Match)
+	if err != nil {
+		return GraphicsCells
+	}
+	return parseGraphicsReply(reply)
+}
+
+// parseGraphicsReply returns the best protocol the terminal replied to
+// graphicsQuery with. Kitty graphics are preferred to Sixel.
+func parseGraphicsReply(reply []byte) Graphics {
+	if bytes.Contains(reply, []byte("\x1b_Gi=31;OK\x1b\\")) {
+		return GraphicsKitty
+	}
+	m := deviceAttributes.FindSubmatch(reply)
+	if m == nil {
+		return GraphicsCells
+	}
+	for _, attr := range strings.Split(string(m[1]), ";") {
+		if attr == "4" {
+			return GraphicsSixel
+		}
+	}
+	return GraphicsCells
+}
+
+// writeImage writes escape sequences which draw the image with its top left
+// corner at the cell x, y. cols and rows is the size of the image in cells.
+// The cursor is restored afterwards, so tcell keeps track of it.
+func (g Graphics) writeImage(w io.Writer, img *image.Paletted, x, y, cols, rows int) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "\x1b7\x1b[%d;%dH", y+1, x+1)
+	var err error
+	switch g {
+	case GraphicsSixel:
+		err = writeSixel(b, img)
+	case GraphicsKitty:
+		err = writeKitty(b, img, cols, rows)
+	}
+	if err != nil {
+		return err
+	}
+	b.WriteString("\x1b8")
+	return b.Flush()
+}
+
+// kittyChunk is the maximum size of the base64 payload of a Kitty graphics
+// command.
+const kittyChunk = 4096
+
+// writeKitty writes the image as PNG in Kitty graphics commands. The image
+// always has the same id, so every frame replaces the previous one. Replies
+// are suppressed as they would be read as keys.
+func writeKitty(w *bufio.Writer, img *image.Paletted, cols, rows int) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	payload := base64.StdEncoding.EncodeToString(buf.Bytes())
+	first := true
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > kittyChunk {
+			n = kittyChunk
+		}
+		more := 0
+		if n < len(payload) {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(w, "\x1b_Ga=T,f=100,i=1,q=2,C=1,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, payload[:n])
+			first = false
+		} else {
+			fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, payload[:n])
+		}
+		payload = payload[n:]
+	}
+	return nil
+}
+
+// kittyDelete deletes images of the display from the terminal memory.
+const kittyDelete = "\x1b_Ga=d,d=I,i=1,q=2\x1b\\"
+
+// writeSixel writes the image in DEC Sixel format. Every band of six rows is
+// drawn with a pass for each colour present in the band.
+func writeSixel(w *bufio.Writer, img *image.Paletted) error {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	fmt.Fprintf(w, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range img.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/0xFFFF, g*100/0xFFFF, b*100/0xFFFF)
+	}
+	sixels := make([]byte, width)
+	for y := 0; y < height; y += 6 {
+		first := true
+		for i := range img.Palette {
+			used := false
+			for x := 0; x < width; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && y+dy < height; dy++ {
+					if int(img.Pix[(y+dy)*img.Stride+x]) == i {
+						bits |= 1 << uint(dy)
+					}
+				}
+				sixels[x] = '?' + bits
+				used = used || bits != 0
+			}
+			if !used {
+				continue
+			}
+			if !first {
+				w.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(w, "#%d", i)
+			writeSixelRuns(w, sixels)
+		}
+		w.WriteByte('-')
+	}
+	_, err := w.WriteString("\x1b\\")
+	return err
+}
+
+// writeSixelRuns writes sixels compressed with repeat introducers.
+func writeSixelRuns(w *bufio.Writer, sixels []byte) {
+	for x := 0; x < len(sixels); {
+		n := 1
+		for x+n < len(sixels) && sixels[x+n] == sixels[x] {
+			n++
+		}
+		if n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, sixels[x])
+		} else {
+			for k := 0; k < n; k++ {
+				w.WriteByte(sixels[x])
+			}
+		}
+		x += n
+	}
+}
@@ -0,0 +1,71 @@
+package display
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGraphicsReply(t *testing.T) {
+	testCases := map[string]struct {
+		reply string
+		want  Graphics
+	}{
+		"kitty":         {reply: "\x1b_Gi=31;OK\x1b\\\x1b[?62;22c", want: GraphicsKitty},
+		"kitty_error":   {reply: "\x1b_Gi=31;ENOTSUPPORTED\x1b\\\x1b[?62;22c", want: GraphicsCells},
+		"sixel":         {reply: "\x1b[?62;4;6;22c", want: GraphicsSixel},
+		"sixel_last":    {reply: "\x1b[?64;1;2;4c", want: GraphicsSixel},
+		"no_sixel":      {reply: "\x1b[?62;44;6c", want: GraphicsCells},
+		"no_reply":      {reply: "", want: GraphicsCells},
+		"kitty_and_dec": {reply: "\x1b_Gi=31;OK\x1b\\\x1b[?62;4c", want: GraphicsKitty},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.want, parseGraphicsReply([]byte(test.reply)))
+		})
+	}
+}
+
+func TestWriteSixel(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	img := frame("10000", "10000").Image(palettes["contrast"], 1)
+	require.NoError(t, writeSixel(w, img))
+	require.NoError(t, w.Flush())
+
+	assert.Equal(t, "\x1bP0;1;0q\"1;1;5;2"+
+		"#0;2;0;0;0#1;2;100;100;100#2;2;100;100;0#3;2;0;100;100"+
+		"#0?!4B$#1B!4?-\x1b\\", buf.String())
+}
+
+func TestWriteKitty(t *testing.T) {
+	var buf bytes.Buffer
+	img := frame("1111", "0000").Image(palettes["classic"], 64)
+	require.NoError(t, GraphicsKitty.writeImage(&buf, img, 2, 3, 32, 8))
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "\x1b7\x1b[4;3H\x1b_Ga=T,f=100,i=1,q=2,C=1,c=32,r=8,m="))
+	assert.True(t, strings.HasSuffix(out, "\x1b\\\x1b8"))
+
+	// Payload of chunked commands is the PNG image.
+	var payload string
+	for _, cmd := range strings.Split(out, "\x1b_G")[1:] {
+		cmd = strings.TrimSuffix(cmd, "\x1b8")
+		cmd = strings.TrimSuffix(cmd, "\x1b\\")
+		chunk := cmd[strings.Index(cmd, ";")+1:]
+		assert.True(t, len(chunk) <= kittyChunk)
+		payload += chunk
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	require.NoError(t, err)
+	decoded, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 256, decoded.Bounds().Dx())
+	assert.Equal(t, 128, decoded.Bounds().Dy())
+}
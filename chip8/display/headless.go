@@ -0,0 +1,111 @@
+package display
+
+import (
+	"strings"
+	"sync"
+)
+
+// Headless is an in-memory display. It does not output anything, but keeps
+// the last presented frame, so it can be used in tests and automation to
+// inspect the screen.
+type Headless struct {
+	mu    sync.Mutex
+	frame Frame
+	keys  []rune
+
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHeadless initializes a new headless display.
+func NewHeadless() *Headless {
+	return &Headless{
+		frame: Frame{
+			Width:  width,
+			Height: height,
+			Pixels: make([]byte, width*height),
+		},
+		quit: make(chan struct{}),
+	}
+}
+
+// Show blocks until the display is closed.
+func (d *Headless) Show() {
+	<-d.quit
+}
+
+// Close the display.
+func (d *Headless) Close() {
+	d.closeOnce.Do(func() {
+		close(d.quit)
+	})
+}
+
+// Present stores the frame.
+func (d *Headless) Present(f Frame) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frame = f
+}
+
+// Frame returns the last presented frame.
+func (d *Headless) Frame() Frame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.frame
+}
+
+// PressKey queues a key to be returned by PollKey.
+func (d *Headless) PressKey(key rune) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = append(d.keys, key)
+}
+
+// PollKey returns a key queued with PressKey.
+func (d *Headless) PollKey() *rune {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.keys) == 0 {
+		return nil
+	}
+	key := d.keys[0]
+	d.keys = d.keys[1:]
+	return &key
+}
+
+// Debug discards debug information.
+func (d *Headless) Debug(line string) {}
+
+// Size returns resolution of the screen.
+func (d *Headless) Size() (w, h int) {
+	f := d.Frame()
+	return f.Width, f.Height
+}
+
+// Pixel returns true if the pixel at x, y is set on any plane.
+func (d *Headless) Pixel(x, y int) bool {
+	return d.Planes(x, y) != 0
+}
+
+// Planes returns bit planes of the pixel at x, y.
+func (d *Headless) Planes(x, y int) byte {
+	return d.Frame().Pixel(x, y)
+}
+
+// String returns the screen as text. Set pixels are drawn with '#'.
+func (d *Headless) String() string {
+	f := d.Frame()
+	var b strings.Builder
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			if f.Pixel(x, y) != 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadlessPresent(t *testing.T) {
+	d := NewHeadless()
+	w, h := d.Size()
+	assert.Equal(t, 64, w)
+	assert.Equal(t, 32, h)
+	assert.False(t, d.Pixel(0, 0))
+
+	d.Present(Frame{Width: 4, Height: 2, Pixels: []byte{0, 1, 0, 0, 2, 0, 3, 0}})
+	w, h = d.Size()
+	assert.Equal(t, 4, w)
+	assert.Equal(t, 2, h)
+	assert.True(t, d.Pixel(1, 0))
+	assert.False(t, d.Pixel(0, 0))
+	assert.Equal(t, byte(0x2), d.Planes(0, 1))
+	assert.Equal(t, byte(0x3), d.Planes(2, 1))
+	assert.Equal(t, byte(0x0), d.Planes(4, 0))
+	assert.Equal(t, byte(0x0), d.Planes(-1, 0))
+}
+
+func TestHeadlessKeys(t *testing.T) {
+	d := NewHeadless()
+	assert.Nil(t, d.PollKey())
+	d.PressKey('q')
+	d.PressKey('w')
+	assert.Equal(t, 'q', *d.PollKey())
+	assert.Equal(t, 'w', *d.PollKey())
+	assert.Nil(t, d.PollKey())
+}
+
+func TestHeadlessString(t *testing.T) {
+	d := NewHeadless()
+	d.Present(Frame{Width: 4, Height: 2, Pixels: []byte{0, 0, 0, 0, 0, 1, 0, 2}})
+	assert.Equal(t, "....\n.#.#\n", d.String())
+}
@@ -0,0 +1,127 @@
+package display
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// Image returns the frame enlarged scale times with colours of the palette.
+// Colour indexes of the image are bit planes of pixels. Zero palette stands
+// for the default one.
+func (f Frame) Image(p Palette, scale int) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	if p.Name == "" {
+		p = palettes[DefaultPalette]
+	}
+	colors := make(color.Palette, len(p.Colors))
+	for i, c := range p.Colors {
+		colors[i] = c
+	}
+	img := image.NewPaletted(image.Rect(0, 0, f.Width*scale, f.Height*scale), colors)
+	for y := 0; y < f.Height*scale; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < f.Width*scale; x++ {
+			row[x] = f.Pixel(x/scale, y/scale) & 3
+		}
+	}
+	return img
+}
+
+// WritePNG writes the frame enlarged scale times to w as a PNG image.
+func WritePNG(w io.Writer, f Frame, p Palette, scale int) error {
+	return png.Encode(w, f.Image(p, scale))
+}
+
+// framesPerSecond is the rate at which GIF recorder receives frames.
+const framesPerSecond = 60
+
+// GIF records frames to an animated GIF image. Frames are kept in memory
+// until the image is written.
+type GIF struct {
+	palette Palette
+	scale   int
+	frames  []Frame
+	// ticks holds the number of 60Hz ticks each frame is shown for.
+	ticks []int
+}
+
+// NewGIF creates a GIF recorder. Frames are enlarged scale times and drawn
+// with colours of the palette.
+func NewGIF(p Palette, scale int) *GIF {
+	return &GIF{palette: p, scale: scale}
+}
+
+// Frame adds the frame shown for 1/60 of a second. Frames which do not
+// differ from the previous one extend it.
+func (g *GIF) Frame(f Frame) {
+	if n := len(g.frames); n > 0 && sameFrame(g.frames[n-1], f) {
+		g.ticks[n-1]++
+		return
+	}
+	g.frames = append(g.frames, f)
+	g.ticks = append(g.ticks, 1)
+}
+
+// Len returns the number of recorded images.
+func (g *GIF) Len() int {
+	return len(g.frames)
+}
+
+// gifMinDelay is the shortest delay viewers respect. Browsers show frames
+// with shorter delays for a tenth of a second.
+const gifMinDelay = 2
+
+// Encode writes the animated image to w. Delays are in hundredths of a
+// second, so they are rounded in a way which keeps the total time of the
+// animation exact. Frames shorter than gifMinDelay are coalesced with
+// following ones and the frame shown longest of them is written. The final
+// frame is always written.
+func (g *GIF) Encode(w io.Writer) error {
+	anim := &gif.GIF{}
+	ticks, elapsed := 0, 0
+	// best is the frame shown longest since the last written one.
+	best := -1
+	for i := range g.frames {
+		last := i == len(g.frames)-1
+		if best < 0 || g.ticks[i] >= g.ticks[best] || last {
+			best = i
+		}
+		ticks += g.ticks[i]
+		delay := ticks*100/framesPerSecond - elapsed
+		if delay < gifMinDelay && !last {
+			continue
+		}
+		elapsed += delay
+		if n := len(anim.Image); delay < gifMinDelay && n > 0 {
+			// The final frame is too short, so it takes the time from the
+			// previous one if that one stays long enough.
+			if extra := gifMinDelay - delay; anim.Delay[n-1]-extra >= gifMinDelay {
+				anim.Delay[n-1] -= extra
+			}
+		}
+		if delay < gifMinDelay {
+			delay = gifMinDelay
+		}
+		anim.Image = append(anim.Image, g.frames[best].Image(g.palette, g.scale))
+		anim.Delay = append(anim.Delay, delay)
+		best = -1
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+func sameFrame(a, b Frame) bool {
+	if a.Width != b.Width || a.Height != b.Height {
+		return false
+	}
+	for i := range a.Pixels {
+		if a.Pixels[i] != b.Pixels[i] {
+			return false
+		}
+	}
+	return true
+}
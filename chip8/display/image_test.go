@@ -0,0 +1,89 @@
+package display
+
+import (
+	"bytes"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameImage(t *testing.T) {
+	p := palettes["octo"]
+	img := frame("10", "23").Image(p, 2)
+
+	assert.Equal(t, 4, img.Bounds().Dx())
+	assert.Equal(t, 4, img.Bounds().Dy())
+	assert.Equal(t, []uint8{
+		1, 1, 0, 0,
+		1, 1, 0, 0,
+		2, 2, 3, 3,
+		2, 2, 3, 3,
+	}, img.Pix)
+	assert.Equal(t, p.Colors[2], img.At(0, 2))
+}
+
+func TestGIFDelays(t *testing.T) {
+	g := NewGIF(palettes["classic"], 1)
+	a, b := frame("10"), frame("01")
+	for _, f := range []Frame{a, b, b, b, a, a, a, a, a, b} {
+		g.Frame(f)
+	}
+	assert.Equal(t, 4, g.Len())
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Encode(&buf))
+	anim, err := gif.DecodeAll(&buf)
+	require.NoError(t, err)
+	// Frames of 1, 3, 5 and 1 ticks take 16 hundredths of a second. Short
+	// frames are coalesced with their neighbours, the final one takes its
+	// time from the previous frame.
+	assert.Equal(t, []int{6, 8, 2}, anim.Delay)
+	assert.Equal(t, uint8(1), anim.Image[0].Pix[1])
+	assert.Equal(t, uint8(1), anim.Image[1].Pix[0])
+	assert.Equal(t, uint8(1), anim.Image[2].Pix[1])
+}
+
+func TestGIFFinalFrame(t *testing.T) {
+	g := NewGIF(palettes["classic"], 1)
+	sprite, clear := frame("10"), frame("00")
+	// The sprite is shown for a second, then the screen is cleared on the
+	// last tick.
+	for i := 0; i < 60; i++ {
+		g.Frame(sprite)
+	}
+	g.Frame(clear)
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Encode(&buf))
+	anim, err := gif.DecodeAll(&buf)
+	require.NoError(t, err)
+	// 61 ticks take 101 hundredths of a second.
+	assert.Equal(t, []int{99, 2}, anim.Delay)
+	assert.Equal(t, []uint8{0, 0}, anim.Image[1].Pix)
+}
+
+func TestGIFMinDelay(t *testing.T) {
+	g := NewGIF(palettes["classic"], 1)
+	a, b := frame("10"), frame("01")
+	// Frames flip every tick for three seconds.
+	for i := 0; i < 180; i++ {
+		if i%2 == 0 {
+			g.Frame(a)
+		} else {
+			g.Frame(b)
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Encode(&buf))
+	anim, err := gif.DecodeAll(&buf)
+	require.NoError(t, err)
+	total := 0
+	for _, delay := range anim.Delay {
+		assert.True(t, delay >= gifMinDelay, "delay %d", delay)
+		total += delay
+	}
+	assert.Equal(t, 300, total)
+}
@@ -0,0 +1,155 @@
+package display
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// Palette holds colours of pixels indexed by bit planes: not set, set on the
+// first plane, on the second plane and on both planes.
+type Palette struct {
+	Name   string
+	Colors [4]color.RGBA
+}
+
+// DefaultPalette is the palette used when no other is selected.
+const DefaultPalette = "classic"
+
+// palettes are built-in palettes by their names.
+var palettes = map[string]Palette{
+	"classic":  newPalette("classic", 0xFFFFFF, 0x000000, 0xFF0000, 0x800000),
+	"green":    newPalette("green", 0x0A1A0A, 0x33FF33, 0x1E8C1E, 0xB0FFB0),
+	"amber":    newPalette("amber", 0x1A0F00, 0xFFB000, 0xB36B00, 0xFFE0A0),
+	"lcd":      newPalette("lcd", 0x9BBC0F, 0x0F380F, 0x8BAC0F, 0x306230),
+	"octo":     newPalette("octo", 0x996600, 0xFFCC00, 0xFF6600, 0x662200),
+	"contrast": newPalette("contrast", 0x000000, 0xFFFFFF, 0xFFFF00, 0x00FFFF),
+}
+
+func newPalette(name string, colors ...uint32) Palette {
+	p := Palette{Name: name}
+	for i, c := range colors {
+		p.Colors[i] = rgb(c)
+	}
+	return p
+}
+
+func rgb(c uint32) color.RGBA {
+	return color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 0xFF}
+}
+
+// PaletteNames returns names of built-in palettes in alphabetical order.
+func PaletteNames() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupPalette returns the palette by its name. Palettes defined in the file
+// at path take precedence over built-in ones. Empty path loads no file.
+func LookupPalette(name, path string) (Palette, error) {
+	if path != "" {
+		user, err := LoadPalettes(path)
+		if err != nil {
+			return Palette{}, err
+		}
+		if p, ok := user[name]; ok {
+			return p, nil
+		}
+	}
+	p, ok := palettes[name]
+	if !ok {
+		return Palette{}, fmt.Errorf("unknown palette %q", name)
+	}
+	return p, nil
+}
+
+// LoadPalettes reads the palette file at path.
+func LoadPalettes(path string) (map[string]Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPalettes(f)
+}
+
+// ReadPalettes reads palettes defined one per line with the name followed by
+// hexadecimal colours of unset pixels, the first plane, the second plane and
+// both planes:
+//
+//	# name background plane1 plane2 both
+//	ocean #001020 #33CCFF #0066AA #FFFFFF
+//
+// Colours of the second and both planes may be omitted, they are the colour
+// of the first plane then.
+func ReadPalettes(r io.Reader) (map[string]Palette, error) {
+	palettes := make(map[string]Palette)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		p, err := parsePalette(line)
+		if err != nil {
+			return nil, fmt.Errorf("palettes line %d: %v", n, err)
+		}
+		palettes[p.Name] = p
+	}
+	return palettes, s.Err()
+}
+
+func parsePalette(line string) (Palette, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 5 {
+		return Palette{}, fmt.Errorf("invalid palette %q", line)
+	}
+	p := Palette{Name: fields[0]}
+	for i, s := range fields[1:] {
+		v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+		if err != nil || len(s) != 7 || s[0] != '#' {
+			return Palette{}, fmt.Errorf("invalid colour %q", s)
+		}
+		p.Colors[i] = rgb(uint32(v))
+	}
+	for i := len(fields) - 1; i < len(p.Colors); i++ {
+		p.Colors[i] = p.Colors[1]
+	}
+	return p, nil
+}
+
+// xterm holds colours 16-255 of xterm palette. Colours 0-15 are left out as
+// terminals let users redefine them.
+var xterm = func() []tcell.Color {
+	colors := make([]tcell.Color, 0, 240)
+	for c := tcell.Color(16); c < 256; c++ {
+		colors = append(colors, c)
+	}
+	return colors
+}()
+
+// terminalColors returns colours of the palette for a terminal which shows
+// given number of colours. Terminals without true colour support get the
+// nearest colours of 256-colour palette, others get the nearest colour tcell
+// can find.
+func (p Palette) terminalColors(n int) [4]tcell.Color {
+	var colors [4]tcell.Color
+	for i, c := range p.Colors {
+		colors[i] = tcell.NewRGBColor(int32(c.R), int32(c.G), int32(c.B))
+		if n >= 256 && n < 1<<24 {
+			colors[i] = tcell.FindColor(colors[i], xterm)
+		}
+	}
+	return colors
+}
@@ -0,0 +1,69 @@
+package display
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPalettes(t *testing.T) {
+	src := `# name background plane1 plane2 both
+ocean #001020 #33CCFF #0066AA #FFFFFF
+
+mono #000000 #FFFFFF
+`
+	got, err := ReadPalettes(strings.NewReader(src))
+	require.NoError(t, err)
+	assert.Equal(t, Palette{
+		Name: "ocean",
+		Colors: [4]color.RGBA{
+			{0x00, 0x10, 0x20, 0xFF},
+			{0x33, 0xCC, 0xFF, 0xFF},
+			{0x00, 0x66, 0xAA, 0xFF},
+			{0xFF, 0xFF, 0xFF, 0xFF},
+		},
+	}, got["ocean"])
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	assert.Equal(t, [4]color.RGBA{{0, 0, 0, 0xFF}, white, white, white}, got["mono"].Colors)
+}
+
+func TestReadPalettesErrors(t *testing.T) {
+	testCases := map[string]string{
+		"no_colours":  "ocean",
+		"one_colour":  "ocean #000000",
+		"many":        "ocean #000000 #000000 #000000 #000000 #000000",
+		"no_hash":     "ocean 000000 #FFFFFF",
+		"short":       "ocean #000 #FFFFFF",
+		"not_hex":     "ocean #GG0000 #FFFFFF",
+		"second_line": "ok #000000 #FFFFFF\nbad #000000 red",
+	}
+	for name, src := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadPalettes(strings.NewReader(src))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLookupPalette(t *testing.T) {
+	p, err := LookupPalette("amber", "")
+	require.NoError(t, err)
+	assert.Equal(t, "amber", p.Name)
+
+	_, err = LookupPalette("sepia", "")
+	assert.Error(t, err)
+}
+
+func TestTerminalColors(t *testing.T) {
+	p := palettes["contrast"]
+
+	colors := p.terminalColors(1 << 24)
+	assert.Equal(t, tcell.NewRGBColor(0xFF, 0xFF, 0x00), colors[2])
+
+	colors = p.terminalColors(256)
+	assert.Equal(t, [4]tcell.Color{tcell.Color16, tcell.Color231, tcell.Color226, tcell.Color51}, colors)
+}
@@ -0,0 +1,125 @@
+package display
+
+import "fmt"
+
+// Render is a way of drawing pixels with terminal characters.
+type Render int
+
+// Renders of the terminal display.
+const (
+	// RenderBlock draws a pixel per character cell with the background
+	// colour.
+	RenderBlock Render = iota
+	// RenderHalf draws two vertical pixels per cell with ▀ and ▄, so pixels
+	// are square.
+	RenderHalf
+	// RenderBraille draws 2x4 pixels per cell with Braille patterns. A cell
+	// shows a single colour of set pixels.
+	RenderBraille
+)
+
+var renderNames = map[string]Render{
+	"block":   RenderBlock,
+	"half":    RenderHalf,
+	"braille": RenderBraille,
+}
+
+// ParseRender returns the render by its name: block, half or braille.
+func ParseRender(name string) (Render, error) {
+	r, ok := renderNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown render %q", name)
+	}
+	return r, nil
+}
+
+// cell is a character cell of the terminal. Colours are bit planes of
+// pixels.
+type cell struct {
+	r      rune
+	fg, bg byte
+}
+
+// braille holds dots of Braille patterns by the position in the cell.
+var braille = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// cells converts the frame enlarged scale times to character cells. It
+// returns the size of the screen in cells and cells row by row.
+func (r Render) cells(f Frame, scale int) (w, h int, cells []cell) {
+	if scale < 1 {
+		scale = 1
+	}
+	pixel := func(x, y int) byte {
+		return f.Pixel(x/scale, y/scale)
+	}
+	pw, ph := f.Width*scale, f.Height*scale
+	switch r {
+	case RenderHalf:
+		w, h = pw, (ph+1)/2
+	case RenderBraille:
+		w, h = (pw+1)/2, (ph+3)/4
+	default:
+		w, h = pw, ph
+	}
+
+	cells = make([]cell, 0, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c cell
+			switch r {
+			case RenderHalf:
+				c = halfBlock(pixel(x, 2*y), pixel(x, 2*y+1))
+			case RenderBraille:
+				c = brailleCell(func(dx, dy int) byte {
+					return pixel(2*x+dx, 4*y+dy)
+				})
+			default:
+				c = cell{r: ' ', bg: pixel(x, y)}
+			}
+			cells = append(cells, c)
+		}
+	}
+	return w, h, cells
+}
+
+// halfBlock returns a cell of two vertical pixels. Unset pixels are drawn with
+// the background colour when possible.
+func halfBlock(top, bottom byte) cell {
+	switch {
+	case top == bottom:
+		return cell{r: ' ', bg: top}
+	case bottom == 0:
+		return cell{r: '▀', fg: top}
+	}
+	return cell{r: '▄', fg: bottom, bg: top}
+}
+
+// brailleCell returns a cell of 2x4 pixels. Set pixels are drawn with the
+// most common colour among them.
+func brailleCell(pixel func(dx, dy int) byte) cell {
+	var counts [4]int
+	var dots rune
+	for dy := 0; dy < 4; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			if p := pixel(dx, dy); p != 0 {
+				counts[p&3]++
+				dots |= braille[dy][dx]
+			}
+		}
+	}
+	if dots == 0 {
+		return cell{r: ' '}
+	}
+	fg := byte(1)
+	for p := byte(2); p < 4; p++ {
+		if counts[p] > counts[fg] {
+			fg = p
+		}
+	}
+	return cell{r: 0x2800 + dots, fg: fg}
+}
@@ -0,0 +1,104 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// frame returns a frame with pixels given as rows of digits.
+func frame(rows ...string) Frame {
+	f := Frame{Width: len(rows[0]), Height: len(rows)}
+	for _, row := range rows {
+		for _, p := range row {
+			f.Pixels = append(f.Pixels, byte(p-'0'))
+		}
+	}
+	return f
+}
+
+func TestRenderCells(t *testing.T) {
+	testCases := map[string]struct {
+		render    Render
+		frame     Frame
+		scale     int
+		wantW     int
+		wantH     int
+		wantCells []cell
+	}{
+		"block": {
+			render: RenderBlock,
+			frame:  frame("10", "02"),
+			wantW:  2,
+			wantH:  2,
+			wantCells: []cell{
+				{r: ' ', bg: 1}, {r: ' ', bg: 0},
+				{r: ' ', bg: 0}, {r: ' ', bg: 2},
+			},
+		},
+		"block_scaled": {
+			render: RenderBlock,
+			frame:  frame("10"),
+			scale:  2,
+			wantW:  4,
+			wantH:  2,
+			wantCells: []cell{
+				{r: ' ', bg: 1}, {r: ' ', bg: 1}, {r: ' ', bg: 0}, {r: ' ', bg: 0},
+				{r: ' ', bg: 1}, {r: ' ', bg: 1}, {r: ' ', bg: 0}, {r: ' ', bg: 0},
+			},
+		},
+		"half": {
+			render: RenderHalf,
+			frame:  frame("1012", "1001", "3000"),
+			wantW:  4,
+			wantH:  2,
+			wantCells: []cell{
+				{r: ' ', bg: 1}, {r: ' ', bg: 0}, {r: '▀', fg: 1}, {r: '▄', fg: 1, bg: 2},
+				{r: '▀', fg: 3}, {r: ' ', bg: 0}, {r: ' ', bg: 0}, {r: ' ', bg: 0},
+			},
+		},
+		"half_scaled": {
+			render: RenderHalf,
+			frame:  frame("1"),
+			scale:  2,
+			wantW:  2,
+			wantH:  1,
+			wantCells: []cell{
+				{r: ' ', bg: 1}, {r: ' ', bg: 1},
+			},
+		},
+		"braille": {
+			render: RenderBraille,
+			frame:  frame("100", "012", "002", "201"),
+			wantW:  2,
+			wantH:  1,
+			wantCells: []cell{
+				{r: '⡑', fg: 1}, {r: '⡆', fg: 2},
+			},
+		},
+		"braille_empty": {
+			render:    RenderBraille,
+			frame:     frame("00", "00"),
+			wantW:     1,
+			wantH:     1,
+			wantCells: []cell{{r: ' '}},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			w, h, cells := test.render.cells(test.frame, test.scale)
+			assert.Equal(t, test.wantW, w)
+			assert.Equal(t, test.wantH, h)
+			assert.Equal(t, test.wantCells, cells)
+		})
+	}
+}
+
+func TestParseRender(t *testing.T) {
+	r, err := ParseRender("braille")
+	assert.NoError(t, err)
+	assert.Equal(t, RenderBraille, r)
+
+	_, err = ParseRender("ascii")
+	assert.EqualError(t, err, `unknown render "ascii"`)
+}
@@ -0,0 +1,15 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+// +build darwin freebsd netbsd openbsd dragonfly
+
+package display
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
+
+// flushInput does nothing. TIOCFLUSH takes a pointer which IoctlSetInt can
+// not pass, so pending input is only drained by reading it.
+func flushInput(fd int) {}
@@ -0,0 +1,13 @@
+package display
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
+
+// flushInput discards data received by the terminal but not read yet.
+func flushInput(fd int) {
+	unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIFLUSH)
+}
@@ -0,0 +1,68 @@
+package display
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// openPty returns the master and the slave side of a new pseudo terminal.
+func openPty(t *testing.T) (master, slave *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("pseudo terminals are not available: %v", err)
+	}
+	fd := int(master.Fd())
+	require.NoError(t, unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0))
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	require.NoError(t, err)
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR, 0)
+	require.NoError(t, err)
+	return master, slave
+}
+
+func TestQueryTerminalDiscardsLateReply(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	go func() {
+		buf := make([]byte, len(graphicsQuery))
+		master.Read(buf)
+		time.Sleep(queryTimeout + 50*time.Millisecond)
+		master.WriteString("\x1b[?62;4c")
+	}()
+	_, err := queryTerminal(slave, graphicsQuery, deviceAttributes.Match)
+	assert.Error(t, err)
+
+	// The late reply is not left for tcell to read as keys.
+	fd := int(slave.Fd())
+	raw, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	require.NoError(t, err)
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	raw.Cc[unix.VMIN] = 0
+	raw.Cc[unix.VTIME] = 1
+	require.NoError(t, unix.IoctlSetTermios(fd, ioctlSetTermios, raw))
+	n, _ := slave.Read(make([]byte, 16))
+	assert.Zero(t, n)
+}
+
+func TestQueryTerminal(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	go func() {
+		buf := make([]byte, len(graphicsQuery))
+		master.Read(buf)
+		master.WriteString("\x1b_Gi=31;OK\x1b\\\x1b[?62;4c")
+	}()
+	reply, err := queryTerminal(slave, graphicsQuery, deviceAttributes.Match)
+	require.NoError(t, err)
+	assert.Equal(t, GraphicsKitty, parseGraphicsReply(reply))
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package display
+
+import (
+	"errors"
+	"os"
+)
+
+// queryTerminal is not supported, so graphics are never detected.
+func queryTerminal(tty *os.File, query string, done func(reply []byte) bool) ([]byte, error) {
+	return nil, errors.New("terminal queries are not supported")
+}
+
+// cellSize returns zeros as the size of cells is unknown.
+func cellSize(tty *os.File) (w, h int) {
+	return 0, 0
+}
@@ -0,0 +1,81 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package display
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// queryTimeout limits the time the terminal has to reply to a query.
+const queryTimeout = 500 * time.Millisecond
+
+// queryTerminal writes the query to the terminal in raw mode and reads the
+// reply until done returns true.
+func queryTerminal(tty *os.File, query string, done func(reply []byte) bool) ([]byte, error) {
+	fd := int(tty.Fd())
+	saved, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+	raw := *saved
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	// Reads return after a tenth of a second without input.
+	raw.Cc[unix.VMIN] = 0
+	raw.Cc[unix.VTIME] = 1
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlSetTermios, saved)
+
+	if _, err := tty.WriteString(query); err != nil {
+		return nil, err
+	}
+	var reply []byte
+	buf := make([]byte, 256)
+	deadline := time.Now().Add(queryTimeout)
+	for time.Now().Before(deadline) {
+		// Reads without input return io.EOF.
+		n, err := tty.Read(buf)
+		if err != nil && err != io.EOF {
+			return reply, err
+		}
+		reply = append(reply, buf[:n]...)
+		if done(reply) {
+			return reply, nil
+		}
+	}
+	// A late reply would be read by tcell as keys, so it is discarded before
+	// the terminal is restored.
+	discardInput(tty)
+	return reply, errors.New("terminal did not reply")
+}
+
+// discardInput reads input until the terminal is quiet for a read timeout
+// and flushes what is left in the input queue. The terminal must be in raw
+// mode with a read timeout.
+func discardInput(tty *os.File) {
+	buf := make([]byte, 256)
+	deadline := time.Now().Add(queryTimeout)
+	for time.Now().Before(deadline) {
+		if n, _ := tty.Read(buf); n == 0 {
+			break
+		}
+	}
+	flushInput(int(tty.Fd()))
+}
+
+// cellSize returns the size of a character cell of the terminal in pixels.
+// It returns zeros if the terminal does not report its size in pixels.
+func cellSize(tty *os.File) (w, h int) {
+	ws, err := unix.IoctlGetWinsize(int(tty.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0
+	}
+	return int(ws.Xpixel) / int(ws.Col), int(ws.Ypixel) / int(ws.Row)
+}
@@ -0,0 +1,397 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Pawka/chip8-emulator/chip8/audio"
+)
+
+// webClientBuffer is the number of messages queued for a page. Pages which
+// fall behind are disconnected.
+const webClientBuffer = 64
+
+// webKeys are keys accepted from pages. They are the keys of the terminal
+// display.
+const webKeys = "1234qwerasdfzxcv"
+
+// webCommands maps command names sent by pages to commands.
+var webCommands = map[string]Command{
+	"pause":      CommandPause,
+	"step":       CommandStep,
+	"step-over":  CommandStepOver,
+	"save-state": CommandSaveState,
+	"load-state": CommandLoadState,
+	"prev-slot":  CommandPrevSlot,
+	"next-slot":  CommandNextSlot,
+	"rewind":     CommandRewind,
+	"step-back":  CommandStepBack,
+	"screenshot": CommandScreenshot,
+}
+
+// Messages sent to pages. Pixels of frames are bit planes, one digit per
+// pixel row by row. Diffs hold pairs of pixel index and its bit planes.
+type (
+	webPaletteMessage struct {
+		Type   string    `json:"type"`
+		Colors [4]string `json:"colors"`
+	}
+	webFrameMessage struct {
+		Type   string `json:"type"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+		Pixels string `json:"pixels"`
+	}
+	webDiffMessage struct {
+		Type string `json:"type"`
+		Diff []int  `json:"diff"`
+	}
+	webSoundMessage struct {
+		Type string `json:"type"`
+		On   bool   `json:"on"`
+	}
+	webDebugMessage struct {
+		Type  string     `json:"type"`
+		State DebugState `json:"state"`
+	}
+)
+
+// webInput is a message sent by pages: a pressed key or a command.
+type webInput struct {
+	Type    string `json:"type"`
+	Key     string `json:"key"`
+	Command string `json:"command"`
+}
+
+// Web serves the display to browsers. Pages connect over WebSocket, get
+// differences between frames and the state of the sound timer, and send
+// keys and commands back.
+type Web struct {
+	l       net.Listener
+	srv     *http.Server
+	palette Palette
+
+	keych chan rune
+	cmdch chan Command
+
+	mu      sync.Mutex
+	frame   Frame
+	sound   bool
+	debug   *DebugState
+	clients map[*webClient]struct{}
+
+	// shown is set when Show starts. The server is closed by Show, or the
+	// listener is closed by Close if Show never runs.
+	shown     bool
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// webClient is a connected page.
+type webClient struct {
+	conn *wsConn
+	send chan []byte
+}
+
+// NewWeb starts listening at addr. Address without a host is bound to
+// localhost. Pixels are drawn with colours of the palette.
+func NewWeb(addr string, p Palette) (*Web, error) {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("web display: %v", err)
+	}
+	if p.Name == "" {
+		p = palettes[DefaultPalette]
+	}
+	w := &Web{
+		l:       l,
+		palette: p,
+		keych:   make(chan rune, 10),
+		cmdch:   make(chan Command, 10),
+		frame: Frame{
+			Width:  width,
+			Height: height,
+			Pixels: make([]byte, width*height),
+		},
+		clients: make(map[*webClient]struct{}),
+		quit:    make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", w.servePage)
+	mux.HandleFunc("/ws", w.serveWebSocket)
+	w.srv = &http.Server{Handler: mux}
+	return w, nil
+}
+
+// Addr returns the address of the server.
+func (w *Web) Addr() net.Addr {
+	return w.l.Addr()
+}
+
+// Show serves pages until the display is closed.
+func (w *Web) Show() {
+	w.mu.Lock()
+	select {
+	case <-w.quit:
+		// The listener is closed by Close.
+		w.mu.Unlock()
+		return
+	default:
+	}
+	w.shown = true
+	w.mu.Unlock()
+
+	go w.srv.Serve(w.l)
+	<-w.quit
+	w.srv.Close()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for c := range w.clients {
+		w.drop(c)
+	}
+}
+
+// Close the display.
+func (w *Web) Close() {
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		close(w.quit)
+		shown := w.shown
+		w.mu.Unlock()
+		if !shown {
+			// Show is not running, so it can not close the server.
+			w.l.Close()
+		}
+	})
+}
+
+// Present sends pixels which differ from the previous frame to pages.
+func (w *Web) Present(f Frame) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var msg interface{}
+	if f.Width != w.frame.Width || f.Height != w.frame.Height {
+		msg = frameMessage(f)
+	} else {
+		var diff []int
+		for i, p := range f.Pixels {
+			if p != w.frame.Pixels[i] {
+				diff = append(diff, i, int(p))
+			}
+		}
+		// Large changes, like clearing the screen, are sent as frames.
+		if len(diff) > len(f.Pixels)/2 {
+			msg = frameMessage(f)
+		} else if len(diff) > 0 {
+			msg = webDiffMessage{Type: "diff", Diff: diff}
+		}
+	}
+	w.frame = f
+	if msg != nil {
+		w.broadcast(msg)
+	}
+}
+
+// PollKey returns a key pressed on a page.
+func (w *Web) PollKey() *rune {
+	select {
+	case r := <-w.keych:
+		return &r
+	default:
+		return nil
+	}
+}
+
+// PollCommand returns a command issued on a page.
+func (w *Web) PollCommand() Command {
+	select {
+	case cmd := <-w.cmdch:
+		return cmd
+	default:
+		return CommandNone
+	}
+}
+
+// ShowDebug sends the state of the CPU to pages.
+func (w *Web) ShowDebug(s DebugState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.debug = &s
+	w.broadcast(webDebugMessage{Type: "debug", State: s})
+}
+
+// Debug discards debug information.
+func (w *Web) Debug(line string) {}
+
+// Audio returns the sound output which sends the state of the sound timer to
+// pages. Pages play the buzzer themselves.
+func (w *Web) Audio() audio.Audio {
+	return webAudio{w}
+}
+
+// setSound sends the state of the sound timer to pages when it changes.
+func (w *Web) setSound(on bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if on == w.sound {
+		return
+	}
+	w.sound = on
+	w.broadcast(webSoundMessage{Type: "sound", On: on})
+}
+
+// broadcast queues the message to every page. It must be called with mu
+// held.
+func (w *Web) broadcast(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	for c := range w.clients {
+		select {
+		case c.send <- b:
+		default:
+			// The page missed a message, so it would show a wrong frame.
+			w.drop(c)
+		}
+	}
+}
+
+// drop disconnects the page. It must be called with mu held.
+func (w *Web) drop(c *webClient) {
+	if _, ok := w.clients[c]; !ok {
+		return
+	}
+	delete(w.clients, c)
+	close(c.send)
+	c.conn.Close()
+}
+
+func (w *Web) servePage(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(rw, webPage)
+}
+
+func (w *Web) serveWebSocket(rw http.ResponseWriter, r *http.Request) {
+	// Pages of other sites must not control the emulator.
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			http.Error(rw, "origin not allowed", http.StatusForbidden)
+			return
+		}
+	}
+	conn, err := upgradeWebSocket(rw, r)
+	if err != nil {
+		return
+	}
+	c := &webClient{conn: conn, send: make(chan []byte, webClientBuffer)}
+	w.connect(c)
+	go c.write()
+	w.read(c)
+	w.mu.Lock()
+	w.drop(c)
+	w.mu.Unlock()
+}
+
+// connect sends the palette and the current state to the page and registers
+// it, so it gets following differences.
+func (w *Web) connect(c *webClient) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	palette := webPaletteMessage{Type: "palette"}
+	for i, col := range w.palette.Colors {
+		palette.Colors[i] = fmt.Sprintf("#%02X%02X%02X", col.R, col.G, col.B)
+	}
+	msgs := []interface{}{palette, frameMessage(w.frame), webSoundMessage{Type: "sound", On: w.sound}}
+	if w.debug != nil {
+		msgs = append(msgs, webDebugMessage{Type: "debug", State: *w.debug})
+	}
+	for _, msg := range msgs {
+		if b, err := json.Marshal(msg); err == nil {
+			c.send <- b
+		}
+	}
+	w.clients[c] = struct{}{}
+}
+
+// read reads keys and commands of the page until it disconnects.
+func (w *Web) read(c *webClient) {
+	for {
+		b, err := c.conn.readMessage()
+		if err != nil {
+			return
+		}
+		var in webInput
+		if err := json.Unmarshal(b, &in); err != nil {
+			continue
+		}
+		switch in.Type {
+		case "key":
+			if len(in.Key) == 1 && strings.Contains(webKeys, in.Key) {
+				select {
+				case w.keych <- rune(in.Key[0]):
+				default:
+				}
+			}
+		case "command":
+			if cmd, ok := webCommands[in.Command]; ok {
+				select {
+				case w.cmdch <- cmd:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// write sends queued messages to the page.
+func (c *webClient) write() {
+	for b := range c.send {
+		if err := c.conn.writeMessage(wsText, b); err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+func frameMessage(f Frame) webFrameMessage {
+	pixels := make([]byte, len(f.Pixels))
+	for i, p := range f.Pixels {
+		pixels[i] = '0' + p&3
+	}
+	return webFrameMessage{Type: "frame", Width: f.Width, Height: f.Height, Pixels: string(pixels)}
+}
+
+// webAudio sends the state of the sound timer to pages of the web display.
+type webAudio struct {
+	w *Web
+}
+
+// SetPattern is ignored, pages play the square wave.
+func (a webAudio) SetPattern(pattern []byte, pitch byte) {}
+
+// Frame sends the state of the sound timer.
+func (a webAudio) Frame(active bool) {
+	a.w.setSound(active)
+}
+
+// Close does nothing, the display is closed separately.
+func (a webAudio) Close() error {
+	return nil
+}
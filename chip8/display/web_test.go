@@ -0,0 +1,159 @@
+package display
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsClient is a minimal WebSocket client of the web display.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWeb(t *testing.T, w *Web) *wsClient {
+	conn, err := net.Dial("tcp", w.Addr().String())
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(conn, "GET /ws HTTP/1.1\r\n"+
+		"Host: "+w.Addr().String()+"\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	// The accept key of the sample nonce from RFC 6455.
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return &wsClient{t: t, conn: conn, r: r}
+}
+
+// read returns the next message decoded into a map.
+func (c *wsClient) read() map[string]interface{} {
+	var head [2]byte
+	_, err := io.ReadFull(c.r, head[:])
+	require.NoError(c.t, err)
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		_, err = io.ReadFull(c.r, ext[:])
+		require.NoError(c.t, err)
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	_, err = io.ReadFull(c.r, payload)
+	require.NoError(c.t, err)
+	var msg map[string]interface{}
+	require.NoError(c.t, json.Unmarshal(payload, &msg))
+	return msg
+}
+
+// write sends a masked text message.
+func (c *wsClient) write(msg string) {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x81, 0x80 | byte(len(msg))}
+	frame = append(frame, mask[:]...)
+	for i := 0; i < len(msg); i++ {
+		frame = append(frame, msg[i]^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(c.t, err)
+}
+
+func TestWeb(t *testing.T) {
+	w, err := NewWeb("127.0.0.1:0", palettes["amber"])
+	require.NoError(t, err)
+	go w.Show()
+	defer w.Close()
+
+	c := dialWeb(t, w)
+	defer c.conn.Close()
+	palette := c.read()
+	assert.Equal(t, "palette", palette["type"])
+	assert.Equal(t, []interface{}{"#1A0F00", "#FFB000", "#B36B00", "#FFE0A0"}, palette["colors"])
+	frame := c.read()
+	assert.Equal(t, "frame", frame["type"])
+	assert.Equal(t, float64(64), frame["width"])
+	assert.Len(t, frame["pixels"], 64*32)
+	assert.Equal(t, map[string]interface{}{"type": "sound", "on": false}, c.read())
+
+	f := Frame{Width: 64, Height: 32, Pixels: make([]byte, 64*32)}
+	f.Pixels[65] = 1
+	f.Pixels[100] = 3
+	w.Present(f)
+	assert.Equal(t, map[string]interface{}{"type": "diff", "diff": []interface{}{65.0, 1.0, 100.0, 3.0}}, c.read())
+	w.Audio().Frame(true)
+	assert.Equal(t, map[string]interface{}{"type": "sound", "on": true}, c.read())
+	w.Present(Frame{Width: 128, Height: 64, Pixels: make([]byte, 128*64)})
+	frame = c.read()
+	assert.Equal(t, "frame", frame["type"])
+	assert.Equal(t, float64(128), frame["width"])
+
+	c.write(`{"type":"key","key":"q"}`)
+	c.write(`{"type":"key","key":"p"}`)
+	c.write(`{"type":"command","command":"pause"}`)
+	var key *rune
+	for start := time.Now(); key == nil && time.Since(start) < 5*time.Second; key = w.PollKey() {
+		time.Sleep(time.Millisecond)
+	}
+	require.NotNil(t, key)
+	assert.Equal(t, 'q', *key)
+	cmd := CommandNone
+	for start := time.Now(); cmd == CommandNone && time.Since(start) < 5*time.Second; cmd = w.PollCommand() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, CommandPause, cmd)
+	assert.Nil(t, w.PollKey())
+}
+
+func TestWebPage(t *testing.T) {
+	w, err := NewWeb("127.0.0.1:0", Palette{})
+	require.NoError(t, err)
+	go w.Show()
+	defer w.Close()
+
+	resp, err := http.Get("http://" + w.Addr().String() + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `<canvas id="screen"`)
+
+	req, err := http.NewRequest("GET", "http://"+w.Addr().String()+"/ws", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestWebCloseBeforeShow(t *testing.T) {
+	w, err := NewWeb("127.0.0.1:0", Palette{})
+	require.NoError(t, err)
+
+	// The listener is closed when Show never runs, e.g. the rom fails to
+	// load.
+	w.Close()
+	_, err = net.Dial("tcp", w.Addr().String())
+	assert.Error(t, err)
+	w.Show()
+}
@@ -0,0 +1,228 @@
+package display
+
+// webPage is the page of the web display. It draws frames on a canvas, plays
+// the buzzer while the sound timer is active and sends keys and commands
+// back over WebSocket.
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CHIP-8</title>
+<style>
+body { background: #222; color: #ddd; font: 14px monospace; margin: 20px; }
+#screen { width: 768px; image-rendering: pixelated; image-rendering: crisp-edges; border: 1px solid #444; }
+#main { display: flex; gap: 20px; align-items: flex-start; }
+#keypad { display: grid; grid-template-columns: repeat(4, 48px); gap: 4px; margin-top: 10px; }
+#keypad button { height: 40px; font: inherit; }
+#commands button { font: inherit; margin: 2px; }
+#debug { white-space: pre; min-width: 260px; }
+#status { color: #888; }
+</style>
+</head>
+<body>
+<div id="main">
+<div>
+<canvas id="screen" width="64" height="32"></canvas>
+<div id="keypad"></div>
+</div>
+<div>
+<div id="commands"></div>
+<div id="debug"></div>
+<div id="status">Connecting...</div>
+</div>
+</div>
+<script>
+"use strict";
+
+// Keys of the keyboard in the layout of the CHIP-8 keypad.
+var keys = ["1", "2", "3", "4", "q", "w", "e", "r", "a", "s", "d", "f", "z", "x", "c", "v"];
+var labels = ["1", "2", "3", "C", "4", "5", "6", "D", "7", "8", "9", "E", "A", "0", "B", "F"];
+// Commands with their hotkeys, the same as in the terminal.
+var commands = [
+	["pause", "F8", "Pause"],
+	["step", "F11", "Step"],
+	["step-over", "F10", "Step over"],
+	["step-back", "F7", "Step back"],
+	["rewind", "Backspace", "Rewind"],
+	["save-state", "F5", "Save"],
+	["load-state", "F9", "Load"],
+	["prev-slot", "F2", "Prev slot"],
+	["next-slot", "F3", "Next slot"],
+	["screenshot", "F12", "Screenshot"]
+];
+
+var canvas = document.getElementById("screen");
+var ctx = canvas.getContext("2d");
+var colors = ["#FFFFFF", "#000000", "#FF0000", "#800000"];
+var width = 64, height = 32;
+var pixels = new Uint8Array(width * height);
+var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+
+function send(msg) {
+	if (ws.readyState === WebSocket.OPEN) {
+		ws.send(JSON.stringify(msg));
+	}
+}
+
+function drawPixel(i) {
+	ctx.fillStyle = colors[pixels[i]];
+	ctx.fillRect(i % width, Math.floor(i / width), 1, 1);
+}
+
+function drawFrame(msg) {
+	if (msg.width !== width || msg.height !== height) {
+		width = msg.width;
+		height = msg.height;
+		canvas.width = width;
+		canvas.height = height;
+	}
+	pixels = new Uint8Array(width * height);
+	for (var i = 0; i < pixels.length; i++) {
+		pixels[i] = msg.pixels.charCodeAt(i) - 48;
+		drawPixel(i);
+	}
+}
+
+function drawDiff(diff) {
+	for (var i = 0; i < diff.length; i += 2) {
+		pixels[diff[i]] = diff[i + 1];
+		drawPixel(diff[i]);
+	}
+}
+
+function hex(n, digits) {
+	var s = n.toString(16).toUpperCase();
+	while (s.length < digits) {
+		s = "0" + s;
+	}
+	return s;
+}
+
+function showDebug(s) {
+	var lines = [
+		s.Paused ? "PAUSED: " + s.Reason : "RUNNING",
+		"PC: " + hex(s.PC, 4) + "  I: " + hex(s.I, 4),
+		"DT: " + hex(s.DelayTimer, 2) + "    ST: " + hex(s.SoundTimer, 2)
+	];
+	for (var i = 0; i < 16; i += 4) {
+		var line = [];
+		for (var k = i; k < i + 4; k++) {
+			line.push("V" + hex(k, 1) + ": " + hex(s.V[k], 2));
+		}
+		lines.push(line.join(" "));
+	}
+	var stack = "Stack:";
+	var frames = s.Stack || [];
+	for (var j = frames.length - 1; j >= 0; j--) {
+		stack += " " + hex(frames[j], 4);
+	}
+	lines.push(stack, "");
+	(s.Code || []).forEach(function (code, n) {
+		lines.push((n === 0 ? "> " : "  ") + code.replace(/\t/g, " "));
+	});
+	document.getElementById("debug").textContent = lines.join("\n");
+}
+
+// The buzzer is a square wave. Browsers allow sound only after the user
+// interacts with the page.
+var audio = null, oscillator = null, soundOn = false;
+
+function startAudio() {
+	if (audio === null && window.AudioContext) {
+		audio = new AudioContext();
+	}
+	if (audio !== null && audio.state === "suspended") {
+		audio.resume();
+	}
+	setSound(soundOn);
+}
+
+function setSound(on) {
+	soundOn = on;
+	if (audio === null) {
+		return;
+	}
+	if (on && oscillator === null) {
+		oscillator = audio.createOscillator();
+		oscillator.type = "square";
+		oscillator.frequency.value = 440;
+		var gain = audio.createGain();
+		gain.gain.value = 0.1;
+		oscillator.connect(gain);
+		gain.connect(audio.destination);
+		oscillator.start();
+	} else if (!on && oscillator !== null) {
+		oscillator.stop();
+		oscillator = null;
+	}
+}
+
+ws.onopen = function () {
+	document.getElementById("status").textContent = "Connected";
+};
+ws.onclose = function () {
+	document.getElementById("status").textContent = "Disconnected";
+	setSound(false);
+};
+ws.onmessage = function (e) {
+	var msg = JSON.parse(e.data);
+	switch (msg.type) {
+	case "palette":
+		colors = msg.colors;
+		break;
+	case "frame":
+		drawFrame(msg);
+		break;
+	case "diff":
+		drawDiff(msg.diff);
+		break;
+	case "sound":
+		setSound(msg.on);
+		break;
+	case "debug":
+		showDebug(msg.state);
+		break;
+	}
+};
+
+var keypad = document.getElementById("keypad");
+keys.forEach(function (key, i) {
+	var b = document.createElement("button");
+	b.textContent = labels[i];
+	b.title = key;
+	b.onmousedown = function () {
+		startAudio();
+		send({type: "key", key: key});
+	};
+	keypad.appendChild(b);
+});
+
+var hotkeys = {};
+var panel = document.getElementById("commands");
+commands.forEach(function (c) {
+	hotkeys[c[1]] = c[0];
+	var b = document.createElement("button");
+	b.textContent = c[2];
+	b.title = c[1];
+	b.onclick = function () {
+		startAudio();
+		send({type: "command", command: c[0]});
+	};
+	panel.appendChild(b);
+});
+
+document.addEventListener("keydown", function (e) {
+	startAudio();
+	var key = e.key.toLowerCase();
+	if (keys.indexOf(key) >= 0 && !e.ctrlKey && !e.metaKey) {
+		send({type: "key", key: key});
+		e.preventDefault();
+	} else if (hotkeys[e.key]) {
+		send({type: "command", command: hotkeys[e.key]});
+		e.preventDefault();
+	}
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,97 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors which stop the execution of a program. They are wrapped into
+// CPUError, so use errors.Is to check for a particular failure.
+var (
+	// ErrUnknownOpcode is returned when an instruction can not be decoded.
+	ErrUnknownOpcode = errors.New("unknown opcode")
+	// ErrStackOverflow is returned when a subroutine is called with a full
+	// stack.
+	ErrStackOverflow = errors.New("stack overflow")
+	// ErrStackUnderflow is returned when returning from a subroutine with an
+	// empty stack.
+	ErrStackUnderflow = errors.New("stack underflow")
+	// ErrMemoryOutOfBounds is returned when an instruction reads or writes
+	// outside of the memory.
+	ErrMemoryOutOfBounds = errors.New("memory access out of bounds")
+	// ErrPCOutOfRange is returned when the program counter points outside of
+	// the memory.
+	ErrPCOutOfRange = errors.New("program counter out of range")
+)
+
+// CPUError describes failed instruction. It holds a snapshot of the CPU at the
+// moment of the failure.
+type CPUError struct {
+	Err    error
+	PC     uint16
+	Opcode uint16
+	// Location is the label and source line of the instruction when symbols
+	// are loaded.
+	Location string
+
+	V          [registersCount]byte
+	I          int
+	Stack      []uint16
+	DelayTimer byte
+	SoundTimer byte
+}
+
+func (e *CPUError) Error() string {
+	return fmt.Sprintf("%s at %#04x (opcode %04X)", e.Err, e.PC, e.Opcode)
+}
+
+// Unwrap returns the underlying error.
+func (e *CPUError) Unwrap() error {
+	return e.Err
+}
+
+// Report returns a human readable crash report with the state of registers.
+func (e *CPUError) Report() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CHIP-8 crashed: %s\n\n", e.Err)
+	if e.Location != "" {
+		fmt.Fprintf(&b, "At: %s\n", e.Location)
+	}
+	fmt.Fprintf(&b, "PC: %04X  Opcode: %04X  I: %04X  DT: %02X  ST: %02X\n",
+		e.PC, e.Opcode, e.I, e.DelayTimer, e.SoundTimer)
+	for i, v := range e.V {
+		fmt.Fprintf(&b, "V%X: %02X", i, v)
+		if i%8 == 7 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString("  ")
+		}
+	}
+	b.WriteString("Stack:")
+	if len(e.Stack) == 0 {
+		b.WriteString(" empty")
+	}
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, " %04X", e.Stack[i])
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// fault wraps err into CPUError with a snapshot of the current CPU state.
+func (c *chip8) fault(pc, code uint16, err error) error {
+	e := &CPUError{
+		Err:        err,
+		PC:         pc,
+		Opcode:     code,
+		I:          c.i,
+		Stack:      append([]uint16(nil), c.stack...),
+		DelayTimer: c.delayTimer,
+		SoundTimer: c.soundTimer,
+		Location:   c.location(int(pc)),
+	}
+	copy(e.V[:], c.v)
+	return e
+}
@@ -0,0 +1,114 @@
+package chip8
+
+import "github.com/Pawka/chip8-emulator/chip8/display"
+
+// framebuffer is the video memory of the emulator. Every pixel holds XO-CHIP
+// bit planes. Drawing functions take a mask of planes they affect.
+type framebuffer struct {
+	width, height int
+	pixels        []byte
+	// dirty is set when the framebuffer is changed since the last frame.
+	dirty bool
+}
+
+func newFramebuffer(w, h int) *framebuffer {
+	return &framebuffer{
+		width:  w,
+		height: h,
+		pixels: make([]byte, w*h),
+		dirty:  true,
+	}
+}
+
+// setResolution resizes the framebuffer and clears it.
+func (f *framebuffer) setResolution(w, h int) {
+	f.width = w
+	f.height = h
+	f.pixels = make([]byte, w*h)
+	f.dirty = true
+}
+
+// clear clears selected planes.
+func (f *framebuffer) clear(planes byte) {
+	for k := range f.pixels {
+		f.pixels[k] &^= planes
+	}
+	f.dirty = true
+}
+
+// pixel returns bit planes of the pixel at x, y.
+func (f *framebuffer) pixel(x, y int) byte {
+	if x < 0 || x >= f.width || y < 0 || y >= f.height {
+		return 0
+	}
+	return f.pixels[y*f.width+x]
+}
+
+// sprite XORs the sprite with selected planes at x, y. Payload holds rows of
+// spriteWidth pixels for every selected plane one after another. Pixels
+// outside of the screen are clipped or wrapped to the opposite edge. It
+// returns true if any set pixel is cleared.
+func (f *framebuffer) sprite(x, y, spriteWidth int, payload []byte, planes byte, wrap bool) bool {
+	selected := []byte{}
+	for plane := byte(1); plane < 4; plane <<= 1 {
+		if planes&plane != 0 {
+			selected = append(selected, plane)
+		}
+	}
+	if len(selected) == 0 {
+		return false
+	}
+
+	collision := false
+	rowSize := spriteWidth / 8
+	chunk := len(payload) / len(selected)
+	for k, plane := range selected {
+		data := payload[k*chunk : (k+1)*chunk]
+		for row := 0; row < len(data)/rowSize; row++ {
+			for col := 0; col < spriteWidth; col++ {
+				b := data[row*rowSize+col/8]
+				if (b>>(7-col%8))&0x1 == 0 {
+					continue
+				}
+				px, py := x+col, y+row
+				if wrap {
+					px = (px%f.width + f.width) % f.width
+					py = (py%f.height + f.height) % f.height
+				} else if px < 0 || px >= f.width || py < 0 || py >= f.height {
+					continue
+				}
+				pos := py*f.width + px
+				if f.pixels[pos]&plane != 0 {
+					collision = true
+				}
+				f.pixels[pos] ^= plane
+			}
+		}
+	}
+	f.dirty = true
+	return collision
+}
+
+// scroll moves selected planes by dx, dy pixels. Pixels scrolled in from the
+// edges are cleared.
+func (f *framebuffer) scroll(dx, dy int, planes byte) {
+	pixels := make([]byte, len(f.pixels))
+	for y := 0; y < f.height; y++ {
+		for x := 0; x < f.width; x++ {
+			pos := y*f.width + x
+			pixels[pos] = f.pixels[pos] &^ planes
+			pixels[pos] |= f.pixel(x-dx, y-dy) & planes
+		}
+	}
+	f.pixels = pixels
+	f.dirty = true
+}
+
+// frame returns a copy of the framebuffer for presenting.
+func (f *framebuffer) frame() display.Frame {
+	return display.Frame{
+		Width:  f.width,
+		Height: f.height,
+		Pixels: append([]byte(nil), f.pixels...),
+	}
+}
@@ -0,0 +1,121 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramebufferSpriteXOR(t *testing.T) {
+	f := newFramebuffer(screenWidth, screenHeight)
+
+	collision := f.sprite(2, 3, 8, []byte{0xC0, 0x80}, 0x1, false)
+	assert.False(t, collision)
+	assert.Equal(t, byte(1), f.pixel(2, 3))
+	assert.Equal(t, byte(1), f.pixel(3, 3))
+	assert.Equal(t, byte(1), f.pixel(2, 4))
+	assert.Equal(t, byte(0), f.pixel(3, 4))
+
+	collision = f.sprite(3, 3, 8, []byte{0xC0}, 0x1, false)
+	assert.True(t, collision)
+	assert.Equal(t, byte(1), f.pixel(2, 3))
+	assert.Equal(t, byte(0), f.pixel(3, 3))
+	assert.Equal(t, byte(1), f.pixel(4, 3))
+
+	// Drawing the same sprite again erases it.
+	f.sprite(3, 3, 8, []byte{0xC0}, 0x1, false)
+	assert.Equal(t, byte(1), f.pixel(3, 3))
+	assert.Equal(t, byte(0), f.pixel(4, 3))
+}
+
+func TestFramebufferSpriteIsClipped(t *testing.T) {
+	f := newFramebuffer(screenWidth, screenHeight)
+
+	assert.False(t, f.sprite(60, 31, 8, []byte{0xFF, 0xFF}, 0x1, false))
+	assert.Equal(t, byte(1), f.pixel(63, 31))
+	assert.Equal(t, byte(0), f.pixel(0, 31))
+	assert.Equal(t, byte(0), f.pixel(60, 0))
+
+	assert.False(t, f.sprite(-4, 0, 8, []byte{0xFF}, 0x1, false))
+	assert.Equal(t, byte(1), f.pixel(0, 0))
+	assert.Equal(t, byte(1), f.pixel(3, 0))
+	assert.Equal(t, byte(0), f.pixel(4, 0))
+}
+
+func TestFramebufferSpriteIsWrapped(t *testing.T) {
+	f := newFramebuffer(screenWidth, screenHeight)
+
+	assert.False(t, f.sprite(62, 31, 8, []byte{0xC0, 0x80}, 0x1, true))
+	assert.Equal(t, byte(1), f.pixel(62, 31))
+	assert.Equal(t, byte(1), f.pixel(63, 31))
+	assert.Equal(t, byte(1), f.pixel(62, 0))
+	assert.Equal(t, byte(0), f.pixel(0, 31))
+
+	assert.True(t, f.sprite(-2, 0, 8, []byte{0x80}, 0x1, true))
+	assert.Equal(t, byte(0), f.pixel(62, 0))
+}
+
+func TestFramebufferLargeSprite(t *testing.T) {
+	f := newFramebuffer(screenWidth, screenHeight)
+	f.setResolution(hiresScreenWidth, hiresScreenHeight)
+	payload := make([]byte, 32)
+	payload[0] = 0x80
+	payload[31] = 0x01
+
+	assert.False(t, f.sprite(100, 40, 16, payload, 0x1, false))
+	assert.Equal(t, byte(1), f.pixel(100, 40))
+	assert.Equal(t, byte(1), f.pixel(115, 55))
+	assert.Equal(t, 128, f.width)
+	assert.Equal(t, 64, f.height)
+}
+
+func TestFramebufferPlanes(t *testing.T) {
+	f := newFramebuffer(screenWidth, screenHeight)
+	f.sprite(0, 0, 8, []byte{0xC0, 0x80}, 0x3, false)
+	assert.Equal(t, byte(0x3), f.pixel(0, 0))
+	assert.Equal(t, byte(0x1), f.pixel(1, 0))
+
+	assert.False(t, f.sprite(1, 0, 8, []byte{0x80}, 0x2, false))
+	assert.Equal(t, byte(0x3), f.pixel(1, 0))
+	assert.True(t, f.sprite(0, 0, 8, []byte{0x80}, 0x2, false))
+	assert.Equal(t, byte(0x1), f.pixel(0, 0))
+
+	f.sprite(0, 0, 8, []byte{0x80}, 0x2, false)
+	f.clear(0x2)
+	assert.Equal(t, byte(0x1), f.pixel(0, 0))
+	assert.Equal(t, byte(0x1), f.pixel(1, 0))
+
+	assert.False(t, f.sprite(0, 0, 8, []byte{}, 0x0, false))
+}
+
+func TestFramebufferScroll(t *testing.T) {
+	f := newFramebuffer(screenWidth, screenHeight)
+	f.sprite(0, 0, 8, []byte{0x80, 0x80}, 0x3, false)
+
+	f.scroll(4, 0, 0x1)
+	assert.Equal(t, byte(0x2), f.pixel(0, 0))
+	assert.Equal(t, byte(0x1), f.pixel(4, 0))
+
+	f.scroll(0, 2, 0x1)
+	assert.Equal(t, byte(0x1), f.pixel(4, 2))
+
+	f.scroll(-4, -2, 0x1)
+	assert.Equal(t, byte(0x3), f.pixel(0, 0))
+
+	f.scroll(-1, 0, 0x3)
+	assert.Equal(t, make([]byte, len(f.pixels)), f.pixels)
+}
+
+func TestFramebufferFrame(t *testing.T) {
+	f := newFramebuffer(4, 2)
+	f.sprite(1, 1, 8, []byte{0xA0}, 0x1, false)
+
+	frame := f.frame()
+	assert.Equal(t, 4, frame.Width)
+	assert.Equal(t, 2, frame.Height)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 1, 0, 1}, frame.Pixels)
+
+	// The frame is a copy of the framebuffer.
+	f.clear(0x1)
+	assert.Equal(t, byte(1), frame.Pixel(1, 1))
+}
@@ -0,0 +1,412 @@
+// Package gdb implements GDB remote serial protocol server, so gdb, lldb and
+// their front-ends can debug CHIP-8 programs.
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrExited is returned by Target when the program exits.
+var ErrExited = errors.New("program exited")
+
+// Target is the debugged CPU. Methods are called only while the target is
+// stopped, except Continue and Step which run it.
+type Target interface {
+	Registers() Registers
+	SetRegisters(r Registers) error
+	ReadMemory(addr, n int) ([]byte, error)
+	WriteMemory(addr int, data []byte) error
+	SetBreakpoint(addr int)
+	ClearBreakpoint(addr int)
+	// Step executes a single instruction.
+	Step() error
+	// Continue runs the program until it hits a breakpoint or interrupt is
+	// signaled.
+	Continue(interrupt <-chan struct{}) error
+}
+
+// interruptByte is sent by the debugger to stop the running program.
+const interruptByte = 0x03
+
+// Server accepts debugger connections.
+type Server struct {
+	l net.Listener
+}
+
+// Listen starts listening at addr. Address without a host is bound to
+// localhost.
+func Listen(addr string) (*Server, error) {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("gdb server: %v", err)
+	}
+	return &Server{l: l}, nil
+}
+
+// Addr returns the address of the server.
+func (s *Server) Addr() net.Addr {
+	return s.l.Addr()
+}
+
+// Serve serves debugger connections one by one until the server is closed.
+func (s *Server) Serve(t Target) error {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return err
+		}
+		newSession(conn, t).run()
+		conn.Close()
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// session is a connection of a single debugger.
+type session struct {
+	t Target
+	r *bufio.Reader
+
+	mu sync.Mutex
+	w  io.Writer
+	// noAck is set when the debugger disables acknowledgments.
+	noAck bool
+
+	packets    chan string
+	interrupts chan struct{}
+	// done is closed when the session ends.
+	done chan struct{}
+}
+
+func newSession(rw io.ReadWriter, t Target) *session {
+	return &session{
+		t:          t,
+		r:          bufio.NewReader(rw),
+		w:          rw,
+		packets:    make(chan string),
+		interrupts: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// run handles packets until the connection is closed or the debugger
+// detaches.
+func (s *session) run() {
+	defer close(s.done)
+	go s.read()
+	for p := range s.packets {
+		reply, done := s.handle(p)
+		s.send(reply)
+		if done {
+			return
+		}
+	}
+}
+
+// read reads packets and interrupts from the connection.
+func (s *session) read() {
+	defer close(s.packets)
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case interruptByte:
+			select {
+			case s.interrupts <- struct{}{}:
+			default:
+			}
+		case '$':
+			p, err := s.readPacket()
+			if err != nil {
+				if err == errChecksum {
+					s.write("-")
+					continue
+				}
+				return
+			}
+			s.mu.Lock()
+			noAck := s.noAck
+			s.mu.Unlock()
+			if !noAck {
+				s.write("+")
+			}
+			// Drop interrupts sent while the program was stopped.
+			select {
+			case <-s.interrupts:
+			default:
+			}
+			select {
+			case s.packets <- p:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+var errChecksum = errors.New("invalid checksum")
+
+// readPacket reads packet data after $ and verifies its checksum.
+func (s *session) readPacket() (string, error) {
+	data, err := s.r.ReadString('#')
+	if err != nil {
+		return "", err
+	}
+	data = data[:len(data)-1]
+	cs := make([]byte, 2)
+	if _, err := io.ReadFull(s.r, cs); err != nil {
+		return "", err
+	}
+	want, err := strconv.ParseUint(string(cs), 16, 8)
+	if err != nil || byte(want) != checksum(data) {
+		return "", errChecksum
+	}
+	return unescape(data), nil
+}
+
+// send sends the packet.
+func (s *session) send(data string) {
+	data = escape(data)
+	s.write(fmt.Sprintf("$%s#%02x", data, checksum(data)))
+}
+
+func (s *session) write(data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	io.WriteString(s.w, data)
+}
+
+// handle returns reply to the packet. It returns true when the debugger
+// detaches.
+func (s *session) handle(p string) (reply string, done bool) {
+	if p == "" {
+		return "", false
+	}
+	switch p[0] {
+	case '?':
+		return "S05", false
+	case 'g':
+		return hex.EncodeToString(s.t.Registers().encode()), false
+	case 'G':
+		b, err := hex.DecodeString(p[1:])
+		if err != nil {
+			return "E01", false
+		}
+		r, err := decodeRegisters(b)
+		if err != nil {
+			return "E01", false
+		}
+		return okOrError(s.t.SetRegisters(r)), false
+	case 'p':
+		n, err := strconv.ParseUint(p[1:], 16, 8)
+		if err != nil {
+			return "E01", false
+		}
+		b, err := s.t.Registers().register(int(n))
+		if err != nil {
+			return "E01", false
+		}
+		return hex.EncodeToString(b), false
+	case 'P':
+		parts := strings.SplitN(p[1:], "=", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		n, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil {
+			return "E01", false
+		}
+		b, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return "E01", false
+		}
+		r := s.t.Registers()
+		if err := r.setRegister(int(n), b); err != nil {
+			return "E01", false
+		}
+		return okOrError(s.t.SetRegisters(r)), false
+	case 'm':
+		addr, n, err := parseAddrLen(p[1:])
+		if err != nil {
+			return "E01", false
+		}
+		b, err := s.t.ReadMemory(addr, n)
+		if err != nil {
+			return "E01", false
+		}
+		return hex.EncodeToString(b), false
+	case 'M':
+		parts := strings.SplitN(p[1:], ":", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		addr, n, err := parseAddrLen(parts[0])
+		if err != nil {
+			return "E01", false
+		}
+		b, err := hex.DecodeString(parts[1])
+		if err != nil || len(b) != n {
+			return "E01", false
+		}
+		return okOrError(s.t.WriteMemory(addr, b)), false
+	case 'Z', 'z':
+		// Only software breakpoints are supported.
+		if !strings.HasPrefix(p[1:], "0,") {
+			return "", false
+		}
+		fields := strings.Split(p[3:], ",")
+		addr, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			return "E01", false
+		}
+		if p[0] == 'Z' {
+			s.t.SetBreakpoint(int(addr))
+		} else {
+			s.t.ClearBreakpoint(int(addr))
+		}
+		return "OK", false
+	case 's':
+		return s.stopReply(s.t.Step()), false
+	case 'c':
+		return s.stopReply(s.t.Continue(s.interrupts)), false
+	case 'H':
+		return "OK", false
+	case 'D':
+		return "OK", true
+	case 'k':
+		return "", true
+	case 'q', 'Q':
+		return s.query(p), false
+	}
+	return "", false
+}
+
+// query handles general query packets.
+func (s *session) query(p string) string {
+	switch {
+	case strings.HasPrefix(p, "qSupported"):
+		return "PacketSize=4000;qXfer:features:read+;swbreak+;QStartNoAckMode+"
+	case p == "QStartNoAckMode":
+		s.mu.Lock()
+		s.noAck = true
+		s.mu.Unlock()
+		return "OK"
+	case strings.HasPrefix(p, "qXfer:features:read:target.xml:"):
+		offset, n, err := parseAddrLen(strings.TrimPrefix(p, "qXfer:features:read:target.xml:"))
+		if err != nil {
+			return "E01"
+		}
+		if offset >= len(targetXML) {
+			return "l"
+		}
+		end := offset + n
+		if end >= len(targetXML) {
+			return "l" + targetXML[offset:]
+		}
+		return "m" + targetXML[offset:end]
+	case p == "qAttached":
+		return "1"
+	case p == "qC":
+		return "QC1"
+	case p == "qfThreadInfo":
+		return "m1"
+	case p == "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// stopReply returns reply to the packet which runs the target.
+func (s *session) stopReply(err error) string {
+	switch {
+	case err == nil:
+		return "S05"
+	case errors.Is(err, ErrExited):
+		return "W00"
+	}
+	// The program crashed with illegal instruction.
+	return "X04"
+}
+
+func okOrError(err error) string {
+	if err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// parseAddrLen parses addr,length pair of hexadecimal numbers.
+func parseAddrLen(s string) (addr, n int, err error) {
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid address and length %q", s)
+	}
+	a, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(a), int(l), nil
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// escape escapes special characters of packet data.
+func escape(data string) string {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescape restores escaped characters of packet data.
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			b.WriteByte(data[i] ^ 0x20)
+			continue
+		}
+		b.WriteByte(data[i])
+	}
+	return b.String()
+}
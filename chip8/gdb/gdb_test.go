@@ -0,0 +1,224 @@
+package gdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type targetMock struct {
+	regs        Registers
+	memory      []byte
+	breakpoints map[int]bool
+	steps       int
+	// stop is returned by Continue and Step.
+	stop        error
+	interrupted bool
+}
+
+func newTargetMock() *targetMock {
+	return &targetMock{
+		memory:      make([]byte, 0x1000),
+		breakpoints: make(map[int]bool),
+	}
+}
+
+func (t *targetMock) Registers() Registers { return t.regs }
+
+func (t *targetMock) SetRegisters(r Registers) error {
+	t.regs = r
+	return nil
+}
+
+func (t *targetMock) ReadMemory(addr, n int) ([]byte, error) {
+	if addr+n > len(t.memory) {
+		return nil, errors.New("out of bounds")
+	}
+	return t.memory[addr : addr+n], nil
+}
+
+func (t *targetMock) WriteMemory(addr int, data []byte) error {
+	copy(t.memory[addr:], data)
+	return nil
+}
+
+func (t *targetMock) SetBreakpoint(addr int)   { t.breakpoints[addr] = true }
+func (t *targetMock) ClearBreakpoint(addr int) { delete(t.breakpoints, addr) }
+
+func (t *targetMock) Step() error {
+	t.steps++
+	t.regs.PC += 2
+	return t.stop
+}
+
+func (t *targetMock) Continue(interrupt <-chan struct{}) error {
+	if t.stop != nil {
+		return t.stop
+	}
+	<-interrupt
+	t.interrupted = true
+	return nil
+}
+
+// client talks to the session like a debugger.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newClient(t *testing.T, target Target) *client {
+	server, conn := net.Pipe()
+	go func() {
+		newSession(server, target).run()
+		server.Close()
+	}()
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// request sends the packet and returns the reply.
+func (c *client) request(data string) string {
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data))
+	require.NoError(c.t, err)
+	ack, err := c.r.ReadByte()
+	require.NoError(c.t, err)
+	require.Equal(c.t, byte('+'), ack)
+	return c.reply()
+}
+
+func (c *client) reply() string {
+	_, err := c.r.ReadString('$')
+	require.NoError(c.t, err)
+	data, err := c.r.ReadString('#')
+	require.NoError(c.t, err)
+	cs := make([]byte, 2)
+	_, err = io.ReadFull(c.r, cs)
+	require.NoError(c.t, err)
+	data = data[:len(data)-1]
+	assert.Equal(c.t, fmt.Sprintf("%02x", checksum(data)), string(cs))
+	return unescape(data)
+}
+
+func TestSessionRegisters(t *testing.T) {
+	target := newTargetMock()
+	target.regs.V[0] = 0x12
+	target.regs.V[0xF] = 0x01
+	target.regs.I = 0x0300
+	target.regs.PC = 0x0202
+	target.regs.SP = 1
+	target.regs.DT = 0x3C
+	c := newClient(t, target)
+	defer c.conn.Close()
+
+	want := "12" + strings.Repeat("00", 14) + "01" + "0003" + "0202" + "01" + "3c" + "00"
+	assert.Equal(t, want, c.request("g"))
+	assert.Equal(t, "0202", c.request("p11"))
+	assert.Equal(t, "3c", c.request("p13"))
+	assert.Equal(t, "E01", c.request("p15"))
+
+	assert.Equal(t, "OK", c.request("P10=0004"))
+	assert.Equal(t, uint16(0x400), target.regs.I)
+	assert.Equal(t, "OK", c.request("P3=ff"))
+	assert.Equal(t, byte(0xFF), target.regs.V[3])
+
+	regs := strings.Repeat("00", 16) + "1000" + "0002" + "000000"
+	assert.Equal(t, "OK", c.request("G"+regs))
+	assert.Equal(t, uint16(0x10), target.regs.I)
+	assert.Equal(t, uint16(0x200), target.regs.PC)
+	assert.Equal(t, "E01", c.request("G00"))
+}
+
+func TestSessionMemory(t *testing.T) {
+	target := newTargetMock()
+	copy(target.memory[0x200:], []byte{0x60, 0x05, 0x12, 0x00})
+	c := newClient(t, target)
+	defer c.conn.Close()
+
+	assert.Equal(t, "60051200", c.request("m200,4"))
+	assert.Equal(t, "E01", c.request("mfff,2"))
+	assert.Equal(t, "OK", c.request("M300,2:abcd"))
+	assert.Equal(t, []byte{0xAB, 0xCD}, target.memory[0x300:0x302])
+	assert.Equal(t, "E01", c.request("M300,3:abcd"))
+}
+
+func TestSessionBreakpoints(t *testing.T) {
+	target := newTargetMock()
+	c := newClient(t, target)
+	defer c.conn.Close()
+
+	assert.Equal(t, "OK", c.request("Z0,2a4,2"))
+	assert.True(t, target.breakpoints[0x2A4])
+	assert.Equal(t, "OK", c.request("z0,2a4,2"))
+	assert.False(t, target.breakpoints[0x2A4])
+	// Hardware breakpoints are not supported.
+	assert.Equal(t, "", c.request("Z1,2a4,2"))
+}
+
+func TestSessionExecution(t *testing.T) {
+	target := newTargetMock()
+	c := newClient(t, target)
+	defer c.conn.Close()
+
+	assert.Equal(t, "S05", c.request("?"))
+	assert.Equal(t, "S05", c.request("s"))
+	assert.Equal(t, 1, target.steps)
+
+	_, err := fmt.Fprintf(c.conn, "$c#%02x", checksum("c"))
+	require.NoError(t, err)
+	ack, err := c.r.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, byte('+'), ack)
+	_, err = c.conn.Write([]byte{interruptByte})
+	require.NoError(t, err)
+	assert.Equal(t, "S05", c.reply())
+	assert.True(t, target.interrupted)
+
+	target.stop = ErrExited
+	assert.Equal(t, "W00", c.request("c"))
+	target.stop = errors.New("unknown opcode")
+	assert.Equal(t, "X04", c.request("s"))
+}
+
+func TestSessionQueries(t *testing.T) {
+	c := newClient(t, newTargetMock())
+	defer c.conn.Close()
+
+	assert.Contains(t, c.request("qSupported:multiprocess+"), "qXfer:features:read+")
+	assert.Equal(t, "1", c.request("qAttached"))
+	assert.Equal(t, "OK", c.request("Hg0"))
+	assert.Equal(t, "", c.request("vMustReplyEmpty"))
+
+	xml := c.request("qXfer:features:read:target.xml:0,10")
+	assert.Equal(t, "m"+targetXML[:0x10], xml)
+	xml = c.request(fmt.Sprintf("qXfer:features:read:target.xml:%x,1000", 0x10))
+	assert.Equal(t, "l"+targetXML[0x10:], xml)
+	assert.Contains(t, xml, `<reg name="pc" bitsize="16" type="code_ptr"/>`)
+}
+
+func TestSessionDetach(t *testing.T) {
+	c := newClient(t, newTargetMock())
+	defer c.conn.Close()
+
+	assert.Equal(t, "OK", c.request("D"))
+	_, err := c.r.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "a}\x03b}]", escape("a#b}"))
+	assert.Equal(t, "a#b}", unescape(escape("a#b}")))
+}
+
+func TestListen(t *testing.T) {
+	s, err := Listen("0")
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Contains(t, s.Addr().String(), "127.0.0.1:")
+}
@@ -0,0 +1,120 @@
+package gdb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Registers of the CHIP-8 CPU. SP is the depth of the stack.
+type Registers struct {
+	V      [16]byte
+	I, PC  uint16
+	SP     byte
+	DT, ST byte
+}
+
+// Indexes of registers in g and p packets. V0 to VF go first.
+const (
+	regI = 16 + iota
+	regPC
+	regSP
+	regDT
+	regST
+	regCount
+)
+
+// registersSize is the size of encoded registers in bytes.
+const registersSize = 16 + 2 + 2 + 3
+
+// encode returns registers in the order of the target description. Values
+// are little endian.
+func (r Registers) encode() []byte {
+	b := make([]byte, 0, registersSize)
+	b = append(b, r.V[:]...)
+	b = append(b, byte(r.I), byte(r.I>>8))
+	b = append(b, byte(r.PC), byte(r.PC>>8))
+	b = append(b, r.SP, r.DT, r.ST)
+	return b
+}
+
+// decodeRegisters decodes registers encoded with encode.
+func decodeRegisters(b []byte) (Registers, error) {
+	var r Registers
+	if len(b) != registersSize {
+		return r, fmt.Errorf("registers size is %d, want %d", len(b), registersSize)
+	}
+	copy(r.V[:], b)
+	r.I = binary.LittleEndian.Uint16(b[16:])
+	r.PC = binary.LittleEndian.Uint16(b[18:])
+	r.SP, r.DT, r.ST = b[20], b[21], b[22]
+	return r, nil
+}
+
+// register returns the encoded register n.
+func (r Registers) register(n int) ([]byte, error) {
+	offset, size, err := registerPos(n)
+	if err != nil {
+		return nil, err
+	}
+	return r.encode()[offset : offset+size], nil
+}
+
+// setRegister sets register n from its encoded value.
+func (r *Registers) setRegister(n int, value []byte) error {
+	offset, size, err := registerPos(n)
+	if err != nil {
+		return err
+	}
+	if len(value) != size {
+		return fmt.Errorf("register %d size is %d, want %d", n, len(value), size)
+	}
+	b := r.encode()
+	copy(b[offset:], value)
+	*r, err = decodeRegisters(b)
+	return err
+}
+
+// registerPos returns offset and size of register n in encoded registers.
+func registerPos(n int) (offset, size int, err error) {
+	switch {
+	case n >= 0 && n < regI:
+		return n, 1, nil
+	case n == regI:
+		return 16, 2, nil
+	case n == regPC:
+		return 18, 2, nil
+	case n >= regSP && n < regCount:
+		return 20 + n - regSP, 1, nil
+	}
+	return 0, 0, fmt.Errorf("unknown register %d", n)
+}
+
+// targetXML describes CHIP-8 registers to the debugger.
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.chip8.cpu">
+    <reg name="v0" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="v1" bitsize="8" type="uint8"/>
+    <reg name="v2" bitsize="8" type="uint8"/>
+    <reg name="v3" bitsize="8" type="uint8"/>
+    <reg name="v4" bitsize="8" type="uint8"/>
+    <reg name="v5" bitsize="8" type="uint8"/>
+    <reg name="v6" bitsize="8" type="uint8"/>
+    <reg name="v7" bitsize="8" type="uint8"/>
+    <reg name="v8" bitsize="8" type="uint8"/>
+    <reg name="v9" bitsize="8" type="uint8"/>
+    <reg name="va" bitsize="8" type="uint8"/>
+    <reg name="vb" bitsize="8" type="uint8"/>
+    <reg name="vc" bitsize="8" type="uint8"/>
+    <reg name="vd" bitsize="8" type="uint8"/>
+    <reg name="ve" bitsize="8" type="uint8"/>
+    <reg name="vf" bitsize="8" type="uint8"/>
+    <reg name="i" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="sp" bitsize="8" type="uint8"/>
+    <reg name="dt" bitsize="8" type="uint8"/>
+    <reg name="st" bitsize="8" type="uint8"/>
+  </feature>
+</target>
+`
@@ -0,0 +1,136 @@
+package chip8
+
+import (
+	"sync"
+
+	"github.com/Pawka/chip8-emulator/chip8/gdb"
+)
+
+// gdbTarget exposes the emulator to the GDB server. The program is run and
+// stopped by the debugger, so the state is changed only while it is paused.
+type gdbTarget struct {
+	c *chip8
+
+	// done is closed when the emulator stops. err holds the reason.
+	done     chan struct{}
+	err      error
+	stopOnce sync.Once
+}
+
+func newGDBTarget(c *chip8) *gdbTarget {
+	return &gdbTarget{
+		c:    c,
+		done: make(chan struct{}),
+	}
+}
+
+// stop is called when the emulator stops with err.
+func (t *gdbTarget) stop(err error) {
+	t.stopOnce.Do(func() {
+		t.err = err
+		close(t.done)
+	})
+}
+
+func (t *gdbTarget) Registers() gdb.Registers {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	r := gdb.Registers{
+		I:  uint16(t.c.i),
+		PC: t.c.pc,
+		SP: byte(len(t.c.stack)),
+		DT: t.c.delayTimer,
+		ST: t.c.soundTimer,
+	}
+	copy(r.V[:], t.c.v)
+	return r
+}
+
+// SetRegisters changes registers. The stack can be only unwound by lowering
+// SP.
+func (t *gdbTarget) SetRegisters(r gdb.Registers) error {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	copy(t.c.v, r.V[:])
+	t.c.i = int(r.I)
+	t.c.pc = r.PC
+	t.c.delayTimer = r.DT
+	t.c.soundTimer = r.ST
+	if int(r.SP) < len(t.c.stack) {
+		t.c.stack = t.c.stack[:r.SP]
+	}
+	return nil
+}
+
+func (t *gdbTarget) ReadMemory(addr, n int) ([]byte, error) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	m, err := t.c.mem(addr, n)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), m...), nil
+}
+
+func (t *gdbTarget) WriteMemory(addr int, data []byte) error {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	m, err := t.c.mem(addr, len(data))
+	if err != nil {
+		return err
+	}
+	copy(m, data)
+	return nil
+}
+
+func (t *gdbTarget) SetBreakpoint(addr int) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	t.c.dbg.breakpoints[uint16(addr)] = true
+}
+
+func (t *gdbTarget) ClearBreakpoint(addr int) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	delete(t.c.dbg.breakpoints, uint16(addr))
+}
+
+func (t *gdbTarget) Step() error {
+	t.run(t.c.dbg.step)
+	return t.wait(nil)
+}
+
+func (t *gdbTarget) Continue(interrupt <-chan struct{}) error {
+	t.run(t.c.dbg.resume)
+	return t.wait(interrupt)
+}
+
+// run starts the program with the debugger function.
+func (t *gdbTarget) run(start func()) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	// Drop the notification of the previous stop.
+	select {
+	case <-t.c.dbg.stopped:
+	default:
+	}
+	start()
+}
+
+// wait waits until the program is stopped by the debugger or interrupted.
+func (t *gdbTarget) wait(interrupt <-chan struct{}) error {
+	select {
+	case <-t.c.dbg.stopped:
+		return nil
+	case <-interrupt:
+		t.c.mu.Lock()
+		defer t.c.mu.Unlock()
+		t.c.dbg.pause("interrupt")
+		return nil
+	case <-t.done:
+		if t.err == nil {
+			return gdb.ErrExited
+		}
+		return t.err
+	}
+}
@@ -0,0 +1,67 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/gdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runFrames executes frames like Run until quit is closed.
+func runFrames(c *chip8, quit chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		c.mu.Lock()
+		c.frame(10)
+		c.mu.Unlock()
+	}
+}
+
+func TestGDBTarget(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{gdb: "1234"})
+	target := newGDBTarget(ch)
+	quit := make(chan struct{})
+	defer close(quit)
+	go runFrames(ch, quit)
+
+	regs := target.Registers()
+	assert.Equal(t, uint16(0x200), regs.PC)
+
+	require.NoError(t, target.Step())
+	regs = target.Registers()
+	assert.Equal(t, uint16(0x202), regs.PC)
+	assert.Equal(t, byte(5), regs.V[0])
+
+	target.SetBreakpoint(0x20A)
+	require.NoError(t, target.Continue(nil))
+	regs = target.Registers()
+	assert.Equal(t, uint16(0x20A), regs.PC)
+	assert.Equal(t, byte(1), regs.SP)
+	assert.Equal(t, uint16(0x300), regs.I)
+
+	regs.V[0] = 0x42
+	require.NoError(t, target.SetRegisters(regs))
+	require.NoError(t, target.Step())
+	m, err := target.ReadMemory(0x300, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x42}, m)
+
+	require.NoError(t, target.WriteMemory(0x300, []byte{0x7}))
+	assert.Equal(t, byte(0x7), ch.ram.Memory[0x300])
+	_, err = target.ReadMemory(memorySize, 1)
+	assert.Error(t, err)
+
+	target.ClearBreakpoint(0x20A)
+	interrupt := make(chan struct{})
+	close(interrupt)
+	require.NoError(t, target.Continue(interrupt))
+	assert.Equal(t, "interrupt", ch.dbg.reason)
+
+	target.stop(nil)
+	assert.Equal(t, gdb.ErrExited, target.Continue(make(chan struct{})))
+}
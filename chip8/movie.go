@@ -0,0 +1,230 @@
+package chip8
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+)
+
+// ErrReplayMismatch is returned when the screen at the end of the replay
+// differs from the recorded one.
+var ErrReplayMismatch = errors.New("replay does not match the movie")
+
+// movieVersion is the version of the movie file format.
+const movieVersion = 1
+
+// movieEvent is a key returned by the poll-th PollKey call of the frame.
+type movieEvent struct {
+	frame, poll int
+	key         rune
+}
+
+// movie holds input of a recorded run. Movie file is a text file:
+//
+//	chip8-movie 1
+//	rom <SHA-256 of the rom>
+//	seed <seed of the random number generator>
+//	frames <number of frames>
+//	hash <SHA-256 of the screen after the last frame>
+//	key <frame> <poll> <key code point, e.g. U+0031>
+//	...
+type movie struct {
+	rom    [sha256.Size]byte
+	seed   int64
+	frames int
+	hash   [sha256.Size]byte
+	events []movieEvent
+}
+
+// writeMovie writes the movie to w.
+func writeMovie(w io.Writer, m *movie) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "chip8-movie %d\n", movieVersion)
+	fmt.Fprintf(b, "rom %x\n", m.rom)
+	fmt.Fprintf(b, "seed %d\n", m.seed)
+	fmt.Fprintf(b, "frames %d\n", m.frames)
+	fmt.Fprintf(b, "hash %x\n", m.hash)
+	for _, e := range m.events {
+		fmt.Fprintf(b, "key %d %d %U\n", e.frame, e.poll, e.key)
+	}
+	return b.Flush()
+}
+
+// readMovie reads the movie written with writeMovie.
+func readMovie(r io.Reader) (*movie, error) {
+	m := &movie{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch {
+		case n == 1:
+			if fields[0] != "chip8-movie" || len(fields) != 2 || fields[1] != strconv.Itoa(movieVersion) {
+				return nil, errors.New("unsupported movie format")
+			}
+		case fields[0] == "rom" && len(fields) == 2:
+			err = decodeHash(fields[1], &m.rom)
+		case fields[0] == "seed" && len(fields) == 2:
+			m.seed, err = strconv.ParseInt(fields[1], 10, 64)
+		case fields[0] == "frames" && len(fields) == 2:
+			m.frames, err = strconv.Atoi(fields[1])
+		case fields[0] == "hash" && len(fields) == 2:
+			err = decodeHash(fields[1], &m.hash)
+		case fields[0] == "key" && len(fields) == 4:
+			var e movieEvent
+			e, err = parseMovieEvent(fields[1:])
+			m.events = append(m.events, e)
+		default:
+			err = errors.New("unknown record")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("movie line %d: %v", n, err)
+		}
+	}
+	return m, s.Err()
+}
+
+func parseMovieEvent(fields []string) (movieEvent, error) {
+	frame, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return movieEvent{}, err
+	}
+	poll, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return movieEvent{}, err
+	}
+	if !strings.HasPrefix(fields[2], "U+") {
+		return movieEvent{}, fmt.Errorf("invalid key %q", fields[2])
+	}
+	key, err := strconv.ParseUint(fields[2][2:], 16, 32)
+	if err != nil {
+		return movieEvent{}, err
+	}
+	return movieEvent{frame, poll, rune(key)}, nil
+}
+
+func decodeHash(s string, hash *[sha256.Size]byte) error {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid hash %q", s)
+	}
+	copy(hash[:], b)
+	return nil
+}
+
+// screenHash returns SHA-256 of the framebuffer.
+func (c *chip8) screenHash() [sha256.Size]byte {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, [2]uint16{uint16(c.fb.width), uint16(c.fb.height)})
+	h.Write(c.fb.pixels)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// pollKey returns a key pressed by the user. Keys are recorded to the movie or
+// read from it while it is replayed. Instructions executed again after a step
+// back get keys from the rewind buffer.
+func (c *chip8) pollKey() *rune {
+	if c.rewind.replaying {
+		return c.rewind.pollKey(nil)
+	}
+	poll := c.polls
+	c.polls++
+	if c.replay != nil {
+		events := c.replay.events
+		if len(events) == 0 || events[0].frame != c.frames || events[0].poll != poll {
+			return nil
+		}
+		key := events[0].key
+		c.replay.events = events[1:]
+		return &key
+	}
+
+	key := c.display.PollKey()
+	if key != nil && c.record != nil {
+		c.record.events = append(c.record.events, movieEvent{c.frames, poll, *key})
+	}
+	return c.rewind.pollKey(key)
+}
+
+// startMovie prepares recording or replaying of the movie.
+func (c *chip8) startMovie() error {
+	if c.replayPath != "" {
+		f, err := os.Open(c.replayPath)
+		if err != nil {
+			return fmt.Errorf("replaying movie: %v", err)
+		}
+		defer f.Close()
+		m, err := readMovie(f)
+		if err != nil {
+			return fmt.Errorf("replaying movie: %v", err)
+		}
+		if m.rom != c.ram.romHash {
+			return errors.New("replaying movie: movie is recorded with a different rom")
+		}
+		c.replay = m
+		c.seed = m.seed
+		c.rng = newRNG(m.seed)
+	}
+	if c.recordPath != "" {
+		c.record = &movie{
+			rom:  c.ram.romHash,
+			seed: c.seed,
+		}
+	}
+	return nil
+}
+
+// movieCommand returns true if the command changes the state of the machine
+// outside of the movie, so it is not allowed while a movie is recorded or
+// replayed.
+func (c *chip8) movieCommand(cmd display.Command) bool {
+	if c.record == nil && c.replay == nil {
+		return false
+	}
+	switch cmd {
+	case display.CommandLoadState, display.CommandRewind, display.CommandStepBack:
+		return true
+	}
+	return false
+}
+
+// replayDone returns true when all frames of the replayed movie are
+// executed. It returns an error if the screen differs from the recorded one.
+func (c *chip8) replayDone() (bool, error) {
+	if c.replay == nil || c.frames < c.replay.frames {
+		return false, nil
+	}
+	if c.screenHash() != c.replay.hash {
+		return true, fmt.Errorf("%w: screen differs after %d frames", ErrReplayMismatch, c.frames)
+	}
+	return true, nil
+}
+
+// saveMovie writes the recorded movie to path.
+func (c *chip8) saveMovie(path string) error {
+	c.record.frames = c.frames
+	c.record.hash = c.screenHash()
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saving movie: %v", err)
+	}
+	if err := writeMovie(f, c.record); err != nil {
+		f.Close()
+		return fmt.Errorf("saving movie: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,155 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// movieProgram waits for a key and draws its digit at a random column.
+var movieProgram = []byte{
+	0xF0, 0x0A, // LD V0, K
+	0xC1, 0x3F, // RND V1, 0x3F
+	0x62, 0x05, // LD V2, 5
+	0xF0, 0x29, // LD F, V0
+	0xD1, 0x25, // DRW V1, V2, 5
+	0x12, 0x00, // JP 0x200
+}
+
+func TestMovieReadWrite(t *testing.T) {
+	m := &movie{
+		seed:   -42,
+		frames: 120,
+		events: []movieEvent{{3, 0, '1'}, {3, 1, ' '}, {90, 2, 'ž'}},
+	}
+	m.rom[0] = 0xAB
+	m.hash[31] = 0xCD
+
+	var b bytes.Buffer
+	require.NoError(t, writeMovie(&b, m))
+	assert.Contains(t, b.String(), "key 3 1 U+0020\n")
+
+	got, err := readMovie(&b)
+	require.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func TestReadMovieErrors(t *testing.T) {
+	testCases := map[string]struct {
+		data    string
+		wantErr string
+	}{
+		"unsupported_version": {
+			data:    "chip8-movie 9\n",
+			wantErr: "unsupported movie format",
+		},
+		"invalid_hash": {
+			data:    "chip8-movie 1\nrom abc\n",
+			wantErr: `movie line 2: invalid hash "abc"`,
+		},
+		"invalid_key": {
+			data:    "chip8-movie 1\nkey 1 0 a\n",
+			wantErr: `movie line 2: invalid key "a"`,
+		},
+		"unknown_record": {
+			data:    "chip8-movie 1\nfoo 1\n",
+			wantErr: "movie line 2: unknown record",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := readMovie(strings.NewReader(tc.data))
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestMovieRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "movie.ch8")
+	require.NoError(t, ioutil.WriteFile(rom, movieProgram, 0644))
+	moviePath := filepath.Join(dir, "movie.txt")
+
+	rec := newTestChip8(t, Ctx{path: rom, seed: 7, record: moviePath})
+	require.NoError(t, rec.start())
+	keys := rec.display.(*display.Headless)
+	// Each step executes a single frame.
+	for frame := 0; frame < 30; frame++ {
+		if frame%10 == 5 {
+			keys.PressKey('1' + rune(frame/10))
+		}
+		require.NoError(t, rec.Step(defaultCyclesPerSecond/frameRate))
+	}
+	require.NoError(t, rec.saveMovie(moviePath))
+	assert.Len(t, rec.record.events, 3)
+
+	replay := func() (*chip8, error) {
+		// The seed is taken from the movie.
+		ch := newTestChip8(t, Ctx{path: rom, seed: 8, replay: moviePath})
+		require.NoError(t, ch.start())
+		for {
+			require.NoError(t, ch.Step(defaultCyclesPerSecond/frameRate))
+			if done, err := ch.replayDone(); done {
+				return ch, err
+			}
+		}
+	}
+
+	ch, err := replay()
+	require.NoError(t, err)
+	assert.Equal(t, 30, ch.frames)
+	assert.Equal(t, rec.fb.frame(), ch.fb.frame())
+
+	data, err := ioutil.ReadFile(moviePath)
+	require.NoError(t, err)
+	data = bytes.Replace(data, []byte("U+0032"), []byte("U+0034"), 1)
+	require.NoError(t, ioutil.WriteFile(moviePath, data, 0644))
+	_, err = replay()
+	assert.True(t, errors.Is(err, ErrReplayMismatch))
+}
+
+func TestMovieDifferentROM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	moviePath := filepath.Join(dir, "movie.txt")
+	f, err := os.Create(moviePath)
+	require.NoError(t, err)
+	require.NoError(t, writeMovie(f, &movie{}))
+	require.NoError(t, f.Close())
+
+	ch := newTestChip8(t, Ctx{path: "testdata/draw.ch8", replay: moviePath})
+	assert.EqualError(t, ch.start(), "replaying movie: movie is recorded with a different rom")
+}
+
+func TestMovieDisablesRewind(t *testing.T) {
+	ch := newSnapshotChip8(t, "testdata/draw.ch8")
+	ch.replay = &movie{}
+	d := &controllerMock{commands: []display.Command{display.CommandRewind}}
+	ch.display = d
+	ch.commands()
+	assert.Equal(t, 0, ch.rewind.hold)
+	assert.Equal(t, []string{"Not available while a movie is recorded or replayed"}, d.lines)
+}
+
+func TestRandomWithSeed(t *testing.T) {
+	a, b := newRNG(1), newRNG(1)
+	seq := make([]byte, 16)
+	for k := range seq {
+		seq[k] = a.byte()
+		assert.Equal(t, seq[k], b.byte())
+	}
+	other := newRNG(2)
+	assert.NotEqual(t, seq[:4], []byte{other.byte(), other.byte(), other.byte(), other.byte()})
+}
@@ -0,0 +1,153 @@
+package octo
+
+import (
+	"math"
+)
+
+// Operators of :calc expressions. Binary operators have the same precedence
+// and are evaluated right to left, use parentheses to group them.
+var (
+	unaryOps = map[string]func(float64) float64{
+		"-":     func(a float64) float64 { return -a },
+		"~":     func(a float64) float64 { return float64(^int64(a)) },
+		"!":     func(a float64) float64 { return boolValue(a == 0) },
+		"abs":   math.Abs,
+		"sqrt":  math.Sqrt,
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"exp":   math.Exp,
+		"log":   math.Log,
+		"ceil":  math.Ceil,
+		"floor": math.Floor,
+		"sign": func(a float64) float64 {
+			switch {
+			case a < 0:
+				return -1
+			case a > 0:
+				return 1
+			}
+			return 0
+		},
+	}
+	binaryOps = map[string]func(a, b float64) float64{
+		"+":   func(a, b float64) float64 { return a + b },
+		"-":   func(a, b float64) float64 { return a - b },
+		"*":   func(a, b float64) float64 { return a * b },
+		"/":   func(a, b float64) float64 { return a / b },
+		"%":   math.Mod,
+		"&":   func(a, b float64) float64 { return float64(int64(a) & int64(b)) },
+		"|":   func(a, b float64) float64 { return float64(int64(a) | int64(b)) },
+		"^":   func(a, b float64) float64 { return float64(int64(a) ^ int64(b)) },
+		"<<":  func(a, b float64) float64 { return float64(int64(a) << uint(b)) },
+		">>":  func(a, b float64) float64 { return float64(int64(a) >> uint(b)) },
+		"pow": math.Pow,
+		"min": math.Min,
+		"max": math.Max,
+		"<":   func(a, b float64) float64 { return boolValue(a < b) },
+		">":   func(a, b float64) float64 { return boolValue(a > b) },
+		"<=":  func(a, b float64) float64 { return boolValue(a <= b) },
+		">=":  func(a, b float64) float64 { return boolValue(a >= b) },
+		"==":  func(a, b float64) float64 { return boolValue(a == b) },
+		"!=":  func(a, b float64) float64 { return boolValue(a != b) },
+	}
+)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// calc evaluates the expression in braces. The opening brace is already
+// consumed.
+func (c *compiler) calc() (float64, error) {
+	v, err := c.expression()
+	if err != nil {
+		return 0, err
+	}
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	if t.text != "}" {
+		return 0, t.errorf("expected } but got %q", t.text)
+	}
+	return v, nil
+}
+
+func (c *compiler) expression() (float64, error) {
+	a, err := c.term()
+	if err != nil {
+		return 0, err
+	}
+	if c.eof() {
+		return a, nil
+	}
+	op, ok := binaryOps[c.peek().text]
+	if !ok {
+		return a, nil
+	}
+	c.pos++
+	b, err := c.expression()
+	if err != nil {
+		return 0, err
+	}
+	return op(a, b), nil
+}
+
+func (c *compiler) term() (float64, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	if op, ok := unaryOps[t.text]; ok {
+		a, err := c.term()
+		if err != nil {
+			return 0, err
+		}
+		return op(a), nil
+	}
+	switch t.text {
+	case "(":
+		a, err := c.expression()
+		if err != nil {
+			return 0, err
+		}
+		closing, err := c.next()
+		if err != nil {
+			return 0, err
+		}
+		if closing.text != ")" {
+			return 0, closing.errorf("expected ) but got %q", closing.text)
+		}
+		return a, nil
+	case "@":
+		addr, err := c.term()
+		if err != nil {
+			return 0, err
+		}
+		at := int(addr) - origin
+		if at < 0 || at >= len(c.rom) {
+			return 0, t.errorf("address %d is outside of the program", int(addr))
+		}
+		return float64(c.rom[at]), nil
+	case "HERE":
+		return float64(c.here), nil
+	case "PI":
+		return math.Pi, nil
+	case "E":
+		return math.E, nil
+	}
+	if v, ok := parseNumber(t.text); ok {
+		return float64(v), nil
+	}
+	if v, ok := c.consts[t.text]; ok {
+		return v, nil
+	}
+	if addr, ok := c.labels[t.text]; ok {
+		return float64(addr), nil
+	}
+	return 0, t.errorf("undefined name %q", t.text)
+}
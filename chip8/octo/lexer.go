@@ -0,0 +1,63 @@
+package octo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// token is a word of the source. Tokens are separated with whitespace.
+type token struct {
+	text string
+	file string
+	line int
+	// quoted is set for string literals. text holds the string without
+	// quotes.
+	quoted bool
+}
+
+// Error is a compile error.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+func (t token) errorf(format string, args ...interface{}) error {
+	return &Error{File: t.file, Line: t.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// tokenize splits the source into tokens. Comments start with # and end at
+// the end of the line.
+func tokenize(file string, src string) ([]token, error) {
+	var tokens []token
+	for n, line := range strings.Split(src, "\n") {
+		for k := 0; k < len(line); {
+			c := line[k]
+			switch {
+			case c == ' ' || c == '\t' || c == '\r':
+				k++
+			case c == '#':
+				k = len(line)
+			case c == '"':
+				end := strings.IndexByte(line[k+1:], '"')
+				if end < 0 {
+					return nil, &Error{File: file, Line: n + 1, Msg: "unterminated string"}
+				}
+				tokens = append(tokens, token{text: line[k+1 : k+1+end], file: file, line: n + 1, quoted: true})
+				k += end + 2
+			default:
+				end := strings.IndexAny(line[k:], " \t\r")
+				if end < 0 {
+					end = len(line) - k
+				}
+				tokens = append(tokens, token{text: line[k : k+end], file: file, line: n + 1})
+				k += end
+			}
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,385 @@
+// Package octo compiles programs written in Octo assembly language.
+//
+// Tokens are separated with whitespace, so braces of :calc and :macro must be
+// surrounded by spaces. Execution starts at the main label.
+package octo
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// origin is the address where programs are loaded.
+const origin = 0x200
+
+// maxExpansions limits the number of macro expansions to catch recursive
+// macros.
+const maxExpansions = 10000
+
+// Program is a compiled program.
+type Program struct {
+	// Code is the binary loaded at 0x200.
+	Code []byte
+	// Labels holds addresses of labels.
+	Labels map[string]int
+	// Lines holds source lines of instructions by address.
+	Lines map[int]symbols.Line
+}
+
+// Table returns labels and source lines of the program.
+func (p *Program) Table() *symbols.Table {
+	return symbols.FromMaps(p.Labels, p.Lines)
+}
+
+type macro struct {
+	args []string
+	body []token
+}
+
+// Kinds of address fixups.
+const (
+	// fixAddr is 12-bit address in the lowest bits of an opcode.
+	fixAddr = iota
+	// fixLong is 16-bit address.
+	fixLong
+	// fixHigh is the highest nibble of 12-bit address ORed into a byte.
+	fixHigh
+	// fixHighByte is the high byte of 16-bit address.
+	fixHighByte
+	// fixLow is the low byte of the address.
+	fixLow
+)
+
+// fixup is a reference to a label which is defined later.
+type fixup struct {
+	addr int
+	kind int
+	name token
+}
+
+// block is an unfinished if or loop.
+type block struct {
+	tok token
+	// addr is the address of the loop or the jump to be patched at the end of
+	// if or else branch.
+	addr int
+	// breaks are jumps out of the loop made with while.
+	breaks []int
+}
+
+type compiler struct {
+	tokens []token
+	pos    int
+
+	rom  []byte
+	here int
+	// emitted is set when the code or :org precedes the main label.
+	emitted bool
+
+	// source holds lines of the source.
+	source []string
+	lines  map[int]symbols.Line
+
+	labels  map[string]int
+	consts  map[string]float64
+	aliases map[string]int
+	macros  map[string]*macro
+	// nextLabels point to the second byte of the next instruction.
+	nextLabels []token
+	fixups     []fixup
+	blocks     []*block
+	expansions int
+}
+
+// CompileFile compiles the source file at path.
+func CompileFile(path string) (*Program, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(path, src)
+}
+
+// Compile compiles the source. name is used in error messages.
+func Compile(name string, src []byte) (*Program, error) {
+	tokens, err := tokenize(name, string(src))
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{
+		tokens: tokens,
+		// The jump to main is placed at the origin.
+		rom:     make([]byte, 2),
+		here:    origin + 2,
+		source:  strings.Split(string(src), "\n"),
+		lines:   make(map[int]symbols.Line),
+		labels:  make(map[string]int),
+		consts:  make(map[string]float64),
+		aliases: make(map[string]int),
+		macros:  make(map[string]*macro),
+	}
+	for !c.eof() {
+		if err := c.statement(); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.blocks) > 0 {
+		b := c.blocks[len(c.blocks)-1]
+		return nil, b.tok.errorf("%s is not closed", b.tok.text)
+	}
+
+	main, ok := c.labels["main"]
+	if !ok {
+		line := 1
+		if len(tokens) > 0 {
+			line = tokens[len(tokens)-1].line
+		}
+		return nil, &Error{File: name, Line: line, Msg: "missing main label"}
+	}
+	if main != origin {
+		if err := c.patchJump(token{file: name, line: 1}, origin, main); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range c.fixups {
+		addr, ok := c.labels[f.name.text]
+		if !ok {
+			return nil, f.name.errorf("undefined label %q", f.name.text)
+		}
+		if err := c.fix(f, addr); err != nil {
+			return nil, err
+		}
+	}
+	return &Program{Code: c.rom, Labels: c.labels, Lines: c.lines}, nil
+}
+
+// fix writes the address of the label.
+func (c *compiler) fix(f fixup, addr int) error {
+	at := f.addr - origin
+	switch f.kind {
+	case fixAddr:
+		if addr > 0xFFF {
+			return f.name.errorf("address of %q does not fit into 12 bits", f.name.text)
+		}
+		c.rom[at] |= byte(addr >> 8)
+		c.rom[at+1] = byte(addr)
+	case fixLong:
+		c.rom[at] = byte(addr >> 8)
+		c.rom[at+1] = byte(addr)
+	case fixHigh:
+		if addr > 0xFFF {
+			return f.name.errorf("address of %q does not fit into 12 bits", f.name.text)
+		}
+		c.rom[at] |= byte(addr >> 8)
+	case fixHighByte:
+		c.rom[at] = byte(addr >> 8)
+	case fixLow:
+		c.rom[at] = byte(addr)
+	}
+	return nil
+}
+
+func (c *compiler) eof() bool {
+	return c.pos >= len(c.tokens)
+}
+
+func (c *compiler) peek() token {
+	return c.tokens[c.pos]
+}
+
+// next returns the next token. It fails at the end of the source.
+func (c *compiler) next() (token, error) {
+	if c.eof() {
+		last := token{line: 1}
+		if len(c.tokens) > 0 {
+			last = c.tokens[len(c.tokens)-1]
+		}
+		return token{}, last.errorf("unexpected end of file")
+	}
+	t := c.tokens[c.pos]
+	c.pos++
+	return t, nil
+}
+
+// expect consumes the token with the text.
+func (c *compiler) expect(text string) error {
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	if t.text != text {
+		return t.errorf("expected %s but got %q", text, t.text)
+	}
+	return nil
+}
+
+// emit writes bytes at the current address.
+func (c *compiler) emit(t token, b ...byte) error {
+	for _, v := range b {
+		if c.here > 0xFFFF {
+			return t.errorf("program does not fit into the memory")
+		}
+		at := c.here - origin
+		for len(c.rom) <= at {
+			c.rom = append(c.rom, 0)
+		}
+		c.rom[at] = v
+		c.here++
+	}
+	c.emitted = true
+	return nil
+}
+
+// inst emits the instruction. Labels defined with :next point to its second
+// byte.
+func (c *compiler) inst(t token, opcode uint16) error {
+	for _, name := range c.nextLabels {
+		c.labels[name.text] = c.here + 1
+	}
+	c.nextLabels = c.nextLabels[:0]
+	if t.line <= len(c.source) {
+		c.lines[c.here] = symbols.Line{File: t.file, Line: t.line, Text: strings.TrimSpace(c.source[t.line-1])}
+	}
+	return c.emit(t, byte(opcode>>8), byte(opcode))
+}
+
+// patchJump changes the target of the jump at addr.
+func (c *compiler) patchJump(t token, addr, target int) error {
+	if target > 0xFFF {
+		return t.errorf("jump target %#x does not fit into 12 bits", target)
+	}
+	c.rom[addr-origin] = 0x10 | byte(target>>8)
+	c.rom[addr-origin+1] = byte(target)
+	return nil
+}
+
+// register returns the number of the register or its alias.
+func (c *compiler) register(t token) (int, bool) {
+	if r, ok := c.aliases[t.text]; ok {
+		return r, true
+	}
+	s := t.text
+	if len(s) != 2 || (s[0] != 'v' && s[0] != 'V') {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 8)
+	return int(v), err == nil
+}
+
+// nextRegister consumes a register.
+func (c *compiler) nextRegister() (int, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := c.register(t)
+	if !ok {
+		return 0, t.errorf("expected register but got %q", t.text)
+	}
+	return r, nil
+}
+
+// value returns the value of a number, constant, label or calc expression.
+// known is false if the token may be a label defined later.
+func (c *compiler) value(t token) (v int, known bool, err error) {
+	if t.text == "{" {
+		f, err := c.calc()
+		return int(f), true, err
+	}
+	if v, ok := parseNumber(t.text); ok {
+		return v, true, nil
+	}
+	if f, ok := c.consts[t.text]; ok {
+		return int(f), true, nil
+	}
+	if addr, ok := c.labels[t.text]; ok {
+		return addr, true, nil
+	}
+	if _, ok := c.register(t); ok || t.quoted || !isIdentifier(t.text) {
+		return 0, false, t.errorf("invalid value %q", t.text)
+	}
+	return 0, false, nil
+}
+
+// number consumes a value which must be known and in the range.
+func (c *compiler) number(min, max int) (int, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	v, known, err := c.value(t)
+	if err != nil {
+		return 0, err
+	}
+	if !known {
+		return 0, t.errorf("undefined name %q", t.text)
+	}
+	if v < min || v > max {
+		return 0, t.errorf("value %d out of range", v)
+	}
+	return v, nil
+}
+
+// address consumes an address. Labels defined later are fixed up at the end,
+// at is the address of the bytes to fix.
+func (c *compiler) address(at, kind, max int) (int, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	v, known, err := c.value(t)
+	if err != nil {
+		return 0, err
+	}
+	if !known {
+		c.fixups = append(c.fixups, fixup{addr: at, kind: kind, name: t})
+		return 0, nil
+	}
+	if v < 0 || v > max {
+		return 0, t.errorf("address %d out of range", v)
+	}
+	return v, nil
+}
+
+// addressInst emits the instruction with 12-bit address.
+func (c *compiler) addressInst(t token, opcode uint16) error {
+	addr, err := c.address(c.here, fixAddr, 0xFFF)
+	if err != nil {
+		return err
+	}
+	return c.inst(t, opcode|uint16(addr))
+}
+
+// parseNumber parses decimal, hexadecimal and binary numbers.
+func parseNumber(s string) (int, bool) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		base, s = 2, s[2:]
+	}
+	v, err := strconv.ParseInt(s, base, 32)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+	if neg {
+		v = -v
+	}
+	return int(v), true
+}
+
+// isIdentifier returns true if the name can be a label.
+func isIdentifier(s string) bool {
+	if s == "" || s[0] == '-' || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	return !strings.ContainsAny(s, "{}():=")
+}
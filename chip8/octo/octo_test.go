@@ -0,0 +1,189 @@
+package octo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileStatements(t *testing.T) {
+	testCases := map[string]struct {
+		src  string
+		want []byte
+	}{
+		"simple":          {src: "clear return ; hires lores exit", want: []byte{0x00, 0xE0, 0x00, 0xEE, 0x00, 0xEE, 0x00, 0xFF, 0x00, 0xFE, 0x00, 0xFD}},
+		"assign_number":   {src: "v3 := 0x2A", want: []byte{0x63, 0x2A}},
+		"assign_negative": {src: "v3 := -1", want: []byte{0x63, 0xFF}},
+		"assign_register": {src: "v3 := v4", want: []byte{0x83, 0x40}},
+		"register_math":   {src: "v1 |= v2 v1 &= v2 v1 ^= v2 v1 += v2 v1 -= v2 v1 >>= v2 v1 =- v2 v1 <<= v2", want: []byte{0x81, 0x21, 0x81, 0x22, 0x81, 0x23, 0x81, 0x24, 0x81, 0x25, 0x81, 0x26, 0x81, 0x27, 0x81, 0x2E}},
+		"add_number":      {src: "v1 += 5", want: []byte{0x71, 0x05}},
+		"subtract_number": {src: "v1 -= 1", want: []byte{0x71, 0xFF}},
+		"random":          {src: "v1 := random 0x0F", want: []byte{0xC1, 0x0F}},
+		"key_and_delay":   {src: "v1 := key v2 := delay delay := v3 buzzer := v4", want: []byte{0xF1, 0x0A, 0xF2, 0x07, 0xF3, 0x15, 0xF4, 0x18}},
+		"index":           {src: "i := 0x300 i += v2 i := hex v3 i := bighex v4", want: []byte{0xA3, 0x00, 0xF2, 0x1E, 0xF3, 0x29, 0xF4, 0x30}},
+		"long_index":      {src: "i := long 0x1234", want: []byte{0xF0, 0x00, 0x12, 0x34}},
+		"save_and_load":   {src: "bcd v1 save v2 load v3 save v1 - v4 load v2 - v5", want: []byte{0xF1, 0x33, 0xF2, 0x55, 0xF3, 0x65, 0x51, 0x42, 0x52, 0x53}},
+		"flags":           {src: "saveflags v3 loadflags v4", want: []byte{0xF3, 0x75, 0xF4, 0x85}},
+		"sprite":          {src: "sprite v1 v2 15", want: []byte{0xD1, 0x2F}},
+		"xochip":          {src: "plane 3 audio pitch := v2 scroll-up 4", want: []byte{0xF3, 0x01, 0xF0, 0x02, 0xF2, 0x3A, 0x00, 0xD4}},
+		"schip_scroll":    {src: "scroll-down 2 scroll-left scroll-right", want: []byte{0x00, 0xC2, 0x00, 0xFC, 0x00, 0xFB}},
+		"jumps":           {src: "jump 0x300 jump0 0x310 native 0x320 :call 0x330", want: []byte{0x13, 0x00, 0xB3, 0x10, 0x03, 0x20, 0x23, 0x30}},
+		"sprite_literal":  {src: "0xFF 0b10000001 255", want: []byte{0xFF, 0x81, 0xFF}},
+		"byte":            {src: ":byte 7 :byte { 3 + 4 }", want: []byte{0x07, 0x07}},
+		"alias":           {src: ":alias x v5 x := 1", want: []byte{0x65, 0x01}},
+		"const":           {src: ":const SPEED 3 v1 += SPEED SPEED", want: []byte{0x71, 0x03, 0x03}},
+		"calc_right_to_left": {
+			// 2 * 3 + 1 is evaluated as 2 * (3 + 1).
+			src:  ":calc value { 2 * 3 + 1 } v0 := value",
+			want: []byte{0x60, 0x08},
+		},
+		"calc_parentheses": {src: ":calc value { ( 2 * 3 ) + 1 } v0 := value", want: []byte{0x60, 0x07}},
+		"macro":            {src: ":macro twice reg { reg += 1 reg += 1 } twice v2", want: []byte{0x72, 0x01, 0x72, 0x01}},
+		"if_then_equal":    {src: "if v1 == 3 then v2 := 0", want: []byte{0x41, 0x03, 0x62, 0x00}},
+		"if_then_not_equal": {
+			src:  "if v1 != v2 then v2 := 0",
+			want: []byte{0x51, 0x20, 0x62, 0x00},
+		},
+		"if_then_key": {src: "if v1 key then v2 := 0 if v1 -key then v2 := 0", want: []byte{0xE1, 0xA1, 0x62, 0x00, 0xE1, 0x9E, 0x62, 0x00}},
+		"if_then_greater": {
+			src:  "if v1 > 5 then v2 := 0",
+			want: []byte{0x6F, 0x05, 0x8F, 0x15, 0x3F, 0x01, 0x62, 0x00},
+		},
+		"if_then_less_or_equal": {
+			src:  "if v1 <= v3 then v2 := 0",
+			want: []byte{0x8F, 0x30, 0x8F, 0x15, 0x3F, 0x00, 0x62, 0x00},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p, err := Compile("test.8o", []byte(": main "+test.src))
+			require.NoError(t, err)
+			assert.Equal(t, test.want, p.Code)
+		})
+	}
+}
+
+func TestCompileControlFlow(t *testing.T) {
+	src := `
+: main
+	loop
+		while v0 != 10
+		if v0 == 5 begin
+			v1 := 1
+		else
+			draw
+		end
+		v0 += 1
+	again
+: draw
+	return
+`
+	p, err := Compile("test.8o", []byte(src))
+	require.NoError(t, err)
+	want := []byte{
+		0x40, 0x0A, // 200: while: skip the jump if v0 != 10
+		0x12, 0x12, // 202: jump out of the loop
+		0x30, 0x05, // 204: skip the jump if v0 == 5
+		0x12, 0x0C, // 206: jump to else
+		0x61, 0x01, // 208
+		0x12, 0x0E, // 20A: jump to end
+		0x22, 0x12, // 20C: else
+		0x70, 0x01, // 20E: end
+		0x12, 0x00, // 210: again
+		0x00, 0xEE, // 212
+	}
+	assert.Equal(t, want, p.Code)
+	assert.Equal(t, map[string]int{"main": 0x200, "draw": 0x212}, p.Labels)
+}
+
+func TestCompileLabels(t *testing.T) {
+	src := `
+: sprite
+	0x3C 0x3C
+: main
+	i := sprite
+	i := long data
+	:unpack 0xA data
+	:unpack long data
+	:next target v0 := 0
+	jump target
+: data
+	:pointer data
+`
+	p, err := Compile("test.8o", []byte(src))
+	require.NoError(t, err)
+	want := []byte{
+		0x12, 0x04, // jump to main
+		0x3C, 0x3C,
+		0xA2, 0x02,
+		0xF0, 0x00, 0x02, 0x16,
+		0x60, 0xA2, 0x61, 0x16,
+		0x60, 0x02, 0x61, 0x16,
+		0x60, 0x00,
+		0x12, 0x13,
+		0x02, 0x16,
+	}
+	assert.Equal(t, want, p.Code)
+	assert.Equal(t, 0x213, p.Labels["target"])
+}
+
+func TestCompileErrors(t *testing.T) {
+	testCases := map[string]struct {
+		src     string
+		wantErr string
+	}{
+		"missing_main": {
+			src:     "clear\nreturn",
+			wantErr: "test.8o:2: missing main label",
+		},
+		"undefined_label": {
+			src:     ": main\n\tjump nowhere",
+			wantErr: `test.8o:2: undefined label "nowhere"`,
+		},
+		"duplicate_label": {
+			src:     ": main\n: main",
+			wantErr: `test.8o:2: label "main" is already defined`,
+		},
+		"out_of_range": {
+			src:     ": main\n\tv0 := 256",
+			wantErr: "test.8o:2: value 256 out of range",
+		},
+		"unclosed_loop": {
+			src:     ": main\n\tloop\n\tv0 += 1",
+			wantErr: "test.8o:2: loop is not closed",
+		},
+		"else_without_if": {
+			src:     ": main\n\telse",
+			wantErr: "test.8o:2: else without if",
+		},
+		"unknown_operator": {
+			src:     ": main\n\tv0 *= 2",
+			wantErr: `test.8o:2: unknown operator "*="`,
+		},
+		"expected_register": {
+			src:     ": main\n\tsprite v0 5 5",
+			wantErr: `test.8o:2: expected register but got "5"`,
+		},
+		"unterminated_string": {
+			src:     ": main\n:assert \"oops { 1 }",
+			wantErr: "test.8o:2: unterminated string",
+		},
+		"assert": {
+			src:     ": main\n:assert \"too big\" { HERE > 0x200 }",
+			wantErr: "test.8o:2: too big",
+		},
+		"recursive_macro": {
+			src:     ":macro loop-forever { loop-forever }\n: main loop-forever",
+			wantErr: "test.8o:1: too many macro expansions",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Compile("test.8o", []byte(test.src))
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
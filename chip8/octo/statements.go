@@ -0,0 +1,702 @@
+package octo
+
+// Operators of register assignments with a register on the right side. The
+// value is the last nibble of 8XYN opcode.
+var registerOps = map[string]uint16{
+	":=":  0x0,
+	"|=":  0x1,
+	"&=":  0x2,
+	"^=":  0x3,
+	"+=":  0x4,
+	"-=":  0x5,
+	">>=": 0x6,
+	"=-":  0x7,
+	"<<=": 0xE,
+}
+
+// Statements without operands.
+var simpleStatements = map[string]uint16{
+	"clear":        0x00E0,
+	"return":       0x00EE,
+	";":            0x00EE,
+	"scroll-right": 0x00FB,
+	"scroll-left":  0x00FC,
+	"exit":         0x00FD,
+	"lores":        0x00FE,
+	"hires":        0x00FF,
+	"audio":        0xF002,
+}
+
+// Statements with a single register operand. X of the opcode is set to it.
+var registerStatements = map[string]uint16{
+	"bcd":       0xF033,
+	"saveflags": 0xF075,
+	"loadflags": 0xF085,
+}
+
+// negations of conditions used by if-begin and while.
+var negations = map[string]string{
+	"==":   "!=",
+	"!=":   "==",
+	"key":  "-key",
+	"-key": "key",
+	"<":    ">=",
+	">":    "<=",
+	"<=":   ">",
+	">=":   "<",
+}
+
+// statement compiles the next statement.
+func (c *compiler) statement() error {
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	if opcode, ok := simpleStatements[t.text]; ok {
+		return c.inst(t, opcode)
+	}
+	if opcode, ok := registerStatements[t.text]; ok {
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		return c.inst(t, opcode|uint16(x)<<8)
+	}
+	if x, ok := c.register(t); ok {
+		return c.assign(t, x)
+	}
+
+	switch t.text {
+	case ":":
+		return c.label()
+	case ":next":
+		name, err := c.next()
+		if err != nil {
+			return err
+		}
+		c.nextLabels = append(c.nextLabels, name)
+		return nil
+	case ":alias":
+		name, err := c.next()
+		if err != nil {
+			return err
+		}
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		c.aliases[name.text] = x
+		return nil
+	case ":const":
+		name, err := c.next()
+		if err != nil {
+			return err
+		}
+		v, err := c.number(-0xFFFF, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		c.consts[name.text] = float64(v)
+		return nil
+	case ":calc":
+		name, err := c.next()
+		if err != nil {
+			return err
+		}
+		if err := c.expect("{"); err != nil {
+			return err
+		}
+		v, err := c.calc()
+		if err != nil {
+			return err
+		}
+		c.consts[name.text] = v
+		return nil
+	case ":macro":
+		return c.macro()
+	case ":byte":
+		v, err := c.number(-0x80, 0xFF)
+		if err != nil {
+			return err
+		}
+		return c.emit(t, byte(v))
+	case ":pointer":
+		addr, err := c.address(c.here, fixLong, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		return c.emit(t, byte(addr>>8), byte(addr))
+	case ":org":
+		addr, err := c.number(origin, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		c.here = addr
+		c.emitted = true
+		return nil
+	case ":call":
+		return c.addressInst(t, 0x2000)
+	case ":unpack":
+		return c.unpack(t)
+	case ":assert":
+		return c.assert(t)
+	case ":breakpoint":
+		// Breakpoints of the Octo IDE are ignored.
+		_, err := c.next()
+		return err
+	case ":monitor":
+		if _, err := c.next(); err != nil {
+			return err
+		}
+		_, err := c.next()
+		return err
+	case "jump":
+		return c.addressInst(t, 0x1000)
+	case "jump0":
+		return c.addressInst(t, 0xB000)
+	case "native":
+		return c.addressInst(t, 0x0000)
+	case "save", "load":
+		return c.saveLoad(t)
+	case "sprite":
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		y, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		n, err := c.number(0, 0xF)
+		if err != nil {
+			return err
+		}
+		return c.inst(t, 0xD000|uint16(x)<<8|uint16(y)<<4|uint16(n))
+	case "scroll-down", "scroll-up":
+		n, err := c.number(0, 0xF)
+		if err != nil {
+			return err
+		}
+		opcode := uint16(0x00C0)
+		if t.text == "scroll-up" {
+			opcode = 0x00D0
+		}
+		return c.inst(t, opcode|uint16(n))
+	case "plane":
+		n, err := c.number(0, 0xF)
+		if err != nil {
+			return err
+		}
+		return c.inst(t, 0xF001|uint16(n)<<8)
+	case "delay", "buzzer", "pitch":
+		if err := c.expect(":="); err != nil {
+			return err
+		}
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		opcode := map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}[t.text]
+		return c.inst(t, opcode|uint16(x)<<8)
+	case "i":
+		return c.index(t)
+	case "if":
+		return c.ifStatement(t)
+	case "else":
+		return c.elseStatement(t)
+	case "end":
+		return c.end(t)
+	case "loop":
+		c.blocks = append(c.blocks, &block{tok: t, addr: c.here})
+		return nil
+	case "while":
+		return c.while(t)
+	case "again":
+		return c.again(t)
+	}
+
+	if m, ok := c.macros[t.text]; ok {
+		return c.expand(t, m)
+	}
+	if v, ok := parseNumber(t.text); ok {
+		// Numbers are emitted as bytes, e.g. sprite data.
+		if v < -0x80 || v > 0xFF {
+			return t.errorf("value %d out of range", v)
+		}
+		return c.emit(t, byte(v))
+	}
+	if v, ok := c.consts[t.text]; ok {
+		if v < -0x80 || v > 0xFF {
+			return t.errorf("value %d out of range", int(v))
+		}
+		return c.emit(t, byte(int(v)))
+	}
+	if !isIdentifier(t.text) {
+		return t.errorf("unexpected %q", t.text)
+	}
+	// Other names call subroutines.
+	c.pos--
+	return c.addressInst(t, 0x2000)
+}
+
+// label defines the label at the current address.
+func (c *compiler) label() error {
+	name, err := c.next()
+	if err != nil {
+		return err
+	}
+	if _, ok := c.register(name); ok || !isIdentifier(name.text) {
+		return name.errorf("invalid label name %q", name.text)
+	}
+	if _, ok := c.labels[name.text]; ok {
+		return name.errorf("label %q is already defined", name.text)
+	}
+	if name.text == "main" && !c.emitted {
+		// The jump to main is not needed if it is the first code.
+		c.rom = c.rom[:0]
+		c.here = origin
+	}
+	c.labels[name.text] = c.here
+	return nil
+}
+
+// assign compiles statements which change the register x.
+func (c *compiler) assign(t token, x int) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	rhs, err := c.next()
+	if err != nil {
+		return err
+	}
+	if y, ok := c.register(rhs); ok {
+		n, ok := registerOps[op.text]
+		if !ok {
+			return op.errorf("unknown operator %q", op.text)
+		}
+		return c.inst(t, 0x8000|uint16(x)<<8|uint16(y)<<4|n)
+	}
+
+	switch op.text + " " + rhs.text {
+	case ":= key":
+		return c.inst(t, 0xF00A|uint16(x)<<8)
+	case ":= delay":
+		return c.inst(t, 0xF007|uint16(x)<<8)
+	case ":= random":
+		n, err := c.number(-0x80, 0xFF)
+		if err != nil {
+			return err
+		}
+		return c.inst(t, 0xC000|uint16(x)<<8|uint16(byte(n)))
+	}
+
+	c.pos--
+	n, err := c.number(-0xFF, 0xFF)
+	if err != nil {
+		return err
+	}
+	switch op.text {
+	case ":=":
+		return c.inst(t, 0x6000|uint16(x)<<8|uint16(byte(n)))
+	case "+=":
+		return c.inst(t, 0x7000|uint16(x)<<8|uint16(byte(n)))
+	case "-=":
+		return c.inst(t, 0x7000|uint16(x)<<8|uint16(byte(-n)))
+	}
+	return op.errorf("unknown operator %q", op.text)
+}
+
+// index compiles statements which change the register I.
+func (c *compiler) index(t token) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	switch op.text {
+	case "+=":
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		return c.inst(t, 0xF01E|uint16(x)<<8)
+	case ":=":
+	default:
+		return op.errorf("unknown operator %q", op.text)
+	}
+
+	switch c.peekText() {
+	case "hex", "bighex":
+		kind, _ := c.next()
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		opcode := uint16(0xF029)
+		if kind.text == "bighex" {
+			opcode = 0xF030
+		}
+		return c.inst(t, opcode|uint16(x)<<8)
+	case "long":
+		c.pos++
+		if err := c.inst(t, 0xF000); err != nil {
+			return err
+		}
+		addr, err := c.address(c.here, fixLong, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		return c.emit(t, byte(addr>>8), byte(addr))
+	}
+	return c.addressInst(t, 0xA000)
+}
+
+// peekText returns the text of the next token or an empty string at the end.
+func (c *compiler) peekText() string {
+	if c.eof() {
+		return ""
+	}
+	return c.peek().text
+}
+
+// saveLoad compiles save and load of registers.
+func (c *compiler) saveLoad(t token) error {
+	x, err := c.nextRegister()
+	if err != nil {
+		return err
+	}
+	if c.peekText() == "-" {
+		c.pos++
+		y, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		opcode := uint16(0x5002)
+		if t.text == "load" {
+			opcode = 0x5003
+		}
+		return c.inst(t, opcode|uint16(x)<<8|uint16(y)<<4)
+	}
+	opcode := uint16(0xF055)
+	if t.text == "load" {
+		opcode = 0xF065
+	}
+	return c.inst(t, opcode|uint16(x)<<8)
+}
+
+// unpack compiles :unpack which loads an address into v0 and v1.
+func (c *compiler) unpack(t token) error {
+	long := c.peekText() == "long"
+	high := 0
+	if long {
+		c.pos++
+	} else {
+		var err error
+		if high, err = c.number(0, 0xF); err != nil {
+			return err
+		}
+	}
+	// Fixups point to the second bytes of both instructions.
+	hiKind, max := fixHigh, 0xFFF
+	if long {
+		hiKind, max = fixHighByte, 0xFFFF
+	}
+	fixups := len(c.fixups)
+	addr, err := c.address(c.here+1, hiKind, max)
+	if err != nil {
+		return err
+	}
+	if len(c.fixups) > fixups {
+		c.fixups = append(c.fixups, fixup{addr: c.here + 3, kind: fixLow, name: c.fixups[fixups].name})
+	}
+	hi := uint16(high<<4) | uint16(addr>>8)
+	if long {
+		hi = uint16(addr >> 8)
+	}
+	if err := c.inst(t, 0x6000|hi&0xFF); err != nil {
+		return err
+	}
+	return c.inst(t, 0x6100|uint16(addr)&0xFF)
+}
+
+// assert fails when the expression is zero.
+func (c *compiler) assert(t token) error {
+	msg := "assertion failed"
+	if !c.eof() && c.peek().quoted {
+		msg = c.peek().text
+		c.pos++
+	}
+	if err := c.expect("{"); err != nil {
+		return err
+	}
+	v, err := c.calc()
+	if err != nil {
+		return err
+	}
+	if v == 0 {
+		return t.errorf("%s", msg)
+	}
+	return nil
+}
+
+// macro defines a macro. Its body is enclosed in braces.
+func (c *compiler) macro() error {
+	name, err := c.next()
+	if err != nil {
+		return err
+	}
+	m := &macro{}
+	for {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		if arg.text == "{" {
+			break
+		}
+		m.args = append(m.args, arg.text)
+	}
+	for depth := 1; ; {
+		body, err := c.next()
+		if err != nil {
+			return err
+		}
+		switch body.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		m.body = append(m.body, body)
+	}
+	c.macros[name.text] = m
+	return nil
+}
+
+// expand replaces the macro invocation with its body.
+func (c *compiler) expand(t token, m *macro) error {
+	c.expansions++
+	if c.expansions > maxExpansions {
+		return t.errorf("too many macro expansions")
+	}
+	args := make(map[string]token)
+	for _, name := range m.args {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		args[name] = arg
+	}
+	body := make([]token, 0, len(m.body)+len(c.tokens)-c.pos)
+	for _, b := range m.body {
+		if arg, ok := args[b.text]; ok && !b.quoted {
+			b = arg
+		}
+		body = append(body, b)
+	}
+	c.tokens = append(body, c.tokens[c.pos:]...)
+	c.pos = 0
+	return nil
+}
+
+// cond is a condition of if and while.
+type cond struct {
+	x   int
+	op  token
+	rhs *token
+}
+
+// condition parses a condition.
+func (c *compiler) condition() (cond, error) {
+	x, err := c.nextRegister()
+	if err != nil {
+		return cond{}, err
+	}
+	op, err := c.next()
+	if err != nil {
+		return cond{}, err
+	}
+	if _, ok := negations[op.text]; !ok {
+		return cond{}, op.errorf("unknown condition %q", op.text)
+	}
+	cd := cond{x: x, op: op}
+	if op.text != "key" && op.text != "-key" {
+		rhs, err := c.next()
+		if err != nil {
+			return cond{}, err
+		}
+		cd.rhs = &rhs
+	}
+	return cd, nil
+}
+
+// skip emits instructions which skip the next one if the condition is false.
+// Comparisons use VF.
+func (c *compiler) skip(cd cond, negated bool) error {
+	op := cd.op.text
+	if negated {
+		op = negations[op]
+	}
+	x := uint16(cd.x) << 8
+	switch op {
+	case "key":
+		return c.inst(cd.op, 0xE0A1|x)
+	case "-key":
+		return c.inst(cd.op, 0xE09E|x)
+	}
+
+	y, isReg := c.register(*cd.rhs)
+	var n int
+	if !isReg {
+		v, known, err := c.value(*cd.rhs)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return cd.rhs.errorf("undefined name %q", cd.rhs.text)
+		}
+		if v < -0x80 || v > 0xFF {
+			return cd.rhs.errorf("value %d out of range", v)
+		}
+		n = int(byte(v))
+	}
+	switch op {
+	case "==":
+		if isReg {
+			return c.inst(cd.op, 0x9000|x|uint16(y)<<4)
+		}
+		return c.inst(cd.op, 0x4000|x|uint16(n))
+	case "!=":
+		if isReg {
+			return c.inst(cd.op, 0x5000|x|uint16(y)<<4)
+		}
+		return c.inst(cd.op, 0x3000|x|uint16(n))
+	}
+
+	// VF gets the right side, then the flag of the subtraction.
+	var err error
+	if isReg {
+		err = c.inst(cd.op, 0x8F00|uint16(y)<<4)
+	} else {
+		err = c.inst(cd.op, 0x6F00|uint16(n))
+	}
+	if err != nil {
+		return err
+	}
+	// VF -= VX sets VF when VX <= rhs, VF =- VX sets it when VX >= rhs.
+	sub := uint16(0x8F05)
+	if op == "<" || op == ">=" {
+		sub = 0x8F07
+	}
+	if err := c.inst(cd.op, sub|uint16(cd.x)<<4); err != nil {
+		return err
+	}
+	if op == "<" || op == ">" {
+		return c.inst(cd.op, 0x3F01)
+	}
+	return c.inst(cd.op, 0x3F00)
+}
+
+// ifStatement compiles if-then and if-begin.
+func (c *compiler) ifStatement(t token) error {
+	cd, err := c.condition()
+	if err != nil {
+		return err
+	}
+	kind, err := c.next()
+	if err != nil {
+		return err
+	}
+	switch kind.text {
+	case "then":
+		// The next statement is skipped if the condition is false.
+		return c.skip(cd, false)
+	case "begin":
+		// The jump to else or end is skipped if the condition is true.
+		if err := c.skip(cd, true); err != nil {
+			return err
+		}
+		c.blocks = append(c.blocks, &block{tok: t, addr: c.here})
+		return c.inst(t, 0x1000)
+	}
+	return kind.errorf("expected then or begin but got %q", kind.text)
+}
+
+func (c *compiler) elseStatement(t token) error {
+	b := c.top()
+	if b == nil || b.tok.text != "if" {
+		return t.errorf("else without if")
+	}
+	jump := c.here
+	if err := c.inst(t, 0x1000); err != nil {
+		return err
+	}
+	if err := c.patchJump(t, b.addr, c.here); err != nil {
+		return err
+	}
+	b.tok, b.addr = t, jump
+	return nil
+}
+
+func (c *compiler) end(t token) error {
+	b := c.top()
+	if b == nil || b.tok.text != "if" && b.tok.text != "else" {
+		return t.errorf("end without if")
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	return c.patchJump(t, b.addr, c.here)
+}
+
+// while jumps out of the innermost loop if the condition is false.
+func (c *compiler) while(t token) error {
+	var loop *block
+	for k := len(c.blocks) - 1; k >= 0; k-- {
+		if c.blocks[k].tok.text == "loop" {
+			loop = c.blocks[k]
+			break
+		}
+	}
+	if loop == nil {
+		return t.errorf("while without loop")
+	}
+	cd, err := c.condition()
+	if err != nil {
+		return err
+	}
+	if err := c.skip(cd, true); err != nil {
+		return err
+	}
+	loop.breaks = append(loop.breaks, c.here)
+	return c.inst(t, 0x1000)
+}
+
+func (c *compiler) again(t token) error {
+	b := c.top()
+	if b == nil || b.tok.text != "loop" {
+		return t.errorf("again without loop")
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	if b.addr > 0xFFF {
+		return t.errorf("jump target %#x does not fit into 12 bits", b.addr)
+	}
+	if err := c.inst(t, 0x1000|uint16(b.addr)); err != nil {
+		return err
+	}
+	for _, addr := range b.breaks {
+		if err := c.patchJump(t, addr, c.here); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// top returns the innermost unfinished block.
+func (c *compiler) top() *block {
+	if len(c.blocks) == 0 {
+		return nil
+	}
+	return c.blocks[len(c.blocks)-1]
+}
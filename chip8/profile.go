@@ -0,0 +1,41 @@
+package chip8
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// profileTop is the number of addresses in the profile report.
+const profileTop = 20
+
+// writeProfile writes the profile and its report.
+func (c *chip8) writeProfile() error {
+	if c.profile == nil {
+		return nil
+	}
+	if c.profilePath != "" {
+		if err := c.writeProfileFile(c.profilePath, func(f *os.File) error {
+			return c.profile.WritePprof(f, c.syms, filepath.Base(c.path))
+		}); err != nil {
+			return err
+		}
+	}
+	if c.reportPath != "" {
+		return c.writeProfileFile(c.reportPath, func(f *os.File) error {
+			return c.profile.WriteReport(f, c.ram.Memory, c.syms, profileTop)
+		})
+	}
+	return nil
+}
+
+func (c *chip8) writeProfileFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,238 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// Field numbers of messages of the pprof profile.proto.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileMapping     = 3
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+	profilePeriodType  = 11
+	profilePeriod      = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID             = 1
+	mappingMemoryLimit    = 3
+	mappingFilename       = 5
+	mappingHasFunctions   = 7
+	mappingHasFilenames   = 8
+	mappingHasLineNumbers = 9
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// romMapping is the id of the mapping which covers the whole address space.
+const romMapping = 1
+
+// WritePprof writes the profile in gzipped protobuf format of pprof. Every
+// address is a location in the function of its subroutine and call
+// instructions are frames of the stack. Source lines are taken from syms,
+// which may be nil.
+func (p *Profile) WritePprof(w io.Writer, syms *symbols.Table, rom string) error {
+	e := &pprofEncoder{
+		p:         p,
+		syms:      syms,
+		strings:   map[string]uint64{"": 0},
+		table:     []string{""},
+		functions: make(map[uint16]uint64),
+		locations: make(map[uint32]uint64),
+	}
+	cycles, count := e.str("cycles"), e.str("count")
+	valueType := func(b *pbuf) {
+		b.int(valueTypeType, cycles)
+		b.int(valueTypeUnit, count)
+	}
+
+	var out pbuf
+	out.message(profileSampleType, valueType)
+	e.samples(&out, p.root)
+	out.message(profileMapping, func(b *pbuf) {
+		b.int(mappingID, romMapping)
+		b.int(mappingMemoryLimit, 0x10000)
+		b.int(mappingFilename, e.str(rom))
+		b.bool(mappingHasFunctions, true)
+		b.bool(mappingHasFilenames, syms != nil)
+		b.bool(mappingHasLineNumbers, syms != nil)
+	})
+	out.b = append(out.b, e.defs.b...)
+	for _, s := range e.table {
+		out.bytes(profileStringTable, []byte(s))
+	}
+	out.message(profilePeriodType, valueType)
+	out.int(profilePeriod, 1)
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(out.b); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// pprofEncoder builds the string table, functions and locations while
+// samples are written.
+type pprofEncoder struct {
+	p       *Profile
+	syms    *symbols.Table
+	strings map[string]uint64
+	table   []string
+	// functions holds ids by subroutine address and locations hold ids by the
+	// address and the subroutine.
+	functions map[uint16]uint64
+	locations map[uint32]uint64
+	// defs holds encoded functions and locations.
+	defs pbuf
+}
+
+func (e *pprofEncoder) str(s string) uint64 {
+	id, ok := e.strings[s]
+	if !ok {
+		id = uint64(len(e.table))
+		e.strings[s] = id
+		e.table = append(e.table, s)
+	}
+	return id
+}
+
+func (e *pprofEncoder) function(entry uint16) uint64 {
+	if id, ok := e.functions[entry]; ok {
+		return id
+	}
+	id := uint64(len(e.functions) + 1)
+	e.functions[entry] = id
+	name := e.str(e.p.name(e.syms, entry))
+	l, _ := e.syms.Line(int(entry))
+	e.defs.message(profileFunction, func(b *pbuf) {
+		b.int(functionID, id)
+		b.int(functionName, name)
+		b.int(functionSystemName, name)
+		b.int(functionFilename, e.str(l.File))
+		b.int(functionStartLine, uint64(l.Line))
+	})
+	return id
+}
+
+func (e *pprofEncoder) location(addr, entry uint16) uint64 {
+	key := uint32(addr)<<16 | uint32(entry)
+	if id, ok := e.locations[key]; ok {
+		return id
+	}
+	id := uint64(len(e.locations) + 1)
+	e.locations[key] = id
+	fn := e.function(entry)
+	l, _ := e.syms.Line(int(addr))
+	e.defs.message(profileLocation, func(b *pbuf) {
+		b.int(locationID, id)
+		b.int(locationMappingID, romMapping)
+		b.int(locationAddress, uint64(addr))
+		b.message(locationLine, func(b *pbuf) {
+			b.int(lineFunctionID, fn)
+			b.int(lineLine, uint64(l.Line))
+		})
+	})
+	return id
+}
+
+// samples writes a sample for every address executed in the subroutine and
+// its callees. Stacks hold call instructions of the calling context.
+func (e *pprofEncoder) samples(out *pbuf, n *node) {
+	addrs := make([]int, 0, len(n.counts))
+	for addr := range n.counts {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+	for _, addr := range addrs {
+		stack := []uint64{e.location(uint16(addr), n.entry)}
+		for f := n; f.parent != nil; f = f.parent {
+			stack = append(stack, e.location(f.site, f.parent.entry))
+		}
+		out.message(profileSample, func(b *pbuf) {
+			b.packed(sampleLocationID, stack)
+			b.packed(sampleValue, []uint64{n.counts[uint16(addr)]})
+		})
+	}
+
+	keys := make([]int, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, int(key))
+	}
+	sort.Ints(keys)
+	for _, key := range keys {
+		e.samples(out, n.children[uint32(key)])
+	}
+}
+
+// pbuf encodes protocol buffers. Fields with zero values are omitted.
+type pbuf struct {
+	b []byte
+}
+
+func (p *pbuf) varint(v uint64) {
+	for v >= 0x80 {
+		p.b = append(p.b, byte(v)|0x80)
+		v >>= 7
+	}
+	p.b = append(p.b, byte(v))
+}
+
+func (p *pbuf) tag(field, wire int) {
+	p.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (p *pbuf) int(field int, v uint64) {
+	if v != 0 {
+		p.tag(field, 0)
+		p.varint(v)
+	}
+}
+
+func (p *pbuf) bool(field int, v bool) {
+	if v {
+		p.int(field, 1)
+	}
+}
+
+func (p *pbuf) bytes(field int, b []byte) {
+	p.tag(field, 2)
+	p.varint(uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+func (p *pbuf) packed(field int, vs []uint64) {
+	var q pbuf
+	for _, v := range vs {
+		q.varint(v)
+	}
+	p.bytes(field, q.b)
+}
+
+func (p *pbuf) message(field int, f func(b *pbuf)) {
+	var q pbuf
+	f(&q)
+	p.bytes(field, q.b)
+}
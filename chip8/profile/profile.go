@@ -0,0 +1,178 @@
+// Package profile counts executed instructions of CHIP-8 programs by address
+// and by subroutine. Subroutines are tracked with 2NNN calls and 00EE
+// returns, so cycles of a subroutine are known for every calling context.
+package profile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// Profile counts executed instructions.
+type Profile struct {
+	root *node
+	// cur is the subroutine being executed.
+	cur   *node
+	total uint64
+	// counts holds cycles by address.
+	counts map[uint16]uint64
+	// calls holds the number of calls by the subroutine address.
+	calls map[uint16]uint64
+}
+
+// node is a subroutine in a calling context.
+type node struct {
+	entry uint16
+	// site is the address of the call instruction.
+	site     uint16
+	parent   *node
+	children map[uint32]*node
+	// counts holds cycles by address.
+	counts map[uint16]uint64
+}
+
+func newNode(parent *node, site, entry uint16) *node {
+	return &node{
+		entry:    entry,
+		site:     site,
+		parent:   parent,
+		children: make(map[uint32]*node),
+		counts:   make(map[uint16]uint64),
+	}
+}
+
+// child returns the subroutine called from site.
+func (n *node) child(site, entry uint16) *node {
+	key := uint32(site)<<16 | uint32(entry)
+	c, ok := n.children[key]
+	if !ok {
+		c = newNode(n, site, entry)
+		n.children[key] = c
+	}
+	return c
+}
+
+// New creates a profile of the program which starts at entry.
+func New(entry uint16) *Profile {
+	root := newNode(nil, 0, entry)
+	return &Profile{
+		root:   root,
+		cur:    root,
+		counts: make(map[uint16]uint64),
+		calls:  make(map[uint16]uint64),
+	}
+}
+
+// Exec counts the instruction at pc. Calls and returns move between
+// subroutines. Returns from the program entry are ignored.
+func (p *Profile) Exec(pc, opcode uint16) {
+	p.total++
+	p.counts[pc]++
+	p.cur.counts[pc]++
+	switch {
+	case opcode&0xF000 == 0x2000:
+		entry := opcode & 0x0FFF
+		p.calls[entry]++
+		p.cur = p.cur.child(pc, entry)
+	case opcode == 0x00EE && p.cur.parent != nil:
+		p.cur = p.cur.parent
+	}
+}
+
+// Total returns the number of executed instructions.
+func (p *Profile) Total() uint64 {
+	return p.total
+}
+
+// Addr holds cycles of an instruction.
+type Addr struct {
+	Addr   uint16
+	Cycles uint64
+}
+
+// Top returns n addresses with most cycles. All addresses are returned if n
+// is zero.
+func (p *Profile) Top(n int) []Addr {
+	addrs := make([]Addr, 0, len(p.counts))
+	for addr, cycles := range p.counts {
+		addrs = append(addrs, Addr{Addr: addr, Cycles: cycles})
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Cycles != addrs[j].Cycles {
+			return addrs[i].Cycles > addrs[j].Cycles
+		}
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	if n > 0 && n < len(addrs) {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// Subroutine holds cycles of a subroutine. Exclusive cycles are spent in the
+// subroutine itself, inclusive ones include called subroutines.
+type Subroutine struct {
+	Entry     uint16
+	Calls     uint64
+	Exclusive uint64
+	Inclusive uint64
+}
+
+// Subroutines returns subroutines ordered by inclusive cycles. The program
+// entry is included as a subroutine without calls.
+func (p *Profile) Subroutines() []Subroutine {
+	subs := make(map[uint16]*Subroutine)
+	// path counts subroutines in the calling context, so cycles of recursive
+	// calls are included once.
+	path := make(map[uint16]int)
+	var walk func(n *node)
+	walk = func(n *node) {
+		path[n.entry]++
+		self := uint64(0)
+		for _, cycles := range n.counts {
+			self += cycles
+		}
+		s, ok := subs[n.entry]
+		if !ok {
+			s = &Subroutine{Entry: n.entry, Calls: p.calls[n.entry]}
+			subs[n.entry] = s
+		}
+		s.Exclusive += self
+		for entry, k := range path {
+			if k > 0 {
+				subs[entry].Inclusive += self
+			}
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+		path[n.entry]--
+	}
+	walk(p.root)
+
+	list := make([]Subroutine, 0, len(subs))
+	for _, s := range subs {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Inclusive != list[j].Inclusive {
+			return list[i].Inclusive > list[j].Inclusive
+		}
+		return list[i].Entry < list[j].Entry
+	})
+	return list
+}
+
+// name returns the label of the subroutine. Subroutines without labels are
+// named like in the disassembly.
+func (p *Profile) name(syms *symbols.Table, entry uint16) string {
+	if name := syms.Label(int(entry)); name != "" {
+		return name
+	}
+	if entry == p.root.entry {
+		return "main"
+	}
+	return fmt.Sprintf("sub_%03X", entry)
+}
@@ -0,0 +1,120 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// program is executed by run. The main loop calls draw which calls sprite.
+var program = map[uint16]uint16{
+	0x200: 0x2208, // CALL draw
+	0x202: 0x1200, // JP main
+	0x208: 0x220E, // draw: CALL sprite
+	0x20A: 0x00EE, // RET
+	0x20E: 0xD015, // sprite: DRW V0, V1, 5
+	0x210: 0x00EE, // RET
+}
+
+// run loads the program to mem and profiles given number of cycles.
+func run(p *Profile, mem []byte, start uint16, cycles int) {
+	for addr, opcode := range program {
+		mem[addr], mem[addr+1] = byte(opcode>>8), byte(opcode)
+	}
+	pc := start
+	var stack []uint16
+	for n := 0; n < cycles; n++ {
+		opcode := program[pc]
+		p.Exec(pc, opcode)
+		switch {
+		case opcode&0xF000 == 0x1000:
+			pc = opcode & 0xFFF
+		case opcode&0xF000 == 0x2000:
+			stack = append(stack, pc+2)
+			pc = opcode & 0xFFF
+		case opcode == 0x00EE:
+			pc = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		default:
+			pc += 2
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	p := New(0x200)
+	run(p, make([]byte, 0x300), 0x200, 60)
+
+	assert.Equal(t, uint64(60), p.Total())
+	assert.Equal(t, []Addr{{Addr: 0x200, Cycles: 10}, {Addr: 0x202, Cycles: 10}}, p.Top(2))
+	assert.Len(t, p.Top(0), 6)
+	assert.Equal(t, []Subroutine{
+		{Entry: 0x200, Calls: 0, Exclusive: 20, Inclusive: 60},
+		{Entry: 0x208, Calls: 10, Exclusive: 20, Inclusive: 40},
+		{Entry: 0x20E, Calls: 10, Exclusive: 20, Inclusive: 20},
+	}, p.Subroutines())
+}
+
+func TestProfileRecursion(t *testing.T) {
+	p := New(0x200)
+	p.Exec(0x200, 0x2300)
+	p.Exec(0x300, 0x2300)
+	p.Exec(0x300, 0x00E0)
+	p.Exec(0x302, 0x00EE)
+	p.Exec(0x302, 0x00EE)
+	// Returns from the entry are ignored.
+	p.Exec(0x202, 0x00EE)
+
+	subs := p.Subroutines()
+	require.Len(t, subs, 2)
+	assert.Equal(t, Subroutine{Entry: 0x200, Exclusive: 2, Inclusive: 6}, subs[0])
+	assert.Equal(t, Subroutine{Entry: 0x300, Calls: 2, Exclusive: 4, Inclusive: 4}, subs[1])
+}
+
+func TestWriteReport(t *testing.T) {
+	p := New(0x200)
+	mem := make([]byte, 0x300)
+	run(p, mem, 0x200, 6)
+	syms := symbols.New()
+	syms.AddLabel(0x208, "draw")
+
+	var b bytes.Buffer
+	require.NoError(t, p.WriteReport(&b, mem, syms, 2))
+	want := `Total cycles: 6
+
+    cycles       %  addr  instruction
+         1  16.67%  0200  CALL draw
+         1  16.67%  0202  JP #200
+
+ inclusive       %  exclusive       %    calls  subroutine
+         6 100.00%          2  33.33%        0  main
+         4  66.67%          2  33.33%        1  draw
+         2  33.33%          2  33.33%        1  sub_20E
+`
+	assert.Equal(t, want, b.String())
+}
+
+func TestWritePprof(t *testing.T) {
+	p := New(0x200)
+	run(p, make([]byte, 0x300), 0x200, 6)
+	syms := symbols.New()
+	syms.AddLabel(0x208, "draw")
+	syms.AddLine(0x208, symbols.Line{File: "game.8o", Line: 7, Text: "sprite"})
+
+	var b bytes.Buffer
+	require.NoError(t, p.WritePprof(&b, syms, "game.ch8"))
+	z, err := gzip.NewReader(&b)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(z)
+	require.NoError(t, err)
+	for _, s := range []string{"cycles", "count", "main", "draw", "sub_20E", "game.8o", "game.ch8"} {
+		assert.Contains(t, string(data), s)
+	}
+	// The sample type is the first field.
+	assert.Equal(t, []byte{profileSampleType<<3 | 2, 4, valueTypeType << 3, 1, valueTypeUnit << 3, 2}, data[:6])
+}
@@ -0,0 +1,42 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// WriteReport writes top addresses with their instructions and cycles of
+// subroutines. Instructions are decoded from mem and named with syms, which
+// may be nil.
+func (p *Profile) WriteReport(w io.Writer, mem []byte, syms *symbols.Table, top int) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "Total cycles: %d\n\n", p.total)
+
+	fmt.Fprintf(b, "%10s %7s  %-4s  %s\n", "cycles", "%", "addr", "instruction")
+	for _, a := range p.Top(top) {
+		i := disasm.Decode(mem, int(a.Addr))
+		fmt.Fprintf(b, "%10d %6.2f%%  %04X  %s", a.Cycles, p.percent(a.Cycles), a.Addr, i.Format(syms.Label))
+		if where := syms.Describe(int(a.Addr)); where != "" {
+			fmt.Fprintf(b, "\t; %s", where)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(b, "\n%10s %7s %10s %7s %8s  %s\n", "inclusive", "%", "exclusive", "%", "calls", "subroutine")
+	for _, s := range p.Subroutines() {
+		fmt.Fprintf(b, "%10d %6.2f%% %10d %6.2f%% %8d  %s\n", s.Inclusive, p.percent(s.Inclusive),
+			s.Exclusive, p.percent(s.Exclusive), s.Calls, p.name(syms, s.Entry))
+	}
+	return b.Flush()
+}
+
+func (p *Profile) percent(cycles uint64) float64 {
+	if p.total == 0 {
+		return 0
+	}
+	return float64(cycles) * 100 / float64(p.total)
+}
@@ -0,0 +1,43 @@
+package chip8
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	profilePath := filepath.Join(dir, "cpu.pprof")
+	reportPath := filepath.Join(dir, "report.txt")
+
+	c := newTestChip8(t, Ctx{path: binaryPath, profile: profilePath, profileReport: reportPath})
+	require.NoError(t, c.start())
+	// CALL 206, JP 200, RET at 206.
+	copy(c.ram.Memory[programStartPos:], []byte{0x22, 0x06, 0x12, 0x00, 0x00, 0x00, 0x00, 0xEE})
+	require.NoError(t, c.Step(30))
+	require.NoError(t, c.writeProfile())
+
+	assert.Equal(t, uint64(30), c.profile.Total())
+	report, err := ioutil.ReadFile(reportPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "Total cycles: 30\n")
+	assert.Contains(t, string(report), "        10  33.33%  0200  CALL #206\n")
+	assert.Contains(t, string(report), "        10  33.33%         10  33.33%       10  sub_206\n")
+	info, err := os.Stat(profilePath)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Size())
+}
+
+func TestProfileDisabled(t *testing.T) {
+	c := newTestChip8(t, Ctx{path: binaryPath})
+	require.NoError(t, c.start())
+	assert.Nil(t, c.profile)
+	assert.NoError(t, c.writeProfile())
+}
@@ -0,0 +1,77 @@
+package chip8
+
+import (
+	"sort"
+	"strings"
+)
+
+// MemoryIncrement defines how FX55 and FX65 change I register.
+type MemoryIncrement int
+
+const (
+	// IncrementNone leaves I untouched.
+	IncrementNone MemoryIncrement = iota
+	// IncrementX increments I by X.
+	IncrementX
+	// IncrementXPlusOne increments I by X + 1.
+	IncrementXPlusOne
+)
+
+// Quirks holds behaviour which differs between CHIP-8 implementations. Zero
+// value keeps the original behaviour of this emulator.
+type Quirks struct {
+	// ShiftVX makes 8XY6 and 8XYE shift VX in place instead of VY.
+	ShiftVX bool
+	// LoadStore defines how FX55 and FX65 change I.
+	LoadStore MemoryIncrement
+	// JumpVX makes BXNN jump to XNN + VX instead of NNN + V0.
+	JumpVX bool
+	// VFReset resets VF to 0 after 8XY1, 8XY2 and 8XY3.
+	VFReset bool
+	// Wrap draws sprite parts which do not fit on the screen at the opposite
+	// edge instead of clipping them.
+	Wrap bool
+	// DisplayWait makes DXYN wait for the vertical blank interrupt, which
+	// limits drawing to one sprite per frame.
+	DisplayWait bool
+	// ExtendedMemory enables 64KB address space of XO-CHIP.
+	ExtendedMemory bool
+}
+
+// quirksProfiles holds quirks of known CHIP-8 implementations.
+var quirksProfiles = map[string]Quirks{
+	"chip8": {
+		LoadStore:   IncrementXPlusOne,
+		VFReset:     true,
+		DisplayWait: true,
+	},
+	"chip48": {
+		ShiftVX:   true,
+		LoadStore: IncrementX,
+		JumpVX:    true,
+	},
+	"schip": {
+		ShiftVX: true,
+		JumpVX:  true,
+	},
+	"xochip": {
+		LoadStore:      IncrementXPlusOne,
+		Wrap:           true,
+		ExtendedMemory: true,
+	},
+}
+
+// QuirksProfiles returns sorted names of known quirks profiles.
+func QuirksProfiles() []string {
+	names := make([]string, 0, len(quirksProfiles))
+	for name := range quirksProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// quirksUsage describes the quirks command line flag.
+func quirksUsage() string {
+	return "Quirks profile: " + strings.Join(QuirksProfiles(), ", ")
+}
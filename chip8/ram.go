@@ -1,35 +1,70 @@
 package chip8
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+
+	"github.com/Pawka/chip8-emulator/chip8/octo"
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
 )
 
 const memorySize = 4096
 
+// extendedMemorySize is size of XO-CHIP memory.
+const extendedMemorySize = 0x10000
+
 // programStartPos defines position in the memory where programs should be
 // loaded.
 const programStartPos = 0x200
 
 type ram struct {
 	Memory []byte
+	// romHash is SHA-256 of the loaded rom.
+	romHash [sha256.Size]byte
+	// size is the size of the loaded rom.
+	size int
+	// symbols of the rom compiled from source or nil.
+	symbols *symbols.Table
 }
 
-func newRAM() *ram {
+func newRAM(size int) *ram {
 	return &ram{
-		Memory: make([]byte, memorySize),
+		Memory: make([]byte, size),
 	}
 }
 
-// Load program to memory.
+// Load program to memory. Octo source files with .8o extension are compiled.
 func (r *ram) Load(path string) error {
-	b, err := ioutil.ReadFile(path)
+	b, syms, err := ReadROM(path)
 	if err != nil {
-		return fmt.Errorf("failed load rom at path %q: %s", path, err)
+		return err
 	}
-	for k, v := range b {
-		r.Memory[programStartPos+k] = v
+	if len(b) > len(r.Memory)-programStartPos {
+		return fmt.Errorf("rom at path %q is too large: %d bytes", path, len(b))
 	}
+	copy(r.Memory[programStartPos:], b)
+	r.romHash = sha256.Sum256(b)
+	r.size = len(b)
+	r.symbols = syms
 
 	return nil
 }
+
+// ReadROM reads the rom or compiles Octo source at path. Symbols are
+// returned for compiled sources only.
+func ReadROM(path string) ([]byte, *symbols.Table, error) {
+	if filepath.Ext(path) == ".8o" {
+		p, err := octo.CompileFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return p.Code, p.Table(), nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed load rom at path %q: %s", path, err)
+	}
+	return b, nil, nil
+}
@@ -9,8 +9,16 @@ import (
 const binaryPath = "testdata/binary"
 
 func TestLoad(t *testing.T) {
-	ram := newRAM()
+	ram := newRAM(memorySize)
 	ram.Load(binaryPath)
 	want := []byte{0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x0a}
 	assert.Equal(t, want, ram.Memory[programStartPos:programStartPos+len(want)])
 }
+
+func TestLoadOctoSource(t *testing.T) {
+	ram := newRAM(memorySize)
+	assert.NoError(t, ram.Load("testdata/draw.8o"))
+	want := []byte{0x60, 0x00, 0xF0, 0x29, 0xD0, 0x05, 0x12, 0x06}
+	assert.Equal(t, want, ram.Memory[programStartPos:programStartPos+len(want)])
+	assert.Equal(t, len(want), ram.size)
+}
@@ -0,0 +1,259 @@
+package chip8
+
+import "encoding/binary"
+
+// Default limits of the rewind buffer.
+const (
+	// defaultRewindDepth keeps 10 seconds of gameplay.
+	defaultRewindDepth = 10 * frameRate
+	// defaultRewindMemory is the memory budget in megabytes.
+	defaultRewindMemory = 16
+)
+
+// rewindHold is the number of frames rewound after a single rewind command.
+// Terminals repeat held keys slower than the frame rate, so rewinding
+// continues until the next repeated key arrives.
+const rewindHold = 6
+
+// rewindEntry is a machine state in the rewind buffer.
+type rewindEntry struct {
+	// delta is XOR of this state and the previous one compressed with
+	// run-length encoding of zero bytes. The oldest entry has no delta.
+	delta []byte
+	// prevSize is the size of the previous state.
+	prevSize int
+	// cycles is the number of instructions executed after this state until
+	// the next one is stored.
+	cycles int
+	// keys are keys polled during these instructions.
+	keys []rewindKey
+}
+
+// rewindKey is a key returned by a poll of the keyboard. poll is the index of
+// the poll since the state was stored.
+type rewindKey struct {
+	poll int
+	key  rune
+}
+
+// rewinder is a ring buffer of machine states stored at the start of every
+// frame. Only the newest state is kept in full, older ones are restored by
+// applying deltas backwards.
+type rewinder struct {
+	depth  int
+	budget int
+
+	entries []rewindEntry
+	// start is the index of the oldest entry, n is the number of entries.
+	start, n int
+	// size is the total size of deltas in bytes.
+	size int
+
+	// last is the newest state.
+	last []byte
+	// cycles is the number of instructions executed since the newest state.
+	cycles int
+	// keys are keys polled since the newest state and polls is the number of
+	// polls. Instructions executed again get the same keys.
+	keys  []rewindKey
+	polls int
+	// replaying is set while instructions are executed again.
+	replaying bool
+	// hold is the number of frames left to rewind.
+	hold int
+}
+
+// newRewinder creates the buffer which keeps up to depth states within the
+// memory budget in bytes. Zero depth disables rewinding.
+func newRewinder(depth, budget int) *rewinder {
+	return &rewinder{
+		depth:   depth,
+		budget:  budget,
+		entries: make([]rewindEntry, depth),
+	}
+}
+
+func (r *rewinder) index(k int) int {
+	return (r.start + k) % len(r.entries)
+}
+
+// push stores the state as the newest one.
+func (r *rewinder) push(state []byte) {
+	if r.depth == 0 {
+		return
+	}
+	e := rewindEntry{}
+	if r.n > 0 {
+		r.entries[r.index(r.n-1)].cycles = r.cycles
+		r.entries[r.index(r.n-1)].keys = r.keys
+		e.delta = compressDelta(xorStates(state, r.last))
+		e.prevSize = len(r.last)
+	}
+	if r.n == r.depth {
+		r.evict()
+	}
+	r.entries[r.index(r.n)] = e
+	r.n++
+	r.size += len(e.delta)
+	r.last = state
+	r.cycles = 0
+	r.keys, r.polls = nil, 0
+
+	for r.size > r.budget && r.n > 1 {
+		r.evict()
+	}
+}
+
+// evict drops the oldest state. The next state becomes the oldest one, so
+// its delta is not needed anymore.
+func (r *rewinder) evict() {
+	r.size -= len(r.entries[r.start].delta)
+	r.entries[r.start] = rewindEntry{}
+	r.start = r.index(1)
+	r.n--
+	if r.n > 0 {
+		r.size -= len(r.entries[r.start].delta)
+		r.entries[r.start].delta = nil
+	}
+}
+
+// pop drops the newest state and makes the previous one the newest. It
+// returns false if there is no previous state.
+func (r *rewinder) pop() bool {
+	if r.n < 2 {
+		return false
+	}
+	newest := r.entries[r.index(r.n-1)]
+	delta := decompressDelta(newest.delta, maxInt(len(r.last), newest.prevSize))
+	r.last = xorStates(delta, r.last)[:newest.prevSize]
+	r.size -= len(newest.delta)
+	r.entries[r.index(r.n-1)] = rewindEntry{}
+	r.n--
+	r.cycles = r.entries[r.index(r.n-1)].cycles
+	r.keys = r.entries[r.index(r.n-1)].keys
+	return true
+}
+
+// pollKey returns the key polled when instructions were executed first while
+// they are executed again. Otherwise the key is recorded.
+func (r *rewinder) pollKey(key *rune) *rune {
+	poll := r.polls
+	r.polls++
+	if r.replaying {
+		for _, k := range r.keys {
+			if k.poll == poll {
+				key := k.key
+				return &key
+			}
+		}
+		return nil
+	}
+	if key != nil && r.depth > 0 {
+		r.keys = append(r.keys, rewindKey{poll, *key})
+	}
+	return key
+}
+
+// rewindFrame restores the state at the start of the current frame or the
+// previous one if no instructions were executed since then.
+func (c *chip8) rewindFrame() bool {
+	r := c.rewind
+	if r.n == 0 || (r.cycles == 0 && !r.pop()) {
+		return false
+	}
+	c.decodeState(r.last)
+	r.cycles = 0
+	r.keys, r.polls = nil, 0
+	return true
+}
+
+// stepBack restores the state before the last instruction. The state is
+// restored from the start of the frame and instructions are executed again
+// with keys polled the first time.
+func (c *chip8) stepBack() bool {
+	r := c.rewind
+	if r.n == 0 || (r.cycles == 0 && !r.pop()) {
+		return false
+	}
+	c.decodeState(r.last)
+	cycles := r.cycles - 1
+	r.polls = 0
+	r.replaying = true
+	for n := 0; n < cycles; n++ {
+		if err := c.exec(c.pc); err != nil {
+			break
+		}
+	}
+	r.replaying = false
+	r.cycles = cycles
+	// Keys polled by the undone instruction are polled again.
+	for k, key := range r.keys {
+		if key.poll >= r.polls {
+			r.keys = r.keys[:k]
+			break
+		}
+	}
+	// Writes done again must not trigger watchpoints.
+	c.dbg.hit = ""
+	return true
+}
+
+// xorStates returns XOR of states. The shorter state is padded with zeros.
+func xorStates(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	out := make([]byte, len(a))
+	copy(out, a)
+	for k, v := range b {
+		out[k] ^= v
+	}
+	return out
+}
+
+// compressDelta encodes delta as pairs of zero bytes count and literal bytes
+// count followed by the literal bytes. Counts are unsigned varints.
+func compressDelta(delta []byte) []byte {
+	out := []byte{}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for k := 0; k < len(delta); {
+		zeros := k
+		for k < len(delta) && delta[k] == 0 {
+			k++
+		}
+		zeros = k - zeros
+		literal := k
+		for k < len(delta) && delta[k] != 0 {
+			k++
+		}
+		out = append(out, buf[:binary.PutUvarint(buf, uint64(zeros))]...)
+		out = append(out, buf[:binary.PutUvarint(buf, uint64(k-literal))]...)
+		out = append(out, delta[literal:k]...)
+	}
+	return out
+}
+
+// decompressDelta decodes delta encoded with compressDelta into size bytes.
+func decompressDelta(data []byte, size int) []byte {
+	out := make([]byte, 0, size)
+	for len(data) > 0 {
+		zeros, n := binary.Uvarint(data)
+		data = data[n:]
+		literal, n := binary.Uvarint(data)
+		data = data[n:]
+		out = append(out, make([]byte, zeros)...)
+		out = append(out, data[:literal]...)
+		data = data[literal:]
+	}
+	for len(out) < size {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,160 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressDelta(t *testing.T) {
+	testCases := map[string][]byte{
+		"empty":         {},
+		"zeros":         make([]byte, 300),
+		"literal":       {1, 2, 3},
+		"mixed":         {0, 0, 1, 2, 0, 0, 0, 3},
+		"trailing_zero": {4, 0, 0},
+	}
+	for name, delta := range testCases {
+		t.Run(name, func(t *testing.T) {
+			compressed := compressDelta(delta)
+			assert.Equal(t, delta, decompressDelta(compressed, len(delta)))
+		})
+	}
+	assert.Len(t, compressDelta(make([]byte, 4096)), 3)
+}
+
+func TestRewinderRing(t *testing.T) {
+	r := newRewinder(3, 1<<20)
+	assert.False(t, r.pop())
+
+	r.push([]byte{1, 1})
+	r.cycles = 5
+	r.push([]byte{1, 2, 3})
+	r.cycles = 7
+	r.push([]byte{2, 2})
+	r.push([]byte{3, 2})
+	assert.Equal(t, 3, r.n)
+
+	require.True(t, r.pop())
+	assert.Equal(t, []byte{2, 2}, r.last)
+	assert.Equal(t, 0, r.cycles)
+	require.True(t, r.pop())
+	assert.Equal(t, []byte{1, 2, 3}, r.last)
+	assert.Equal(t, 7, r.cycles)
+	// The oldest state was evicted.
+	assert.False(t, r.pop())
+}
+
+func TestRewinderBudget(t *testing.T) {
+	r := newRewinder(10, 8)
+	r.push([]byte{0, 0, 0, 0})
+	r.push([]byte{1, 1, 1, 1})
+	r.push([]byte{2, 2, 2, 2})
+	assert.Equal(t, 2, r.n)
+	assert.LessOrEqual(t, r.size, 8)
+
+	r = newRewinder(0, 8)
+	r.push([]byte{1})
+	assert.Equal(t, 0, r.n)
+}
+
+func TestRewindFrame(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{rewindDepth: 10, rewindMemory: 1})
+
+	// Every frame executes one instruction.
+	require.NoError(t, ch.frame(1))
+	require.NoError(t, ch.frame(1))
+	require.NoError(t, ch.frame(1))
+	assert.Equal(t, uint16(0x20A), ch.pc)
+
+	d := &controllerMock{commands: []display.Command{display.CommandRewind}}
+	ch.display = d
+	require.NoError(t, ch.frame(1))
+	assert.Equal(t, uint16(0x208), ch.pc)
+	require.NoError(t, ch.frame(1))
+	assert.Equal(t, uint16(0x202), ch.pc)
+	require.NoError(t, ch.frame(1))
+	assert.Equal(t, uint16(0x200), ch.pc)
+	assert.Equal(t, byte(0), ch.v[0])
+	assert.Len(t, ch.stack, 0)
+
+	// There is nothing to rewind further.
+	require.NoError(t, ch.frame(1))
+	assert.Equal(t, uint16(0x200), ch.pc)
+
+	ch.rewind.hold = 0
+	require.NoError(t, ch.frame(1))
+	assert.Equal(t, uint16(0x202), ch.pc)
+}
+
+func TestStepBack(t *testing.T) {
+	ch := newDebugChip8(t, Ctx{rewindDepth: 10, rewindMemory: 1, breakpoints: []uint16{0x20C}})
+
+	require.NoError(t, ch.frame(2))
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x20C), ch.pc)
+	assert.Equal(t, byte(5), ch.ram.Memory[0x300])
+
+	d := &controllerMock{commands: []display.Command{display.CommandStepBack}}
+	ch.display = d
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x20A), ch.pc)
+	assert.Equal(t, 0x300, ch.i)
+	assert.Equal(t, byte(0), ch.ram.Memory[0x300])
+
+	d.commands = []display.Command{display.CommandStepBack}
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x208), ch.pc)
+
+	// The previous frame is restored and executed again.
+	d.commands = []display.Command{display.CommandStepBack}
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x202), ch.pc)
+	assert.Equal(t, byte(5), ch.v[0])
+	assert.True(t, ch.dbg.paused)
+
+	// Step back is ignored while the program is running.
+	ch.dbg.resume()
+	ch.rewind.cycles = 1
+	d.commands = []display.Command{display.CommandStepBack}
+	ch.commands()
+	assert.Equal(t, uint16(0x202), ch.pc)
+}
+
+func TestStepBackReplaysKeys(t *testing.T) {
+	ch := newTestChip8(t, Ctx{rewindDepth: 10, rewindMemory: 1, breakpoints: []uint16{0x204}})
+	ch.started = true
+	copy(ch.ram.Memory[programStartPos:], []byte{
+		0xF0, 0x0A, // 200: LD V0, K
+		0x61, 0x07, // 202: LD V1, 07
+		0x12, 0x04, // 204: JP 204
+	})
+	w, q := 'w', 'q'
+	d := &controllerMock{}
+	d.keys = []*rune{nil, nil, &w}
+	ch.display = d
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x204), ch.pc)
+	assert.Equal(t, byte(5), ch.v[0])
+
+	// The key pressed while paused is left for the program.
+	d.keys = []*rune{&q}
+	d.lines = nil
+	d.commands = []display.Command{display.CommandStepBack}
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x202), ch.pc)
+	assert.Equal(t, byte(5), ch.v[0])
+	assert.Equal(t, byte(0), ch.v[1])
+	assert.Equal(t, []*rune{&q}, d.keys)
+	assert.Empty(t, d.lines)
+
+	// Undone polls are not replayed.
+	d.commands = []display.Command{display.CommandStepBack}
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, uint16(0x200), ch.pc)
+	assert.Equal(t, byte(0), ch.v[0])
+	assert.Empty(t, ch.rewind.keys)
+}
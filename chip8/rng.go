@@ -0,0 +1,24 @@
+package chip8
+
+// rng is xorshift64* pseudo random number generator. Its state is a part of
+// the machine state, so runs with the same seed are reproducible.
+type rng struct {
+	state uint64
+}
+
+func newRNG(seed int64) rng {
+	state := uint64(seed) ^ 0x9E3779B97F4A7C15
+	if state == 0 {
+		// Zero state generates only zeros.
+		state = 0x9E3779B97F4A7C15
+	}
+	return rng{state: state}
+}
+
+// byte returns the next random byte.
+func (r *rng) byte() byte {
+	r.state ^= r.state >> 12
+	r.state ^= r.state << 25
+	r.state ^= r.state >> 27
+	return byte((r.state * 0x2545F4914F6CDD1D) >> 56)
+}
@@ -0,0 +1,36 @@
+package chip8
+
+import "time"
+
+// frameRate is the rate of timers and display refresh in Hz.
+const frameRate = 60
+
+// defaultCyclesPerSecond is the default CPU speed.
+const defaultCyclesPerSecond = 600
+
+// scheduler splits CPU cycles between frames. When the number of cycles per
+// second is not divisible by the frame rate, the remainder is spread evenly
+// over frames of a second.
+type scheduler struct {
+	cyclesPerSecond int
+	frame           int
+}
+
+func newScheduler(cyclesPerSecond int) *scheduler {
+	if cyclesPerSecond <= 0 {
+		cyclesPerSecond = defaultCyclesPerSecond
+	}
+	return &scheduler{cyclesPerSecond: cyclesPerSecond}
+}
+
+// next returns the number of cycles to execute during the next frame.
+func (s *scheduler) next() int {
+	n := (s.frame+1)*s.cyclesPerSecond/frameRate - s.frame*s.cyclesPerSecond/frameRate
+	s.frame = (s.frame + 1) % frameRate
+	return n
+}
+
+// ticker returns a ticker which fires once per frame.
+func (s *scheduler) ticker() *time.Ticker {
+	return time.NewTicker(time.Second / frameRate)
+}
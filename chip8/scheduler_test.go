@@ -0,0 +1,111 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerSpreadsCyclesOverSecond(t *testing.T) {
+	testCases := map[string]struct {
+		cyclesPerSecond int
+		wantFirst       []int
+	}{
+		"divisible_by_frame_rate": {
+			cyclesPerSecond: 600,
+			wantFirst:       []int{10, 10, 10},
+		},
+		"not_divisible_by_frame_rate": {
+			cyclesPerSecond: 90,
+			wantFirst:       []int{1, 2, 1},
+		},
+		"slower_than_frame_rate": {
+			cyclesPerSecond: 30,
+			wantFirst:       []int{0, 1, 0},
+		},
+		"default_speed": {
+			cyclesPerSecond: 0,
+			wantFirst:       []int{10, 10, 10},
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s := newScheduler(test.cyclesPerSecond)
+			total := 0
+			for f := 0; f < frameRate; f++ {
+				n := s.next()
+				if f < len(test.wantFirst) {
+					assert.Equal(t, test.wantFirst[f], n)
+				}
+				total += n
+			}
+			assert.Equal(t, s.cyclesPerSecond, total)
+		})
+	}
+}
+
+func TestFrameTicksTimersOnce(t *testing.T) {
+	ch := newTestChip8(t, Ctx{})
+	ch.display = &displayMock{}
+	// ADD V0, 1; JP 0x200
+	copy(ch.ram.Memory[0x200:], []byte{0x70, 0x01, 0x12, 0x00})
+	ch.delayTimer = 10
+	ch.soundTimer = 1
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, byte(5), ch.v[0])
+	assert.Equal(t, byte(9), ch.delayTimer)
+	assert.Equal(t, byte(0), ch.soundTimer)
+	assert.True(t, ch.vblank)
+
+	require.NoError(t, ch.frame(10))
+	assert.Equal(t, byte(10), ch.v[0])
+	assert.Equal(t, byte(8), ch.delayTimer)
+	assert.Equal(t, byte(0), ch.soundTimer)
+}
+
+type audioMock struct {
+	frames  []bool
+	pattern []byte
+	pitch   byte
+}
+
+func (a *audioMock) SetPattern(pattern []byte, pitch byte) {
+	a.pattern = append([]byte(nil), pattern...)
+	a.pitch = pitch
+}
+
+func (a *audioMock) Frame(active bool) {
+	a.frames = append(a.frames, active)
+}
+
+func (a *audioMock) Close() error {
+	return nil
+}
+
+func TestFrameOutputsSoundWhileSoundTimerIsActive(t *testing.T) {
+	ch := newTestChip8(t, Ctx{})
+	ch.display = &displayMock{}
+	a := &audioMock{}
+	ch.audio = a
+	// JP 0x200
+	copy(ch.ram.Memory[0x200:], []byte{0x12, 0x00})
+	ch.soundTimer = 2
+
+	for f := 0; f < 4; f++ {
+		require.NoError(t, ch.frame(1))
+	}
+	assert.Equal(t, []bool{true, true, false, false}, a.frames)
+}
+
+func TestFrameStopsOnExit(t *testing.T) {
+	ch := newTestChip8(t, Ctx{})
+	ch.display = &displayMock{}
+	// ADD V0, 1; EXIT
+	copy(ch.ram.Memory[0x200:], []byte{0x70, 0x01, 0x00, 0xFD})
+
+	require.NoError(t, ch.frame(10))
+	assert.True(t, ch.exited)
+	assert.Equal(t, byte(1), ch.v[0])
+}
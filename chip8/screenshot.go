@@ -0,0 +1,52 @@
+package chip8
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+)
+
+// screenshotPath returns the path of the screenshot taken at the current
+// cycle. Screenshots are stored next to the rom.
+func (c *chip8) screenshotPath() string {
+	return fmt.Sprintf("%s.%d.png", c.path, c.cycles)
+}
+
+// screenshot writes the framebuffer to a PNG file. It returns the path of the
+// file.
+func (c *chip8) screenshot() (string, error) {
+	path := c.screenshotPath()
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := display.WritePNG(f, c.fb.frame(), c.palette, c.imageScale); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// startGIF starts recording frames when the GIF path is set.
+func (c *chip8) startGIF() {
+	if c.gifPath != "" {
+		c.gif = display.NewGIF(c.palette, c.imageScale)
+	}
+}
+
+// saveGIF writes recorded frames to the GIF file.
+func (c *chip8) saveGIF() error {
+	if c.gif == nil {
+		return nil
+	}
+	f, err := os.Create(c.gifPath)
+	if err != nil {
+		return err
+	}
+	if err := c.gif.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,68 @@
+package chip8
+
+import (
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenshotAtCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom, err := ioutil.ReadFile(binaryPath)
+	require.NoError(t, err)
+	romPath := filepath.Join(dir, "game.ch8")
+	require.NoError(t, ioutil.WriteFile(romPath, rom, 0644))
+
+	c := newTestChip8(t, Ctx{path: romPath, imageScale: 2, screenshotCycle: 15})
+	require.NoError(t, c.start())
+	// LD I, 0 (font of 0); DRW V0, V0, 5; JP 204. The sprite is drawn on the
+	// second frame.
+	copy(c.ram.Memory[programStartPos:], []byte{0xA0, 0x00, 0xD0, 0x05, 0x12, 0x04})
+	require.NoError(t, c.Step(20))
+
+	f, err := os.Open(romPath + ".15.png")
+	require.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	require.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+	assert.Equal(t, 64, img.Bounds().Dy())
+	// The top row of 0 is ..XX and set pixels are black.
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r)
+	r, _, _, _ = img.At(4, 1).RGBA()
+	assert.Equal(t, uint32(0), r)
+}
+
+func TestSaveGIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	gifPath := filepath.Join(dir, "game.gif")
+
+	c := newTestChip8(t, Ctx{path: binaryPath, cyclesPerSecond: 60, gif: gifPath})
+	require.NoError(t, c.start())
+	// LD I, 0; DRW V0, V0, 5; JP 200 executes an instruction per frame, so
+	// the sprite is flipped every third frame.
+	copy(c.ram.Memory[programStartPos:], []byte{0xA0, 0x00, 0xD0, 0x05, 0x12, 0x00})
+	require.NoError(t, c.Step(6))
+	require.NoError(t, c.saveGIF())
+
+	f, err := os.Open(gifPath)
+	require.NoError(t, err)
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	require.NoError(t, err)
+	// Frames of 1, 3 and 2 ticks take 1/10 of a second in total. The first
+	// frame is too short and coalesced with the second one.
+	assert.Len(t, anim.Image, 2)
+	assert.Equal(t, []int{6, 4}, anim.Delay)
+}
@@ -0,0 +1,250 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Snapshot file starts with a header followed by the machine state and CRC-32
+// checksum of everything before it:
+//
+//	magic    [4]byte "CH8S"
+//	version  uint16
+//	romHash  [32]byte SHA-256 of the ROM
+//	size     uint32 size of the state
+//	state    [size]byte
+//	checksum uint32
+//
+// Numbers are big endian.
+const (
+	snapshotMagic   = "CH8S"
+	snapshotVersion = 2
+)
+
+// Errors returned when a snapshot can not be loaded.
+var (
+	// ErrInvalidSnapshot is returned when a snapshot is corrupted or has an
+	// unsupported version.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	// ErrSnapshotROM is returned when a snapshot is saved with another ROM.
+	ErrSnapshotROM = errors.New("snapshot is saved with a different rom")
+)
+
+type snapshotHeader struct {
+	Magic   [4]byte
+	Version uint16
+	ROMHash [32]byte
+	Size    uint32
+}
+
+// machineState holds fixed size part of the machine state. Memory and the
+// framebuffer pixels follow it.
+type machineState struct {
+	PC         uint16
+	I          uint32
+	DelayTimer byte
+	SoundTimer byte
+	Hires      bool
+	Exited     bool
+	VBlank     bool
+	Plane      byte
+	Pitch      byte
+	V          [registersCount]byte
+	Flags      [registersCount]byte
+	Pattern    [patternSize]byte
+	StackSize  byte
+	Stack      [stackSize]uint16
+
+	ShiftVX        bool
+	LoadStore      byte
+	JumpVX         bool
+	VFReset        bool
+	Wrap           bool
+	DisplayWait    bool
+	ExtendedMemory bool
+
+	MemorySize uint32
+	Width      uint16
+	Height     uint16
+	RNG        uint64
+}
+
+// encodeState returns the state of the machine.
+func (c *chip8) encodeState() []byte {
+	s := machineState{
+		PC:             c.pc,
+		I:              uint32(c.i),
+		DelayTimer:     c.delayTimer,
+		SoundTimer:     c.soundTimer,
+		Hires:          c.hires,
+		Exited:         c.exited,
+		VBlank:         c.vblank,
+		Plane:          c.plane,
+		Pitch:          c.pitch,
+		Flags:          c.flags,
+		Pattern:        c.pattern,
+		StackSize:      byte(len(c.stack)),
+		ShiftVX:        c.quirks.ShiftVX,
+		LoadStore:      byte(c.quirks.LoadStore),
+		JumpVX:         c.quirks.JumpVX,
+		VFReset:        c.quirks.VFReset,
+		Wrap:           c.quirks.Wrap,
+		DisplayWait:    c.quirks.DisplayWait,
+		ExtendedMemory: c.quirks.ExtendedMemory,
+		MemorySize:     uint32(len(c.ram.Memory)),
+		Width:          uint16(c.fb.width),
+		Height:         uint16(c.fb.height),
+		RNG:            c.rng.state,
+	}
+	copy(s.V[:], c.v)
+	copy(s.Stack[:], c.stack)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, &s)
+	b.Write(c.ram.Memory)
+	b.Write(c.fb.pixels)
+	return b.Bytes()
+}
+
+// decodeState restores the state of the machine returned by encodeState.
+func (c *chip8) decodeState(state []byte) error {
+	var s machineState
+	r := bytes.NewReader(state)
+	if err := binary.Read(r, binary.BigEndian, &s); err != nil {
+		return ErrInvalidSnapshot
+	}
+	pixels := int(s.Width) * int(s.Height)
+	if int(s.StackSize) > stackSize || r.Len() != int(s.MemorySize)+pixels {
+		return ErrInvalidSnapshot
+	}
+
+	c.pc = s.PC
+	c.i = int(s.I)
+	c.delayTimer = s.DelayTimer
+	c.soundTimer = s.SoundTimer
+	c.hires = s.Hires
+	c.exited = s.Exited
+	c.vblank = s.VBlank
+	c.plane = s.Plane
+	c.pitch = s.Pitch
+	copy(c.v, s.V[:])
+	c.flags = s.Flags
+	c.pattern = s.Pattern
+	c.stack = append(c.stack[:0], s.Stack[:s.StackSize]...)
+	c.rng.state = s.RNG
+	c.quirks = Quirks{
+		ShiftVX:        s.ShiftVX,
+		LoadStore:      MemoryIncrement(s.LoadStore),
+		JumpVX:         s.JumpVX,
+		VFReset:        s.VFReset,
+		Wrap:           s.Wrap,
+		DisplayWait:    s.DisplayWait,
+		ExtendedMemory: s.ExtendedMemory,
+	}
+
+	if len(c.ram.Memory) != int(s.MemorySize) {
+		c.ram.Memory = make([]byte, s.MemorySize)
+	}
+	r.Read(c.ram.Memory)
+	if c.fb.width != int(s.Width) || c.fb.height != int(s.Height) {
+		c.fb.setResolution(int(s.Width), int(s.Height))
+	}
+	r.Read(c.fb.pixels)
+	c.fb.dirty = true
+
+	c.audio.SetPattern(c.pattern[:], c.pitch)
+	return nil
+}
+
+// saveState writes snapshot of the machine to w.
+func (c *chip8) saveState(w io.Writer) error {
+	state := c.encodeState()
+	h := snapshotHeader{
+		Version: snapshotVersion,
+		ROMHash: c.ram.romHash,
+		Size:    uint32(len(state)),
+	}
+	copy(h.Magic[:], snapshotMagic)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, &h)
+	b.Write(state)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(b.Bytes()))
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// loadState restores the machine from snapshot read from r.
+func (c *chip8) loadState(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(b) < 4 {
+		return ErrInvalidSnapshot
+	}
+	data, sum := b[:len(b)-4], binary.BigEndian.Uint32(b[len(b)-4:])
+	if crc32.ChecksumIEEE(data) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	var h snapshotHeader
+	hr := bytes.NewReader(data)
+	if err := binary.Read(hr, binary.BigEndian, &h); err != nil {
+		return ErrInvalidSnapshot
+	}
+	if string(h.Magic[:]) != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+	if h.Version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, h.Version)
+	}
+	if h.ROMHash != c.ram.romHash {
+		return ErrSnapshotROM
+	}
+	if int(h.Size) != hr.Len() {
+		return ErrInvalidSnapshot
+	}
+	return c.decodeState(data[len(data)-hr.Len():])
+}
+
+// saveSlots is the number of save state slots.
+const saveSlots = 10
+
+// slotPath returns path of the snapshot file of the selected slot. Snapshots
+// are stored next to the rom.
+func (c *chip8) slotPath() string {
+	return fmt.Sprintf("%s.state%d", c.path, c.slot)
+}
+
+// saveStateFile saves snapshot of the machine to the file at path.
+func (c *chip8) saveStateFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saving state: %v", err)
+	}
+	if err := c.saveState(f); err != nil {
+		f.Close()
+		return fmt.Errorf("saving state: %v", err)
+	}
+	return f.Close()
+}
+
+// loadStateFile restores the machine from the snapshot file at path.
+func (c *chip8) loadStateFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("loading state: %v", err)
+	}
+	defer f.Close()
+	if err := c.loadState(f); err != nil {
+		return fmt.Errorf("loading state %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/display"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// controllerMock is a display which returns queued commands.
+type controllerMock struct {
+	displayMock
+	commands []display.Command
+	lines    []string
+}
+
+func (d *controllerMock) PollCommand() display.Command {
+	if len(d.commands) == 0 {
+		return display.CommandNone
+	}
+	cmd := d.commands[0]
+	d.commands = d.commands[1:]
+	return cmd
+}
+
+func (d *controllerMock) Debug(line string) {
+	d.lines = append(d.lines, line)
+}
+
+func newSnapshotChip8(t *testing.T, path string) *chip8 {
+	ch := newTestChip8(t, Ctx{path: path, quirks: "xochip"})
+	require.NoError(t, ch.start())
+	return ch
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ch := newSnapshotChip8(t, "testdata/draw.ch8")
+	require.NoError(t, ch.Step(4))
+	ch.v[3] = 0x33
+	ch.i = 0x1234
+	ch.stack = append(ch.stack, 0x202, 0x20A)
+	ch.delayTimer = 7
+	ch.soundTimer = 9
+	ch.flags[2] = 0x22
+	ch.pattern[1] = 0xF0
+	ch.pitch = 0x70
+	ch.plane = 0x3
+	ch.ram.Memory[0xFFFF] = 0xAB
+	ch.setHighRes(true)
+	ch.fb.pixels[10] = 0x2
+
+	var b bytes.Buffer
+	require.NoError(t, ch.saveState(&b))
+
+	restored := newSnapshotChip8(t, "testdata/draw.ch8")
+	restored.quirks = Quirks{}
+	require.NoError(t, restored.loadState(bytes.NewReader(b.Bytes())))
+
+	assert.Equal(t, ch.pc, restored.pc)
+	assert.Equal(t, ch.v, restored.v)
+	assert.Equal(t, ch.i, restored.i)
+	assert.Equal(t, ch.stack, restored.stack)
+	assert.Equal(t, ch.delayTimer, restored.delayTimer)
+	assert.Equal(t, ch.soundTimer, restored.soundTimer)
+	assert.Equal(t, ch.flags, restored.flags)
+	assert.Equal(t, ch.pattern, restored.pattern)
+	assert.Equal(t, ch.pitch, restored.pitch)
+	assert.Equal(t, ch.plane, restored.plane)
+	assert.Equal(t, ch.hires, restored.hires)
+	assert.Equal(t, ch.quirks, restored.quirks)
+	assert.Equal(t, ch.ram.Memory, restored.ram.Memory)
+	assert.Equal(t, ch.fb.frame(), restored.fb.frame())
+	assert.True(t, restored.fb.dirty)
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	ch := newSnapshotChip8(t, "testdata/draw.ch8")
+	var b bytes.Buffer
+	require.NoError(t, ch.saveState(&b))
+	snapshot := b.Bytes()
+
+	// withChecksum returns data with a valid checksum.
+	withChecksum := func(data []byte) []byte {
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(data))
+		return append(data, sum...)
+	}
+
+	testCases := map[string]struct {
+		snapshot []byte
+		want     error
+	}{
+		"corrupted": {
+			snapshot: append([]byte{snapshot[0] ^ 0xFF}, snapshot[1:]...),
+			want:     ErrInvalidSnapshot,
+		},
+		"too_short": {
+			snapshot: []byte{0x1},
+			want:     ErrInvalidSnapshot,
+		},
+		"unknown_version": {
+			snapshot: func() []byte {
+				data := append([]byte(nil), snapshot[:len(snapshot)-4]...)
+				data[5] = snapshotVersion + 1
+				return withChecksum(data)
+			}(),
+			want: ErrInvalidSnapshot,
+		},
+		"different_rom": {
+			snapshot: func() []byte {
+				data := append([]byte(nil), snapshot[:len(snapshot)-4]...)
+				data[6] ^= 0xFF
+				return withChecksum(data)
+			}(),
+			want: ErrSnapshotROM,
+		},
+		"truncated_state": {
+			snapshot: withChecksum(append([]byte(nil), snapshot[:len(snapshot)-8]...)),
+			want:     ErrInvalidSnapshot,
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ch := newSnapshotChip8(t, "testdata/draw.ch8")
+			err := ch.loadState(bytes.NewReader(test.snapshot))
+			assert.True(t, errors.Is(err, test.want), "got %v", err)
+		})
+	}
+}
+
+func TestSnapshotSlots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "draw.ch8")
+	b, err := ioutil.ReadFile("testdata/draw.ch8")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(rom, b, 0644))
+
+	ch := newSnapshotChip8(t, rom)
+	d := &controllerMock{}
+	ch.display = d
+	ch.v[1] = 0x11
+	d.commands = []display.Command{display.CommandNextSlot, display.CommandSaveState}
+	ch.commands()
+	assert.Equal(t, []string{"Slot 1", "Saved slot 1"}, d.lines)
+	assert.FileExists(t, rom+".state1")
+
+	ch.v[1] = 0x22
+	d.commands = []display.Command{display.CommandPrevSlot, display.CommandLoadState}
+	ch.commands()
+	assert.Equal(t, byte(0x22), ch.v[1])
+	assert.Contains(t, d.lines[3], "loading state")
+
+	d.commands = []display.Command{display.CommandNextSlot, display.CommandLoadState}
+	ch.commands()
+	assert.Equal(t, byte(0x11), ch.v[1])
+
+	// The state is loaded at start with -load-state flag.
+	loaded := newTestChip8(t, Ctx{path: rom, loadState: rom + ".state1"})
+	require.NoError(t, loaded.Step(0))
+	assert.Equal(t, byte(0x11), loaded.v[1])
+
+	otherROM := filepath.Join(dir, "other.ch8")
+	require.NoError(t, ioutil.WriteFile(otherROM, []byte{0x12, 0x00}, 0644))
+	other := newTestChip8(t, Ctx{path: otherROM, loadState: rom + ".state1"})
+	err = other.Step(1)
+	assert.True(t, errors.Is(err, ErrSnapshotROM))
+}
@@ -0,0 +1,60 @@
+package chip8
+
+import (
+	"fmt"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// loadSymbols loads the symbol file. Symbols of compiled sources are used
+// when no file is given.
+func (c *chip8) loadSymbols() error {
+	if c.symbolsPath == "" {
+		c.syms = c.ram.symbols
+		return nil
+	}
+	t, err := symbols.Load(c.symbolsPath)
+	if err != nil {
+		return fmt.Errorf("failed to load symbols: %w", err)
+	}
+	c.syms = t
+	return nil
+}
+
+// disassemble disassembles the loaded rom. Labels of the symbol table replace
+// generated ones and instructions are commented with their source lines.
+func (c *chip8) disassemble() *disasm.Program {
+	rom := c.ram.Memory[programStartPos : programStartPos+c.ram.size]
+	p := disasm.Disassemble(rom, programStartPos)
+	p.Annotate(c.syms)
+	return p
+}
+
+// line returns the instruction at addr for the execution trace. Targets are
+// named after labels and the source line is appended.
+func (c *chip8) line(addr int) string {
+	if c.syms == nil {
+		return disasm.Line(c.ram.Memory, addr)
+	}
+	i := disasm.Decode(c.ram.Memory, addr)
+	s := fmt.Sprintf("%04X\t%04X\t%s", addr, i.Opcode, i.Format(c.syms.Label))
+	if l, ok := c.syms.Line(addr); ok {
+		s += "\t; " + l.String()
+	}
+	return s
+}
+
+// location describes addr with the nearest label and the source line, e.g.
+// "draw+4 (game.8o:12: sprite v0 v1 5)".
+func (c *chip8) location(addr int) string {
+	name := c.syms.Describe(addr)
+	l, ok := c.syms.Line(addr)
+	switch {
+	case ok && name != "":
+		return fmt.Sprintf("%s (%s)", name, l)
+	case ok:
+		return l.String()
+	}
+	return name
+}
@@ -0,0 +1,52 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbolsOfOctoSource(t *testing.T) {
+	c := newTestChip8(t, Ctx{path: "testdata/draw.8o"})
+	require.NoError(t, c.start())
+
+	assert.Equal(t, "0204\tD005\tDRW V0, V0, 5\t; testdata/draw.8o:5: sprite v0 v0 5", c.line(0x204))
+	assert.Equal(t, "0206\t1206\tJP #206\t; testdata/draw.8o:6: loop again", c.line(0x206))
+
+	var b bytes.Buffer
+	_, err := c.disassemble().WriteTo(&b)
+	require.NoError(t, err)
+	assert.Contains(t, b.String(), "main:\n\tLD V0, #00\t; testdata/draw.8o:3: v0 := 0\n")
+}
+
+func TestSymbolsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "binary.sym")
+	sym := "0200 label start\n0202 source hello.asm:7 DB #6C\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(sym), 0644))
+
+	c := newTestChip8(t, Ctx{path: binaryPath, symbols: path})
+	require.NoError(t, c.start())
+	c.display = &displayMock{}
+	c.ram.Memory[0x202] = 0x00
+	c.ram.Memory[0x203] = 0xEE
+
+	err = c.exec(0x202)
+	var cpuErr *CPUError
+	require.True(t, errors.As(err, &cpuErr))
+	assert.Equal(t, "start+2 (hello.asm:7: DB #6C)", cpuErr.Location)
+	assert.Contains(t, cpuErr.Report(), "At: start+2 (hello.asm:7: DB #6C)\n")
+}
+
+func TestSymbolsFileNotFound(t *testing.T) {
+	c := newTestChip8(t, Ctx{path: binaryPath, symbols: "testdata/missing.sym"})
+	assert.Error(t, c.start())
+}
@@ -0,0 +1,117 @@
+package symbols
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadListing reads an assembler listing. Lines start with an optional
+// decimal line number followed by the hexadecimal address and the emitted
+// bytes, the rest of the line is the source:
+//
+//	12  0204  A210    draw: LD I, sprite
+//
+// Labels are lines of the source which start with "name:". Source lines are
+// named after the listing file.
+func ReadListing(r io.Reader, name string) (*Table, error) {
+	t := New()
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		lineNumber := n
+		if hasLineNumber(fields) {
+			lineNumber, _ = strconv.Atoi(fields[0])
+			fields = fields[1:]
+		}
+		if !isAddress(fields[0]) {
+			continue
+		}
+		addr, _ := strconv.ParseUint(strings.TrimSuffix(fields[0], ":"), 16, 16)
+
+		// Skip emitted bytes.
+		k := 1
+		emitted := false
+		for k < len(fields) && isBytes(fields[k]) {
+			k++
+			emitted = true
+		}
+		source := sourceText(line, fields, k)
+		if source == "" {
+			continue
+		}
+		if label := leadingLabel(source); label != "" {
+			t.AddLabel(int(addr), label)
+		}
+		if emitted {
+			t.AddLine(int(addr), Line{File: name, Line: lineNumber, Text: source})
+		}
+	}
+	return t, s.Err()
+}
+
+// hasLineNumber returns true if the line starts with a line number. Addresses
+// and emitted words may be made of decimal digits too, so a number which is a
+// valid address is a line number only when it is followed by an address and
+// emitted bytes.
+func hasLineNumber(fields []string) bool {
+	if _, err := strconv.Atoi(fields[0]); err != nil || !isAddress(fields[1]) {
+		return false
+	}
+	return !isAddress(fields[0]) || len(fields) > 2 && isBytes(fields[2])
+}
+
+// isAddress returns true for 3 or 4 hexadecimal digits with optional colon.
+func isAddress(s string) bool {
+	s = strings.TrimSuffix(s, ":")
+	if len(s) != 3 && len(s) != 4 {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 16, 16)
+	return err == nil
+}
+
+// isBytes returns true for 2 or 4 hexadecimal digits. Words without decimal
+// digits, e.g. DB or ADD, are mnemonics.
+func isBytes(s string) bool {
+	if len(s) != 2 && len(s) != 4 || !strings.ContainsAny(s, "0123456789") {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 16, 16)
+	return err == nil
+}
+
+// sourceText returns the line starting at the field k without the comment.
+func sourceText(line string, fields []string, k int) string {
+	if k >= len(fields) {
+		return ""
+	}
+	// Find the field in the line after the preceding ones.
+	pos := 0
+	for _, f := range fields[:k] {
+		pos = strings.Index(line[pos:], f) + pos + len(f)
+	}
+	text := line[pos:]
+	if c := strings.IndexByte(text, ';'); c >= 0 {
+		text = text[:c]
+	}
+	return strings.TrimSpace(text)
+}
+
+// leadingLabel returns the label defined at the start of the source.
+func leadingLabel(source string) string {
+	k := strings.IndexByte(source, ':')
+	if k <= 0 {
+		return ""
+	}
+	name := source[:k]
+	if strings.ContainsAny(name, " \t,#") {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,260 @@
+// Package symbols maps addresses of a program to labels and source lines.
+//
+// Symbol files are text files with one entry per line. Addresses are
+// hexadecimal:
+//
+//	# comment
+//	0200 label main
+//	0200 source game.asm:12 LD V0, 5
+//
+// Symbol tables of other assemblers are accepted too, lines may hold
+// "0200 main", "main = $200" or "main EQU 0x200".
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Line is a line of the source.
+type Line struct {
+	File string
+	Line int
+	Text string
+}
+
+func (l Line) String() string {
+	return fmt.Sprintf("%s:%d: %s", l.File, l.Line, l.Text)
+}
+
+// Table holds labels and source lines of a program. Methods of a nil table
+// return nothing, so it can be used when no symbols are loaded.
+type Table struct {
+	names map[int][]string
+	addrs map[string]int
+	lines map[int]Line
+	// sorted holds addresses of labels in ascending order. It is built on
+	// demand.
+	sorted []int
+}
+
+// New creates an empty table.
+func New() *Table {
+	return &Table{
+		names: make(map[int][]string),
+		addrs: make(map[string]int),
+		lines: make(map[int]Line),
+	}
+}
+
+// FromMaps creates a table with labels by their names and source lines by
+// addresses. Names are added in alphabetical order, so the first name of an
+// address does not depend on the order of the map.
+func FromMaps(labels map[string]int, lines map[int]Line) *Table {
+	t := New()
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.AddLabel(labels[name], name)
+	}
+	for addr, l := range lines {
+		t.AddLine(addr, l)
+	}
+	return t
+}
+
+// AddLabel names the address. An address can have many names.
+func (t *Table) AddLabel(addr int, name string) {
+	if _, ok := t.addrs[name]; ok {
+		return
+	}
+	t.addrs[name] = addr
+	t.names[addr] = append(t.names[addr], name)
+	t.sorted = nil
+}
+
+// AddLine sets the source line of the instruction at addr.
+func (t *Table) AddLine(addr int, l Line) {
+	t.lines[addr] = l
+}
+
+// Label returns the first name of the address or an empty string.
+func (t *Table) Label(addr int) string {
+	if t == nil || len(t.names[addr]) == 0 {
+		return ""
+	}
+	return t.names[addr][0]
+}
+
+// Lookup returns the address of the label.
+func (t *Table) Lookup(name string) (int, bool) {
+	if t == nil {
+		return 0, false
+	}
+	addr, ok := t.addrs[name]
+	return addr, ok
+}
+
+// Line returns the source line of the instruction at addr.
+func (t *Table) Line(addr int) (Line, bool) {
+	if t == nil {
+		return Line{}, false
+	}
+	l, ok := t.lines[addr]
+	return l, ok
+}
+
+// Labels returns addresses of labels in ascending order.
+func (t *Table) Labels() []int {
+	if t == nil {
+		return nil
+	}
+	if t.sorted == nil {
+		t.sorted = make([]int, 0, len(t.names))
+		for addr := range t.names {
+			t.sorted = append(t.sorted, addr)
+		}
+		sort.Ints(t.sorted)
+	}
+	return t.sorted
+}
+
+// Describe returns the nearest label at or before addr with the offset from
+// it, e.g. "draw+4". It returns an empty string if there is no such label.
+func (t *Table) Describe(addr int) string {
+	labels := t.Labels()
+	k := sort.SearchInts(labels, addr+1) - 1
+	if k < 0 {
+		return ""
+	}
+	name := t.Label(labels[k])
+	if labels[k] == addr {
+		return name
+	}
+	return fmt.Sprintf("%s+%d", name, addr-labels[k])
+}
+
+// Write writes the table in the symbol file format.
+func (t *Table) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	lines := make([]int, 0, len(t.lines))
+	for addr := range t.lines {
+		lines = append(lines, addr)
+	}
+	sort.Ints(lines)
+	labels := t.Labels()
+	for len(labels) > 0 || len(lines) > 0 {
+		if len(labels) > 0 && (len(lines) == 0 || labels[0] <= lines[0]) {
+			for _, name := range t.names[labels[0]] {
+				fmt.Fprintf(b, "%04X label %s\n", labels[0], name)
+			}
+			labels = labels[1:]
+			continue
+		}
+		l := t.lines[lines[0]]
+		fmt.Fprintf(b, "%04X source %s:%d %s\n", lines[0], l.File, l.Line, l.Text)
+		lines = lines[1:]
+	}
+	return b.Flush()
+}
+
+// Load reads the symbol file at path. Files with .lst extension are read as
+// assembler listings.
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".lst") {
+		return ReadListing(f, filepath.Base(path))
+	}
+	return Read(f)
+}
+
+// Read reads the symbol file.
+func Read(r io.Reader) (*Table, error) {
+	t := New()
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if err := t.parse(line); err != nil {
+			return nil, fmt.Errorf("symbols line %d: %v", n, err)
+		}
+	}
+	return t, s.Err()
+}
+
+func (t *Table) parse(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) >= 3 && (fields[1] == "=" || strings.EqualFold(fields[1], "EQU")) {
+		addr, err := parseValue(fields[2])
+		if err != nil {
+			return err
+		}
+		t.AddLabel(addr, fields[0])
+		return nil
+	}
+
+	addr, err := strconv.ParseUint(fields[0], 16, 16)
+	if err != nil || len(fields) < 2 {
+		return fmt.Errorf("invalid entry %q", line)
+	}
+	switch {
+	case len(fields) == 2:
+		t.AddLabel(int(addr), fields[1])
+	case fields[1] == "label" && len(fields) == 3:
+		t.AddLabel(int(addr), fields[2])
+	case fields[1] == "source":
+		// The text keeps its spacing.
+		rest := strings.TrimSpace(line[strings.Index(line, "source")+len("source"):])
+		pos := strings.Fields(rest)[0]
+		k := strings.LastIndexByte(pos, ':')
+		if k < 0 {
+			return fmt.Errorf("invalid source position %q", pos)
+		}
+		n, err := strconv.Atoi(pos[k+1:])
+		if err != nil {
+			return fmt.Errorf("invalid source position %q", pos)
+		}
+		text := strings.TrimSpace(rest[len(pos):])
+		t.AddLine(int(addr), Line{File: pos[:k], Line: n, Text: text})
+	default:
+		return fmt.Errorf("invalid entry %q", line)
+	}
+	return nil
+}
+
+// parseValue parses addresses of symbol tables: decimal, hexadecimal with $,
+// # or 0x prefix or h suffix.
+func parseValue(s string) (int, error) {
+	lower := strings.ToLower(s)
+	var v uint64
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "$") || strings.HasPrefix(lower, "#"):
+		v, err = strconv.ParseUint(lower[1:], 16, 16)
+	case strings.HasPrefix(lower, "0x"):
+		v, err = strconv.ParseUint(lower[2:], 16, 16)
+	case strings.HasSuffix(lower, "h"):
+		v, err = strconv.ParseUint(lower[:len(lower)-1], 16, 16)
+	default:
+		v, err = strconv.ParseUint(lower, 10, 16)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return int(v), nil
+}
@@ -0,0 +1,144 @@
+package symbols
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	testCases := map[string]struct {
+		src       string
+		wantAddr  int
+		wantLabel string
+		wantErr   string
+	}{
+		"label":        {src: "0204 label draw", wantAddr: 0x204, wantLabel: "draw"},
+		"address_name": {src: "0204 draw", wantAddr: 0x204, wantLabel: "draw"},
+		"equals":       {src: "draw = $204", wantAddr: 0x204, wantLabel: "draw"},
+		"equ_hex":      {src: "draw EQU 0x204", wantAddr: 0x204, wantLabel: "draw"},
+		"equ_suffix":   {src: "draw equ 204h", wantAddr: 0x204, wantLabel: "draw"},
+		"equ_decimal":  {src: "draw EQU 516", wantAddr: 0x204, wantLabel: "draw"},
+		"comment":      {src: "# 0204 draw\n; 0206 loop\n0204 draw", wantAddr: 0x204, wantLabel: "draw"},
+		"invalid":      {src: "draw", wantErr: `symbols line 1: invalid entry "draw"`},
+		"bad_address":  {src: "draw = $FFFFF", wantErr: `symbols line 1: invalid address "$FFFFF"`},
+		"bad_position": {src: "0200 source game.asm LD V0, 5", wantErr: `symbols line 1: invalid source position "game.asm"`},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			table, err := Read(strings.NewReader(test.src))
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantLabel, table.Label(test.wantAddr))
+			addr, ok := table.Lookup(test.wantLabel)
+			assert.True(t, ok)
+			assert.Equal(t, test.wantAddr, addr)
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	table := New()
+	table.AddLabel(0x200, "main")
+	table.AddLabel(0x200, "start")
+	table.AddLabel(0x208, "draw")
+	table.AddLine(0x200, Line{File: "game.asm", Line: 3, Text: "LD V0,  5"})
+	table.AddLine(0x204, Line{File: "game.asm", Line: 4, Text: "LD I, sprite"})
+
+	var b bytes.Buffer
+	require.NoError(t, table.Write(&b))
+	want := `0200 label main
+0200 label start
+0200 source game.asm:3 LD V0,  5
+0204 source game.asm:4 LD I, sprite
+0208 label draw
+`
+	assert.Equal(t, want, b.String())
+
+	read, err := Read(&b)
+	require.NoError(t, err)
+	assert.Equal(t, table.names, read.names)
+	assert.Equal(t, table.lines, read.lines)
+}
+
+func TestFromMaps(t *testing.T) {
+	labels := map[string]int{"start": 0x200, "main": 0x200, "draw": 0x208}
+	lines := map[int]Line{0x200: {File: "game.asm", Line: 3, Text: "LD V0, 5"}}
+	table := FromMaps(labels, lines)
+
+	assert.Equal(t, "main", table.Label(0x200))
+	assert.Equal(t, []int{0x200, 0x208}, table.Labels())
+	addr, ok := table.Lookup("start")
+	require.True(t, ok)
+	assert.Equal(t, 0x200, addr)
+	l, ok := table.Line(0x200)
+	require.True(t, ok)
+	assert.Equal(t, lines[0x200], l)
+}
+
+func TestDescribe(t *testing.T) {
+	table := New()
+	table.AddLabel(0x200, "main")
+	table.AddLabel(0x210, "draw")
+
+	assert.Equal(t, "", table.Describe(0x1FE))
+	assert.Equal(t, "main", table.Describe(0x200))
+	assert.Equal(t, "main+14", table.Describe(0x20E))
+	assert.Equal(t, "draw+2", table.Describe(0x212))
+
+	var empty *Table
+	assert.Equal(t, "", empty.Describe(0x200))
+	_, ok := empty.Line(0x200)
+	assert.False(t, ok)
+}
+
+func TestReadListing(t *testing.T) {
+	src := `; game listing
+    1                    ; Draws a sprite.
+    2  0200              main:
+    3  0200  6005            LD V0, 5      ; x
+    4  0202  A208            LD I, sprite
+    5  0204  D015            DRW V0, V1, 5
+    6  0206  1206    loop:   JP loop
+    7  0208  F0 90 F0 sprite: DB #F0, #90, #F0
+`
+	table, err := ReadListing(strings.NewReader(src), "game.lst")
+	require.NoError(t, err)
+
+	assert.Equal(t, "main", table.Label(0x200))
+	assert.Equal(t, "loop", table.Label(0x206))
+	assert.Equal(t, "sprite", table.Label(0x208))
+	l, ok := table.Line(0x200)
+	require.True(t, ok)
+	assert.Equal(t, Line{File: "game.lst", Line: 3, Text: "LD V0, 5"}, l)
+	l, ok = table.Line(0x206)
+	require.True(t, ok)
+	assert.Equal(t, "game.lst:6: loop:   JP loop", l.String())
+	_, ok = table.Line(0x20A)
+	assert.False(t, ok)
+}
+
+func TestReadListingWithoutLineNumbers(t *testing.T) {
+	src := `0200 00E0 main: CLS
+0202 6005 LD V0, 5
+0204 1202 loop: JP 0x202
+`
+	table, err := ReadListing(strings.NewReader(src), "game.lst")
+	require.NoError(t, err)
+
+	assert.Equal(t, "main", table.Label(0x200))
+	assert.Equal(t, "loop", table.Label(0x204))
+	assert.Equal(t, "", table.Label(0x1202))
+	l, ok := table.Line(0x202)
+	require.True(t, ok)
+	assert.Equal(t, Line{File: "game.lst", Line: 2, Text: "LD V0, 5"}, l)
+	l, ok = table.Line(0x204)
+	require.True(t, ok)
+	assert.Equal(t, "game.lst:3: loop: JP 0x202", l.String())
+}
@@ -0,0 +1,105 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+	"github.com/Pawka/chip8-emulator/chip8/trace"
+)
+
+// tracer writes executed instructions with changed registers to the trace.
+type tracer struct {
+	f      *os.File
+	w      *trace.Writer
+	filter trace.Filter
+	// record is the instruction being executed. It is written only if active
+	// is set.
+	record trace.Record
+	active bool
+	regs   [trace.Registers]int
+}
+
+// startTrace creates the trace file.
+func (c *chip8) startTrace() error {
+	if c.tracePath == "" {
+		return nil
+	}
+	f, err := os.Create(c.tracePath)
+	if err != nil {
+		return err
+	}
+	w, err := trace.NewWriter(f, c.traceFormat)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.tracer = &tracer{f: f, w: w, filter: c.traceFilter}
+	return nil
+}
+
+// closeTrace flushes and closes the trace file.
+func (c *chip8) closeTrace() error {
+	if c.tracer == nil {
+		return nil
+	}
+	err := c.tracer.w.Flush()
+	if cerr := c.tracer.f.Close(); err == nil {
+		err = cerr
+	}
+	c.tracer = nil
+	return err
+}
+
+// before decodes the instruction before it is executed, so self-modifying
+// code is traced as executed.
+func (t *tracer) before(c *chip8, pc uint16) {
+	t.active = false
+	if int(pc)+2 > len(c.ram.Memory) {
+		return
+	}
+	opcode := binary.BigEndian.Uint16(c.ram.Memory[pc:])
+	if !t.filter.Match(c.cycles+1, pc, opcode) {
+		return
+	}
+	i := disasm.Decode(c.ram.Memory, int(pc))
+	t.record = trace.Record{
+		Cycle:    c.cycles + 1,
+		PC:       pc,
+		Opcode:   opcode,
+		Mnemonic: i.Format(c.syms.Label),
+	}
+	if t.record.Long() && i.Size == 4 {
+		t.record.Extra = binary.BigEndian.Uint16(c.ram.Memory[pc+2:])
+	}
+	t.regs = traceRegisters(c)
+	t.active = true
+}
+
+// after writes the record with registers changed by the instruction.
+func (t *tracer) after(c *chip8) error {
+	regs := traceRegisters(c)
+	for k := range regs {
+		if regs[k] != t.regs[k] {
+			t.record.Changes = append(t.record.Changes, trace.Change{
+				Reg: trace.Register(k),
+				Old: t.regs[k],
+				New: regs[k],
+			})
+		}
+	}
+	return t.w.Write(t.record)
+}
+
+// traceRegisters returns values of registers indexed by trace.Register.
+func traceRegisters(c *chip8) [trace.Registers]int {
+	var regs [trace.Registers]int
+	for k, v := range c.v {
+		regs[k] = int(v)
+	}
+	regs[trace.I] = c.i
+	regs[trace.DT] = int(c.delayTimer)
+	regs[trace.ST] = int(c.soundTimer)
+	regs[trace.SP] = len(c.stack)
+	return regs
+}
@@ -0,0 +1,42 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+)
+
+// Diff compares records of both traces in order and writes the differing
+// ones to w, the record of a with "-" prefix and the record of b with "+"
+// prefix. It stops after max differences unless max is zero. It returns the
+// number of found differences.
+func Diff(a, b *Reader, w io.Writer, max int) (int, error) {
+	diffs := 0
+	for max == 0 || diffs < max {
+		ra, errA := a.Read()
+		if errA != nil && errA != io.EOF {
+			return diffs, errA
+		}
+		rb, errB := b.Read()
+		if errB != nil && errB != io.EOF {
+			return diffs, errB
+		}
+		if errA == io.EOF && errB == io.EOF {
+			break
+		}
+		if errA == nil && errB == nil && ra.Equal(rb) {
+			continue
+		}
+		diffs++
+		lineA, lineB := "end of trace", "end of trace"
+		if errA == nil {
+			lineA = ra.String()
+		}
+		if errB == nil {
+			lineB = rb.String()
+		}
+		if _, err := fmt.Fprintf(w, "- %s\n+ %s\n", lineA, lineB); err != nil {
+			return diffs, err
+		}
+	}
+	return diffs, nil
+}
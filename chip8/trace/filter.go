@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Range is an inclusive range of addresses or cycles. The zero range matches
+// everything.
+type Range struct {
+	From, To uint64
+}
+
+// Contains returns true if v is in the range.
+func (r Range) Contains(v uint64) bool {
+	if r == (Range{}) {
+		return true
+	}
+	return v >= r.From && v <= r.To
+}
+
+// ParseRange parses a range like 0x200-0x2FF, 1000- or a single value.
+// Either end of the range may be omitted. Hexadecimal values have 0x prefix.
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Range{}, nil
+	}
+	from, to := s, s
+	if k := strings.IndexByte(s, '-'); k >= 0 {
+		from, to = s[:k], s[k+1:]
+	}
+	r := Range{To: math.MaxUint64}
+	var err error
+	if from != "" {
+		if r.From, err = strconv.ParseUint(from, 0, 64); err != nil {
+			return Range{}, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if to != "" {
+		if r.To, err = strconv.ParseUint(to, 0, 64); err != nil {
+			return Range{}, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if r.From > r.To {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	return r, nil
+}
+
+// Filter selects records written to a trace.
+type Filter struct {
+	// Addrs is the range of addresses of instructions.
+	Addrs Range
+	// Cycles is the range of cycles.
+	Cycles Range
+	// Classes is a bit mask of opcode classes, bit N selects opcodes
+	// starting with hexadecimal digit N. Zero selects all classes.
+	Classes uint16
+}
+
+// Match returns true if the instruction executed at the cycle is traced.
+func (f Filter) Match(cycle uint64, pc, opcode uint16) bool {
+	if f.Classes != 0 && f.Classes&(1<<(opcode>>12)) == 0 {
+		return false
+	}
+	return f.Addrs.Contains(uint64(pc)) && f.Cycles.Contains(cycle)
+}
+
+// ParseClasses parses comma separated opcode classes, e.g. "8,D,F".
+func ParseClasses(s string) (uint16, error) {
+	var classes uint16
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(c, 16, 4)
+		if err != nil || len(c) != 1 {
+			return 0, fmt.Errorf("invalid opcode class %q", c)
+		}
+		classes |= 1 << n
+	}
+	return classes, nil
+}
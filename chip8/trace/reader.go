@@ -0,0 +1,184 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Pawka/chip8-emulator/chip8/disasm"
+)
+
+// Reader reads records of a trace in any format.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	// line is the number of the last read line of text formats.
+	line  int
+	cycle uint64
+}
+
+// NewReader creates a reader. The format is detected from the first bytes.
+func NewReader(r io.Reader) (*Reader, error) {
+	t := &Reader{r: bufio.NewReader(r), format: Text}
+	head, err := t.r.Peek(len(binaryMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(head, binaryMagic):
+		t.format = Binary
+		t.r.Discard(len(binaryMagic))
+	case bytes.HasPrefix(head, binaryMagic[:3]):
+		return nil, fmt.Errorf("unsupported binary trace version %d", head[3])
+	case len(head) > 0 && head[0] == '{':
+		t.format = JSON
+	}
+	return t, nil
+}
+
+// Format returns the format of the trace.
+func (t *Reader) Format() Format {
+	return t.format
+}
+
+// Read returns the next record. It returns io.EOF at the end of the trace.
+func (t *Reader) Read() (Record, error) {
+	if t.format == Binary {
+		return t.readBinary()
+	}
+	for {
+		line, err := t.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return Record{}, err
+		}
+		t.line++
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		var r Record
+		if t.format == JSON {
+			err = json.Unmarshal([]byte(line), &r)
+		} else {
+			r, err = parseRecord(line)
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("trace line %d: %v", t.line, err)
+		}
+		return r, nil
+	}
+}
+
+// parseRecord parses a record of the text format.
+func parseRecord(line string) (Record, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 5 {
+		return Record{}, errors.New("invalid record")
+	}
+	var r Record
+	var err error
+	if r.Cycle, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return Record{}, fmt.Errorf("invalid cycle %q", fields[0])
+	}
+	pc, err := strconv.ParseUint(fields[1], 16, 16)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid address %q", fields[1])
+	}
+	r.PC = uint16(pc)
+	code := fields[2]
+	if len(code) != 4 && len(code) != 8 {
+		return Record{}, fmt.Errorf("invalid opcode %q", code)
+	}
+	op, err := strconv.ParseUint(code, 16, 32)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid opcode %q", code)
+	}
+	if len(code) == 8 {
+		r.Opcode, r.Extra = uint16(op>>16), uint16(op)
+	} else {
+		r.Opcode = uint16(op)
+	}
+	r.Mnemonic = fields[3]
+	for _, f := range strings.Fields(fields[4]) {
+		c, err := parseChange(f)
+		if err != nil {
+			return Record{}, err
+		}
+		r.Changes = append(r.Changes, c)
+	}
+	return r, nil
+}
+
+// parseChange parses a change like V0=0->5.
+func parseChange(s string) (Change, error) {
+	eq := strings.IndexByte(s, '=')
+	arrow := strings.Index(s, "->")
+	if eq < 0 || arrow < eq {
+		return Change{}, fmt.Errorf("invalid change %q", s)
+	}
+	var c Change
+	if err := c.Reg.UnmarshalText([]byte(s[:eq])); err != nil {
+		return Change{}, err
+	}
+	old, err1 := strconv.ParseUint(s[eq+1:arrow], 16, 16)
+	v, err2 := strconv.ParseUint(s[arrow+2:], 16, 16)
+	if err1 != nil || err2 != nil {
+		return Change{}, fmt.Errorf("invalid change %q", s)
+	}
+	c.Old, c.New = int(old), int(v)
+	return c, nil
+}
+
+func (t *Reader) readBinary() (Record, error) {
+	head, err := t.r.ReadByte()
+	if err != nil {
+		return Record{}, err
+	}
+	delta, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return Record{}, unexpected(err)
+	}
+	n := 4 + 5*int(head&maxChanges)
+	if head&0x80 != 0 {
+		n += 2
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(t.r, b); err != nil {
+		return Record{}, unexpected(err)
+	}
+	t.cycle += delta
+	r := Record{
+		Cycle:  t.cycle,
+		PC:     binary.BigEndian.Uint16(b),
+		Opcode: binary.BigEndian.Uint16(b[2:]),
+	}
+	b = b[4:]
+	if head&0x80 != 0 {
+		r.Extra = binary.BigEndian.Uint16(b)
+		b = b[2:]
+	}
+	for ; len(b) > 0; b = b[5:] {
+		r.Changes = append(r.Changes, Change{
+			Reg: Register(b[0]),
+			Old: int(binary.BigEndian.Uint16(b[1:])),
+			New: int(binary.BigEndian.Uint16(b[3:])),
+		})
+	}
+	mem := []byte{byte(r.Opcode >> 8), byte(r.Opcode), byte(r.Extra >> 8), byte(r.Extra)}
+	r.Mnemonic = disasm.Decode(mem, 0).String()
+	return r, nil
+}
+
+// unexpected reports the end of the trace in the middle of a record.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
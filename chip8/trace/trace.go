@@ -0,0 +1,233 @@
+// Package trace writes and reads logs of executed instructions.
+//
+// Each record holds the cycle, the address and the opcode of the instruction
+// and the registers it changed. Traces are written as text, JSON lines or
+// compact binary and read back in any of those formats.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Register identifies a register in register changes.
+type Register uint8
+
+// Registers V0 to VF are numbered by their index, others follow them.
+const (
+	I Register = iota + 16
+	DT
+	ST
+	SP
+
+	// Registers is the number of registers.
+	Registers = int(SP) + 1
+)
+
+var registerNames = [Registers]string{
+	"V0", "V1", "V2", "V3", "V4", "V5", "V6", "V7",
+	"V8", "V9", "VA", "VB", "VC", "VD", "VE", "VF",
+	"I", "DT", "ST", "SP",
+}
+
+func (r Register) String() string {
+	if int(r) < Registers {
+		return registerNames[r]
+	}
+	return fmt.Sprintf("R%d", r)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r Register) MarshalText() ([]byte, error) {
+	if int(r) >= Registers {
+		return nil, fmt.Errorf("unknown register %d", r)
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (r *Register) UnmarshalText(b []byte) error {
+	for k, name := range registerNames {
+		if name == string(b) {
+			*r = Register(k)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown register %q", b)
+}
+
+// Change is a change of a register made by an instruction.
+type Change struct {
+	Reg Register `json:"reg"`
+	Old int      `json:"old"`
+	New int      `json:"new"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s=%X->%X", c.Reg, c.Old, c.New)
+}
+
+// Record is an executed instruction.
+type Record struct {
+	// Cycle is the number of instructions executed including this one.
+	Cycle  uint64 `json:"cycle"`
+	PC     uint16 `json:"pc"`
+	Opcode uint16 `json:"opcode"`
+	// Extra is the second word of the 4 byte F000 NNNN instruction.
+	Extra    uint16   `json:"extra,omitempty"`
+	Mnemonic string   `json:"mnemonic,omitempty"`
+	Changes  []Change `json:"changes,omitempty"`
+}
+
+// Long returns true for the 4 byte instruction.
+func (r Record) Long() bool {
+	return r.Opcode == 0xF000
+}
+
+// Equal returns true if both records are of the same instruction with the
+// same effect. Mnemonics are not compared, they may use different labels.
+func (r Record) Equal(o Record) bool {
+	if r.Cycle != o.Cycle || r.PC != o.PC || r.Opcode != o.Opcode ||
+		r.Long() && r.Extra != o.Extra || len(r.Changes) != len(o.Changes) {
+		return false
+	}
+	for k := range r.Changes {
+		if r.Changes[k] != o.Changes[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the record in the text format.
+func (r Record) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d\t%04X\t%04X", r.Cycle, r.PC, r.Opcode)
+	if r.Long() {
+		fmt.Fprintf(&b, "%04X", r.Extra)
+	}
+	fmt.Fprintf(&b, "\t%s\t", r.Mnemonic)
+	for k, c := range r.Changes {
+		if k > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(c.String())
+	}
+	return b.String()
+}
+
+// Format is a format of trace files.
+type Format int
+
+// Formats of trace files.
+const (
+	// Text writes a record per line with tab separated fields: cycle,
+	// address, opcode, mnemonic and changes, e.g. "V0=0->5 I=200->202".
+	Text Format = iota
+	// JSON writes a JSON object per line.
+	JSON
+	// Binary writes records without mnemonics in a compact form.
+	Binary
+)
+
+var formatNames = map[string]Format{"text": Text, "json": JSON, "binary": Binary}
+
+// ParseFormat returns the format by its name: text, json or binary.
+func ParseFormat(name string) (Format, error) {
+	f, ok := formatNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown trace format %q", name)
+	}
+	return f, nil
+}
+
+// binaryMagic starts binary traces. The last byte is the version.
+var binaryMagic = []byte{'C', '8', 'T', 1}
+
+// maxChanges is the largest number of changes in a binary record.
+const maxChanges = 0x7F
+
+// Writer writes records in the format.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+	// cycle of the previous record. Binary records store the difference.
+	cycle uint64
+	buf   []byte
+}
+
+// NewWriter creates a writer of records. Call Flush when done.
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	t := &Writer{w: bufio.NewWriter(w), format: format}
+	if format == Binary {
+		if _, err := t.w.Write(binaryMagic); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Write writes the record.
+func (t *Writer) Write(r Record) error {
+	switch t.format {
+	case JSON:
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		t.w.Write(b)
+		return t.w.WriteByte('\n')
+	case Binary:
+		return t.writeBinary(r)
+	}
+	t.w.WriteString(r.String())
+	return t.w.WriteByte('\n')
+}
+
+// writeBinary writes the header byte with the number of changes and the long
+// instruction bit, the difference of cycles, the address, the opcode and
+// changes. Numbers are big endian.
+func (t *Writer) writeBinary(r Record) error {
+	if len(r.Changes) > maxChanges || r.Cycle < t.cycle {
+		return fmt.Errorf("record of cycle %d can not be written", r.Cycle)
+	}
+	head := byte(len(r.Changes))
+	if r.Long() {
+		head |= 0x80
+	}
+	b := append(t.buf[:0], head)
+	b = appendUvarint(b, r.Cycle-t.cycle)
+	b = appendUint16(b, r.PC)
+	b = appendUint16(b, r.Opcode)
+	if r.Long() {
+		b = appendUint16(b, r.Extra)
+	}
+	for _, c := range r.Changes {
+		b = append(b, byte(c.Reg))
+		b = appendUint16(b, uint16(c.Old))
+		b = appendUint16(b, uint16(c.New))
+	}
+	t.buf = b
+	t.cycle = r.Cycle
+	_, err := t.w.Write(b)
+	return err
+}
+
+// Flush writes buffered records.
+func (t *Writer) Flush() error {
+	return t.w.Flush()
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
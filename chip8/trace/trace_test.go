@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var records = []Record{
+	{Cycle: 1, PC: 0x200, Opcode: 0x6005, Mnemonic: "LD V0, #05", Changes: []Change{{Reg: 0, Old: 0, New: 5}}},
+	{Cycle: 2, PC: 0x202, Opcode: 0xF000, Extra: 0x1234, Mnemonic: "LD I, LONG #1234", Changes: []Change{{Reg: I, Old: 0, New: 0x1234}}},
+	{Cycle: 300, PC: 0x206, Opcode: 0x2300, Mnemonic: "CALL #300", Changes: []Change{{Reg: SP, Old: 0, New: 1}}},
+	{Cycle: 301, PC: 0x300, Opcode: 0x1300, Mnemonic: "JP #300"},
+}
+
+func TestWriteRead(t *testing.T) {
+	for name, format := range formatNames {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			w, err := NewWriter(&b, format)
+			require.NoError(t, err)
+			for _, r := range records {
+				require.NoError(t, w.Write(r))
+			}
+			require.NoError(t, w.Flush())
+
+			r, err := NewReader(&b)
+			require.NoError(t, err)
+			assert.Equal(t, format, r.Format())
+			for _, want := range records {
+				got, err := r.Read()
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			}
+			_, err = r.Read()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	assert.Equal(t, "1\t0200\t6005\tLD V0, #05\tV0=0->5", records[0].String())
+	assert.Equal(t, "2\t0202\tF0001234\tLD I, LONG #1234\tI=0->1234", records[1].String())
+	assert.Equal(t, "301\t0300\t1300\tJP #300\t", records[3].String())
+}
+
+func TestReadErrors(t *testing.T) {
+	testCases := map[string]struct {
+		src     string
+		wantErr string
+	}{
+		"missing_fields":  {src: "1\t0200\t6005\n", wantErr: "trace line 1: invalid record"},
+		"invalid_opcode":  {src: "1\t0200\t60\tLD\t\n", wantErr: `trace line 1: invalid opcode "60"`},
+		"invalid_change":  {src: "\n1\t0200\t6005\tLD\tV0=5\n", wantErr: `trace line 2: invalid change "V0=5"`},
+		"unknown_reg":     {src: "1\t0200\t6005\tLD\tVG=0->5\n", wantErr: `trace line 1: unknown register "VG"`},
+		"invalid_json":    {src: "{\"cycle\":\n", wantErr: "trace line 1: unexpected end of JSON input"},
+		"binary_version":  {src: "C8T\x02", wantErr: "unsupported binary trace version 2"},
+		"truncated_entry": {src: "C8T\x01\x00\x01\x02", wantErr: "unexpected EOF"},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(test.src))
+			if err == nil {
+				_, err = r.Read()
+			}
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	addrs, err := ParseRange("0x200-0x2FF")
+	require.NoError(t, err)
+	cycles, err := ParseRange("100-")
+	require.NoError(t, err)
+	classes, err := ParseClasses("6, D")
+	require.NoError(t, err)
+	f := Filter{Addrs: addrs, Cycles: cycles, Classes: classes}
+
+	assert.True(t, f.Match(100, 0x200, 0x6005))
+	assert.True(t, f.Match(1<<40, 0x2FF, 0xD015))
+	assert.False(t, f.Match(99, 0x200, 0x6005))
+	assert.False(t, f.Match(100, 0x300, 0x6005))
+	assert.False(t, f.Match(100, 0x200, 0x7005))
+	assert.True(t, Filter{}.Match(0, 0, 0))
+
+	single, err := ParseRange("0x300")
+	require.NoError(t, err)
+	assert.Equal(t, Range{From: 0x300, To: 0x300}, single)
+
+	for _, s := range []string{"0x300-0x200", "a-b"} {
+		_, err := ParseRange(s)
+		assert.Error(t, err, s)
+	}
+	_, err = ParseClasses("10")
+	assert.EqualError(t, err, `invalid opcode class "10"`)
+}
+
+func TestDiff(t *testing.T) {
+	write := func(records []Record, format Format) *Reader {
+		var b bytes.Buffer
+		w, err := NewWriter(&b, format)
+		require.NoError(t, err)
+		for _, r := range records {
+			require.NoError(t, w.Write(r))
+		}
+		require.NoError(t, w.Flush())
+		r, err := NewReader(&b)
+		require.NoError(t, err)
+		return r
+	}
+	changed := append([]Record(nil), records[:3]...)
+	changed[1].Changes = []Change{{Reg: I, Old: 0, New: 0x1235}}
+
+	var out bytes.Buffer
+	n, err := Diff(write(records, Text), write(records, Binary), &out, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Empty(t, out.String())
+
+	n, err = Diff(write(records, JSON), write(changed, Text), &out, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	want := "- 2\t0202\tF0001234\tLD I, LONG #1234\tI=0->1234\n" +
+		"+ 2\t0202\tF0001234\tLD I, LONG #1234\tI=0->1235\n" +
+		"- 301\t0300\t1300\tJP #300\t\n" +
+		"+ end of trace\n"
+	assert.Equal(t, want, out.String())
+
+	n, err = Diff(write(records, JSON), write(changed, Text), &out, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
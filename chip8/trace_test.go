@@ -0,0 +1,59 @@
+package chip8
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pawka/chip8-emulator/chip8/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	testCases := map[string]struct {
+		filter trace.Filter
+		want   string
+	}{
+		"all": {
+			want: "1\t0200\t6005\tLD V0, #05\tV0=0->5\n" +
+				"2\t0202\tA300\tLD I, #300\tI=0->300\n" +
+				"3\t0204\t2208\tCALL #208\tSP=0->1\n" +
+				"4\t0208\t7001\tADD V0, #01\tV0=5->6\n",
+		},
+		"addresses": {
+			filter: trace.Filter{Addrs: trace.Range{From: 0x202, To: 0x204}},
+			want: "2\t0202\tA300\tLD I, #300\tI=0->300\n" +
+				"3\t0204\t2208\tCALL #208\tSP=0->1\n",
+		},
+		"opcode_classes": {
+			filter: trace.Filter{Classes: 1<<0x6 | 1<<0x7},
+			want: "1\t0200\t6005\tLD V0, #05\tV0=0->5\n" +
+				"4\t0208\t7001\tADD V0, #01\tV0=5->6\n",
+		},
+		"cycles": {
+			filter: trace.Filter{Cycles: trace.Range{From: 3, To: 3}},
+			want:   "3\t0204\t2208\tCALL #208\tSP=0->1\n",
+		},
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "chip8")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "trace.txt")
+
+			c := newTestChip8(t, Ctx{path: binaryPath, trace: path, traceFilter: test.filter})
+			require.NoError(t, c.start())
+			copy(c.ram.Memory[programStartPos:], []byte{0x60, 0x05, 0xA3, 0x00, 0x22, 0x08, 0x00, 0x00, 0x70, 0x01})
+			require.NoError(t, c.Step(4))
+			require.NoError(t, c.closeTrace())
+
+			b, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, string(b))
+			assert.Equal(t, uint64(4), c.cycles)
+		})
+	}
+}
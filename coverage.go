@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Pawka/chip8-emulator/chip8"
+	"github.com/Pawka/chip8-emulator/chip8/coverage"
+	"github.com/Pawka/chip8-emulator/chip8/symbols"
+)
+
+// romOrigin is the address where roms are loaded.
+const romOrigin = 0x200
+
+// reportCoverage runs the coverage subcommand which merges coverage files of
+// the rom and writes the annotated disassembly and the HTML report.
+func reportCoverage(args []string) error {
+	set := flag.NewFlagSet(args[0], flag.ExitOnError)
+	html := set.String("html", "", "Write HTML report to the file at given path")
+	merged := set.String("merge", "", "Write merged coverage to the file at given path")
+	symbolsPath := set.String("symbols", "", "Load labels and source lines from the symbol file or .lst listing")
+	set.Parse(args[1:])
+	if set.NArg() < 2 {
+		return fmt.Errorf("usage: %s [flags] <path-to-rom> <coverage>...", args[0])
+	}
+
+	rom, syms, err := chip8.ReadROM(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *symbolsPath != "" {
+		if syms, err = symbols.Load(*symbolsPath); err != nil {
+			return err
+		}
+	}
+	cov := coverage.New(sha256.Sum256(rom))
+	cov.Runs = 0
+	for _, path := range set.Args()[1:] {
+		c, err := coverage.Load(path)
+		if err != nil {
+			return err
+		}
+		if err := cov.Merge(c); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if *merged != "" {
+		if err := writeFile(*merged, cov.Write); err != nil {
+			return err
+		}
+	}
+	report := coverage.NewReport(rom, romOrigin, cov, syms)
+	if *html != "" {
+		title := "Coverage of " + filepath.Base(set.Arg(0))
+		return writeFile(*html, func(w io.Writer) error {
+			return report.WriteHTML(w, title)
+		})
+	}
+	return report.WriteListing(os.Stdout)
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/gdamore/tcell v1.3.0
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/sys v0.0.0-20190626150813-e07cf5db2756
 )
@@ -1,21 +1,58 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/Pawka/chip8-emulator/chip8"
 )
 
+// subcommands are tools which do not run the emulator.
+var subcommands = map[string]func(args []string) error{
+	"asm":        assemble,
+	"trace-diff": diffTraces,
+	"coverage":   reportCoverage,
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "Usage: %s <path-to-rom>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s run [flags] <path-to-rom-or-octo-source>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s asm [flags] <path-to-source>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s trace-diff [flags] <trace> <trace>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s coverage [flags] <path-to-rom> <coverage>...\n", os.Args[0])
+		os.Exit(2)
+	}
+	if cmd, ok := subcommands[os.Args[1]]; ok {
+		if err := cmd(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	args := os.Args
+	if args[1] == "run" {
+		// Octo sources are compiled when the rom is loaded.
+		args = args[1:]
+	}
+	ctx, err := chip8.NewCtxFromArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
-	ctx, err := chip8.NewCtxFromArgs(os.Args)
+	cpu, err := chip8.NewChip8(ctx)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cpu.Run(ctx); err != nil {
+		var cpuErr *chip8.CPUError
+		if errors.As(err, &cpuErr) {
+			fmt.Fprint(os.Stderr, cpuErr.Report())
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
 	}
-	cpu := chip8.NewChip8(ctx)
-	cpu.Run(ctx)
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Pawka/chip8-emulator/chip8/trace"
+)
+
+// errTracesDiffer is returned when traces are not the same.
+var errTracesDiffer = errors.New("traces differ")
+
+// diffTraces runs the trace-diff subcommand which compares two traces in any
+// format and prints differing records.
+func diffTraces(args []string) error {
+	set := flag.NewFlagSet(args[0], flag.ExitOnError)
+	max := set.Int("max", 10, "Stop after given number of differences, 0 prints all")
+	set.Parse(args[1:])
+	if set.NArg() != 2 {
+		return fmt.Errorf("usage: %s [flags] <trace> <trace>", args[0])
+	}
+
+	a, fa, err := openTrace(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fa.Close()
+	b, fb, err := openTrace(set.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer fb.Close()
+
+	n, err := trace.Diff(a, b, os.Stdout, *max)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errTracesDiffer
+	}
+	return nil
+}
+
+// openTrace opens the trace file. Close the file when done.
+func openTrace(path string) (*trace.Reader, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := trace.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, f, nil
+}